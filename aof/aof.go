@@ -1,6 +1,7 @@
 package aof
 
 import (
+	"bufio"
 	"goRedis/config"
 	databaseface "goRedis/interface/database"
 	"goRedis/lib/logger"
@@ -10,8 +11,11 @@ import (
 	"goRedis/resp/reply"
 	"io"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 // CmdLine is alias for [][]byte, represents a command line
@@ -21,6 +25,16 @@ const (
 	aofQueueSize = 1 << 16
 )
 
+// values of appendfsync
+const (
+	// FsyncAlways syncs aof file after every command is written
+	FsyncAlways = "always"
+	// FsyncEverySec syncs aof file every second
+	FsyncEverySec = "everysec"
+	// FsyncNo leaves syncing to the operating system
+	FsyncNo = "no"
+)
+
 type payload struct {
 	cmdLine CmdLine
 	dbIndex int
@@ -42,7 +56,7 @@ type AofHandler struct {
 // NewAOFHandler creates a new aof.AofHandler
 func NewAOFHandler(db databaseface.Database) (*AofHandler, error) {
 	handler := &AofHandler{}
-	handler.aofFilename = config.Properties.AppendFilename
+	handler.aofFilename = config.Properties().AppendFilename
 	handler.db = db
 	handler.LoadAof(0)
 	aofFile, err := os.OpenFile(handler.aofFilename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
@@ -58,9 +72,76 @@ func NewAOFHandler(db databaseface.Database) (*AofHandler, error) {
 	return handler, nil
 }
 
+// DatasetFunc calls write with commands which could rebuild the whole dataset, such as CONFIG SET appendonly yes
+type DatasetFunc func(write func(dbIndex int, cmdLine CmdLine) error) error
+
+// NewAOFHandlerFromDataset creates an aof.AofHandler whose file is rewritten from the current dataset rather than loaded,
+// it is used to turn on aof at runtime. Invoker should prevent the dataset from being modified until it returns
+func NewAOFHandlerFromDataset(db databaseface.Database, dataset DatasetFunc) (*AofHandler, error) {
+	handler := &AofHandler{}
+	handler.aofFilename = config.Properties().AppendFilename
+	handler.db = db
+	if err := handler.writeDataset(dataset); err != nil {
+		return nil, err
+	}
+	aofFile, err := os.OpenFile(handler.aofFilename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	handler.aofFile = aofFile
+	handler.aofChan = make(chan *payload, aofQueueSize)
+	handler.aofFinished = make(chan struct{})
+	go func() {
+		handler.handleAof()
+	}()
+	return handler, nil
+}
+
+// writeDataset writes the dataset into a temp file and renames it to aof file
+func (handler *AofHandler) writeDataset(dataset DatasetFunc) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(handler.aofFilename), "aof-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpFile.Name()) // no-op after renamed
+	}()
+	writer := bufio.NewWriter(tmpFile)
+	currentDB := -1
+	err = dataset(func(dbIndex int, cmdLine CmdLine) error {
+		if dbIndex != currentDB {
+			selectCmd := reply.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(dbIndex)))
+			if _, err := writer.Write(selectCmd.ToBytes()); err != nil {
+				return err
+			}
+			currentDB = dbIndex
+		}
+		_, err := writer.Write(reply.MakeMultiBulkReply(cmdLine).ToBytes())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// handleAof assumes that the file ends within db 0
+	if currentDB > 0 {
+		selectCmd := reply.MakeMultiBulkReply(utils.ToCmdLine("SELECT", "0"))
+		if _, err := writer.Write(selectCmd.ToBytes()); err != nil {
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), handler.aofFilename)
+}
+
 // AddAof send command to aof goroutine through channel
 func (handler *AofHandler) AddAof(dbIndex int, cmdLine CmdLine) {
-	if config.Properties.AppendOnly && handler.aofChan != nil {
+	if config.Properties().AppendOnly && handler.aofChan != nil {
 		handler.aofChan <- &payload{
 			cmdLine: cmdLine,
 			dbIndex: dbIndex,
@@ -72,26 +153,61 @@ func (handler *AofHandler) AddAof(dbIndex int, cmdLine CmdLine) {
 func (handler *AofHandler) handleAof() {
 	// serialized execution
 	handler.currentDB = 0
-	for p := range handler.aofChan {
-		handler.pausingAof.RLock() // prevent other goroutines from pausing aof
-		if p.dbIndex != handler.currentDB {
-			// select db
-			data := reply.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(p.dbIndex))).ToBytes()
-			_, err := handler.aofFile.Write(data)
-			if err != nil {
-				logger.Warn(err)
-				continue // skip this command
+	// aof file is synced by this goroutine every second if appendfsync is everysec
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case p, ok := <-handler.aofChan:
+			if !ok {
+				// always sync before shutdown like redis
+				handler.fsync()
+				handler.aofFinished <- struct{}{}
+				return
+			}
+			handler.writeAof(p)
+			if fsyncPolicy() == FsyncAlways {
+				handler.fsync()
+			}
+		case <-ticker.C:
+			if fsyncPolicy() == FsyncEverySec {
+				handler.fsync()
 			}
-			handler.currentDB = p.dbIndex
 		}
-		data := reply.MakeMultiBulkReply(p.cmdLine).ToBytes()
+	}
+}
+
+func (handler *AofHandler) writeAof(p *payload) {
+	handler.pausingAof.RLock() // prevent other goroutines from pausing aof
+	defer handler.pausingAof.RUnlock()
+	if p.dbIndex != handler.currentDB {
+		// select db
+		data := reply.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(p.dbIndex))).ToBytes()
 		_, err := handler.aofFile.Write(data)
 		if err != nil {
 			logger.Warn(err)
+			return // skip this command
 		}
-		handler.pausingAof.RUnlock()
+		handler.currentDB = p.dbIndex
+	}
+	data := reply.MakeMultiBulkReply(p.cmdLine).ToBytes()
+	_, err := handler.aofFile.Write(data)
+	if err != nil {
+		logger.Warn(err)
 	}
-	handler.aofFinished <- struct{}{}
+}
+
+func (handler *AofHandler) fsync() {
+	handler.pausingAof.RLock()
+	defer handler.pausingAof.RUnlock()
+	if err := handler.aofFile.Sync(); err != nil {
+		logger.Warn("fsync failed: " + err.Error())
+	}
+}
+
+// fsyncPolicy returns appendfsync in lower case, it is read for each write since CONFIG SET could change it
+func fsyncPolicy() string {
+	return strings.ToLower(config.Properties().AppendFsync)
 }
 
 // LoadAof read aof file
@@ -119,21 +235,22 @@ func (handler *AofHandler) LoadAof(maxBytes int) {
 	} else {
 		reader = file
 	}
-	ch := parser.ParseStream(reader)
+	p := parser.NewParser(reader)
+	defer p.Release()
 	fakeConn := &connection.FakeConn{} // only used for save dbIndex
-	for p := range ch {
-		if p.Err != nil {
-			if p.Err == io.EOF {
+	for {
+		data, err := p.Next()
+		if err != nil {
+			if err == io.EOF {
 				break
 			}
-			logger.Error("parse error: " + p.Err.Error())
-			continue
-		}
-		if p.Data == nil {
-			logger.Error("empty payload")
-			continue
+			logger.Error("parse error: " + err.Error())
+			if parser.IsProtocolError(err) {
+				continue
+			}
+			break // truncated aof file
 		}
-		r, ok := p.Data.(*reply.MultiBulkReply)
+		r, ok := data.(*reply.MultiBulkReply)
 		if !ok {
 			logger.Error("require multi bulk reply")
 			continue
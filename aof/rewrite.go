@@ -64,7 +64,7 @@ func (handlerAof *AofHandler) StartRewrite() (*RewriteCtx, error) {
 // makes DoRewrite public for testing only,please use Rewrite instead
 func (handlerAof *AofHandler) DoRewrite(ctx *RewriteCtx) (err error) {
 	// start rewrite
-	if !config.Properties.AofUseRdbPreamble {
+	if !config.Properties().AofUseRdbPreamble {
 		logger.Info("generate aof preamble")
 		//err = handlerAof.generateAof(ctx)
 	} else {
@@ -0,0 +1,98 @@
+package cluster
+
+import (
+	"goRedis/config"
+	"sync"
+	"time"
+)
+
+// default settings of circuit breaker
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 5 * time.Second
+)
+
+// states of circuit breaker
+const (
+	breakerClosed   = iota // requests are allowed
+	breakerOpen            // requests fail fast until cooldown
+	breakerHalfOpen        // one trial request is allowed to detect whether the peer recovered
+)
+
+var breakerStateNames = []string{"closed", "open", "half-open"}
+
+// circuitBreaker fails fast requests to a peer after repeated errors
+type circuitBreaker struct {
+	mu        sync.Mutex
+	state     int
+	failures  int // consecutive failures
+	openedAt  time.Time
+	trialing  bool // a trial request is in flight when half-open
+	threshold int
+	cooldown  time.Duration
+
+	// stats
+	totalFailures int64
+	rejected      int64
+}
+
+func makeCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{
+		state:     breakerClosed,
+		threshold: intOrDefault(config.Properties().PeerBreakerThreshold, defaultBreakerThreshold),
+		cooldown:  millisOrDefault(config.Properties().PeerBreakerCooldown, defaultBreakerCooldown),
+	}
+}
+
+// allow returns whether a request can be sent to peer
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			b.rejected++
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.trialing = true
+		return true
+	case breakerHalfOpen:
+		if b.trialing {
+			b.rejected++
+			return false
+		}
+		b.trialing = true
+		return true
+	}
+	return true
+}
+
+// onSuccess closes the breaker
+func (b *circuitBreaker) onSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.trialing = false
+	b.state = breakerClosed
+}
+
+// onFailure opens the breaker if the trial request failed or there are too many consecutive failures
+func (b *circuitBreaker) onFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.totalFailures++
+	b.trialing = false
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// stats returns state name, consecutive failures, total failures and rejected requests
+func (b *circuitBreaker) stats() (string, int, int64, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return breakerStateNames[b.state], b.failures, b.totalFailures, b.rejected
+}
@@ -4,19 +4,42 @@ import (
 	"context"
 	"errors"
 	pool "github.com/jolestar/go-commons-pool/v2"
+	"goRedis/config"
+	"goRedis/lib/utils"
 	"goRedis/resp/client"
+	"goRedis/resp/reply"
+	"time"
+)
+
+// default settings of connection pool between cluster nodes
+const (
+	defaultPeerPoolMaxActive     = 16
+	defaultPeerPoolMaxIdle       = 8
+	defaultPeerPoolCheckInterval = 10 * time.Second
+	defaultPeerBorrowTimeout     = time.Second
+	defaultPeerConnectTimeout    = time.Second
+	defaultPeerTimeout           = 3 * time.Second
 )
 
 type connectionFactory struct {
-	Peer string
+	Peer           string
+	ConnectTimeout time.Duration
+	Timeout        time.Duration
 }
 
 func (f *connectionFactory) MakeObject(ctx context.Context) (*pool.PooledObject, error) {
-	c, err := client.MakeClient(f.Peer)
+	c, err := client.MakeClientWithTimeout(f.Peer, f.ConnectTimeout, f.Timeout)
 	if err != nil {
 		return nil, err
 	}
 	c.Start()
+	if config.Properties().MasterAuth != "" {
+		// masteruser should be allowed to execute all commands, including internal commands of cluster
+		if err := c.Auth(config.Properties().MasterUser, config.Properties().MasterAuth); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
 	return pool.NewPooledObject(c), nil
 }
 
@@ -29,8 +52,14 @@ func (f *connectionFactory) DestroyObject(ctx context.Context, object *pool.Pool
 	return nil
 }
 
+// ValidateObject sends PING to peer, the connection is destroyed if peer doesn't reply PONG
 func (f *connectionFactory) ValidateObject(ctx context.Context, object *pool.PooledObject) bool {
-	return true
+	c, ok := object.Object.(*client.Client)
+	if !ok {
+		return false
+	}
+	result := c.Send(utils.ToCmdLine("PING"))
+	return string(result.ToBytes()) == string(reply.MakePongReply().ToBytes())
 }
 
 func (f *connectionFactory) ActivateObject(ctx context.Context, object *pool.PooledObject) error {
@@ -40,3 +69,39 @@ func (f *connectionFactory) ActivateObject(ctx context.Context, object *pool.Poo
 func (f *connectionFactory) PassivateObject(ctx context.Context, object *pool.PooledObject) error {
 	return nil
 }
+
+// makeConnectionPool creates connection pool to peer according to config
+func makeConnectionPool(ctx context.Context, peer string) *pool.ObjectPool {
+	factory := &connectionFactory{
+		Peer:           peer,
+		ConnectTimeout: millisOrDefault(config.Properties().PeerConnectTimeout, defaultPeerConnectTimeout),
+		Timeout:        millisOrDefault(config.Properties().PeerTimeout, defaultPeerTimeout),
+	}
+	poolConfig := pool.NewDefaultPoolConfig()
+	poolConfig.MaxTotal = intOrDefault(config.Properties().PeerPoolMaxActive, defaultPeerPoolMaxActive)
+	poolConfig.MaxIdle = intOrDefault(config.Properties().PeerPoolMaxIdle, defaultPeerPoolMaxIdle)
+	// validate new connections and idle connections, borrowing doesn't validate to avoid an extra round trip
+	poolConfig.TestOnCreate = true
+	poolConfig.TestWhileIdle = true
+	poolConfig.NumTestsPerEvictionRun = poolConfig.MaxIdle
+	poolConfig.TimeBetweenEvictionRuns = millisOrDefault(config.Properties().PeerPoolCheckInterval, defaultPeerPoolCheckInterval)
+	return pool.NewObjectPool(ctx, factory, poolConfig)
+}
+
+func borrowTimeout() time.Duration {
+	return millisOrDefault(config.Properties().PeerBorrowTimeout, defaultPeerBorrowTimeout)
+}
+
+func intOrDefault(val int, defaultVal int) int {
+	if val <= 0 {
+		return defaultVal
+	}
+	return val
+}
+
+func millisOrDefault(millis int, defaultVal time.Duration) time.Duration {
+	if millis <= 0 {
+		return defaultVal
+	}
+	return time.Duration(millis) * time.Millisecond
+}
@@ -6,13 +6,17 @@ import (
 	pool "github.com/jolestar/go-commons-pool/v2"
 	"goRedis/config"
 	"goRedis/database"
-	databaseface "goRedis/interface/database"
+	"goRedis/datastruct/dict"
 	"goRedis/interface/resp"
 	"goRedis/lib/consistenthash"
 	"goRedis/lib/logger"
+	"goRedis/resp/connection"
 	"goRedis/resp/reply"
+	"net"
 	"runtime/debug"
 	"strings"
+	"sync"
+	"time"
 )
 
 // ClusterDatabase represents a node of godis cluster
@@ -23,29 +27,39 @@ type ClusterDatabase struct {
 	nodes          []string                    // 整个集群的节点
 	peerPicker     *consistenthash.NodeMap     //
 	peerConnection map[string]*pool.ObjectPool // 多个连接池
-	db             databaseface.Database
+	peerBreakers   map[string]*circuitBreaker  // 每个兄弟节点的熔断器
+	db             *database.StandaloneDatabase
+
+	transactions  *dict.SimpleDict // txID -> Transaction, 作为参与者时的分布式事务
+	transactionMu sync.RWMutex
+	txCounter     int64 // used to generate transaction id
+
+	// connection id -> whether the remote address of connection is a peer, see isPeerConn
+	peerAddrs sync.Map
 }
 
 // MakeClusterDatabase creates and starts a node of cluster
 func MakeClusterDatabase() *ClusterDatabase {
 	cluster := &ClusterDatabase{
-		self: config.Properties.Self,
+		self: config.Properties().Self,
 
 		db:             database.NewStandaloneDatabase(), // 该节点单机的redis数据库
 		peerPicker:     consistenthash.NewNodeMap(nil),
 		peerConnection: make(map[string]*pool.ObjectPool), // 该节点和其他节点的连接池
+		peerBreakers:   make(map[string]*circuitBreaker),
+		transactions:   dict.MakeSimple(),
+		txCounter:      time.Now().UnixNano(), // avoid reusing transaction id after restart
 	}
-	nodes := make([]string, 0, len(config.Properties.Peers)+1) // 所有的节点
-	for _, peer := range config.Properties.Peers {             // 添加兄弟节点地址
+	nodes := make([]string, 0, len(config.Properties().Peers)+1) // 所有的节点
+	for _, peer := range config.Properties().Peers {             // 添加兄弟节点地址
 		nodes = append(nodes, peer)
 	}
-	nodes = append(nodes, config.Properties.Self) // 添加自己的地址
-	cluster.peerPicker.AddNode(nodes...)          // 向集群中添加节点
+	nodes = append(nodes, config.Properties().Self) // 添加自己的地址
+	cluster.peerPicker.AddNode(nodes...)            // 向集群中添加节点
 	ctx := context.Background()
-	for _, peer := range config.Properties.Peers { // 自己和兄弟节点之间建立连接池
-		cluster.peerConnection[peer] = pool.NewObjectPoolWithDefaultConfig(ctx, &connectionFactory{
-			Peer: peer,
-		})
+	for _, peer := range config.Properties().Peers { // 自己和兄弟节点之间建立连接池
+		cluster.peerConnection[peer] = makeConnectionPool(ctx, peer)
+		cluster.peerBreakers[peer] = makeCircuitBreaker()
 	}
 	cluster.nodes = nodes
 	return cluster
@@ -57,6 +71,10 @@ type CmdFunc func(cluster *ClusterDatabase, c resp.Connection, cmdAndArgs [][]by
 // Close stops current node of cluster
 func (cluster *ClusterDatabase) Close() {
 	cluster.db.Close()
+	ctx := context.Background()
+	for _, peerPool := range cluster.peerConnection {
+		peerPool.Close(ctx)
+	}
 }
 
 var router = makeRouter()
@@ -70,6 +88,53 @@ func (cluster *ClusterDatabase) Exec(c resp.Connection, cmdLine [][]byte) (resul
 		}
 	}()
 	cmdName := strings.ToLower(string(cmdLine[0]))
+	if cmdName == "auth" {
+		return database.Auth(c, cmdLine[1:])
+	}
+	if cmdName == "hello" {
+		return database.Hello(c, cmdLine[1:])
+	}
+	if errReply := database.CheckAuth(c, cmdName); errReply != nil {
+		return errReply
+	}
+	if internalCommands[cmdName] && !cluster.isPeerConn(c) {
+		return reply.MakeErrReply("ERR unknown command '" + cmdName + "', or not supported in cluster mode")
+	}
+	if errReply := database.CheckPermission(c, cmdLine); errReply != nil {
+		return errReply
+	}
+	if errReply := database.CheckSubscribeContext(c, cmdName); errReply != nil {
+		return errReply
+	}
+	switch cmdName {
+	case "multi":
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return database.StartMulti(c)
+	case "discard":
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return database.DiscardMulti(c)
+	case "exec":
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return execMulti(cluster, c)
+	}
+	if c != nil && c.InMultiState() {
+		if cmdName == "select" {
+			return reply.MakeErrReply("ERR cannot select database within multi")
+		}
+		return database.EnqueueCmd(c, cmdLine)
+	}
+	if cmdName == "acl" {
+		return database.ExecACL(c, cmdLine[1:])
+	}
+	if cmdName == "client" {
+		return database.ExecClient(c, cmdLine[1:])
+	}
 	cmdFunc, ok := router[cmdName]
 	if !ok {
 		return reply.MakeErrReply("ERR unknown command '" + cmdName + "', or not supported in cluster mode")
@@ -80,5 +145,70 @@ func (cluster *ClusterDatabase) Exec(c resp.Connection, cmdLine [][]byte) (resul
 
 // AfterClientClose does some clean after client close connection
 func (cluster *ClusterDatabase) AfterClientClose(c resp.Connection) {
+	cluster.peerAddrs.Delete(c.GetID())
 	cluster.db.AfterClientClose(c)
 }
+
+// internalCommands are sent between nodes of cluster, only peer connections are allowed to execute them
+var internalCommands = map[string]bool{
+	"local":        true,
+	"prepare":      true,
+	"preparemulti": true,
+	"commit":       true,
+	"rollback":     true,
+}
+
+// isPeerConn returns whether the connection is created by another node of cluster:
+// it comes from the host of a peer, and it has authenticated as masteruser if masterauth is set
+func (cluster *ClusterDatabase) isPeerConn(c resp.Connection) bool {
+	var conn *connection.Connection
+	switch c := c.(type) {
+	case nil, *connection.FakeConn:
+		return true
+	case *connection.Connection:
+		conn = c
+	default:
+		return false
+	}
+	if config.Properties().MasterAuth != "" {
+		masterUser := config.Properties().MasterUser
+		if masterUser == "" {
+			masterUser = "default"
+		}
+		if conn.GetUser() != masterUser {
+			return false
+		}
+	}
+	// the remote address never changes, resolve it once per connection
+	if isPeer, ok := cluster.peerAddrs.Load(conn.GetID()); ok {
+		return isPeer.(bool)
+	}
+	isPeer := isPeerAddr(conn.RemoteAddr())
+	cluster.peerAddrs.Store(conn.GetID(), isPeer)
+	return isPeer
+}
+
+// isPeerAddr returns whether the address belongs to the host of a peer, hostnames of peers are resolved
+func isPeerAddr(addr net.Addr) bool {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	for _, peer := range config.Properties().Peers {
+		peerHost, _, err := net.SplitHostPort(peer)
+		if err != nil {
+			continue
+		}
+		peerIPs, err := net.LookupHost(peerHost)
+		if err != nil {
+			continue
+		}
+		for _, peerIP := range peerIPs {
+			if net.ParseIP(peerIP).Equal(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -8,6 +8,7 @@ import (
 	"goRedis/resp/client"
 	"goRedis/resp/reply"
 	"strconv"
+	"sync"
 )
 
 // getPeerClient 从连接池中拿一个连接
@@ -17,8 +18,10 @@ func (cluster *ClusterDatabase) getPeerClient(peer string) (*client.Client, erro
 	if !ok {
 		return nil, errors.New("connection factory not found")
 	}
-	// 从连接池中借一个连接
-	raw, err := factory.BorrowObject(context.Background())
+	// 从连接池中借一个连接, 连接池耗尽时最多等待borrowTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), borrowTimeout())
+	defer cancel()
+	raw, err := factory.BorrowObject(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -38,33 +41,108 @@ func (cluster *ClusterDatabase) returnPeerClient(peer string, peerClient *client
 	return connectionFactory.ReturnObject(context.Background(), peerClient)
 }
 
+// invalidatePeerClient 销毁一个出错的连接, replies of a timed out connection may be out of order
+func (cluster *ClusterDatabase) invalidatePeerClient(peer string, peerClient *client.Client) error {
+	connectionFactory, ok := cluster.peerConnection[peer]
+	if !ok {
+		return errors.New("connection factory not found")
+	}
+	return connectionFactory.InvalidateObject(context.Background(), peerClient)
+}
+
 // relay 转发 command to peer
 // select db by c.GetDBIndex()
 // cannot call Prepare, Commit, execRollback of self node
+// requests to a peer fail fast when its circuit breaker is open
 func (cluster *ClusterDatabase) relay(peer string, c resp.Connection, args [][]byte) resp.Reply {
 	// 如果是自己，本地数据库直接执行
 	if peer == cluster.self {
 		// to self db
 		return cluster.db.Exec(c, args)
 	}
+	breaker, ok := cluster.peerBreakers[peer]
+	if !ok {
+		return reply.MakeErrReply("ERR peer " + peer + " not found")
+	}
+	if !breaker.allow() {
+		return reply.MakeErrReply("ERR peer " + peer + " is unavailable, circuit breaker is open")
+	}
+	// reports the result in defer, so the trial request of a half-open breaker is finished even if relaying panics
+	succeeded := false
+	defer func() {
+		if succeeded {
+			breaker.onSuccess()
+		} else {
+			breaker.onFailure()
+		}
+	}()
 	peerClient, err := cluster.getPeerClient(peer) //获取一个连接
 	if err != nil {
 		return reply.MakeErrReply(err.Error())
 	}
-	defer func() {
-		_ = cluster.returnPeerClient(peer, peerClient) // 归还连接
-	}()
 	// 先切换数据库
-	peerClient.Send(utils.ToCmdLine("SELECT", strconv.Itoa(c.GetDBIndex())))
-	return peerClient.Send(args)
+	result := peerClient.Send(utils.ToCmdLine("SELECT", strconv.Itoa(c.GetDBIndex())))
+	if _, isNetErr := result.(*client.NetErrReply); !isNetErr {
+		result = peerClient.Send(args)
+	}
+	if _, isNetErr := result.(*client.NetErrReply); isNetErr {
+		_ = cluster.invalidatePeerClient(peer, peerClient)
+		return result
+	}
+	succeeded = true
+	_ = cluster.returnPeerClient(peer, peerClient) // 归还连接
+	return result
+}
+
+// groupBy 按照key所在的节点分组
+// returns node -> keys
+func (cluster *ClusterDatabase) groupBy(keys []string) map[string][]string {
+	result := make(map[string][]string)
+	for _, key := range keys {
+		peer := cluster.peerPicker.PickNode(key)
+		group, ok := result[peer]
+		if !ok {
+			group = make([]string, 0)
+		}
+		group = append(group, key)
+		result[peer] = group
+	}
+	return result
 }
 
 // broadcast 广播 command to all node in cluster
+// peers execute the command on their local db instead of broadcasting it again
 func (cluster *ClusterDatabase) broadcast(c resp.Connection, args [][]byte) map[string]resp.Reply {
-	result := make(map[string]resp.Reply)
+	localArgs := make([][]byte, 0, len(args)+1)
+	localArgs = append(localArgs, []byte("Local"))
+	localArgs = append(localArgs, args...)
+	nodeCmdLines := make(map[string]CmdLine, len(cluster.nodes))
 	for _, node := range cluster.nodes {
-		reply := cluster.relay(node, c, args)
-		result[node] = reply
+		if node == cluster.self {
+			nodeCmdLines[node] = args
+		} else {
+			nodeCmdLines[node] = localArgs
+		}
+	}
+	return cluster.relayGroups(c, nodeCmdLines)
+}
+
+// relayGroups sends command lines to their nodes concurrently, one request for each node
+// returns node -> reply
+func (cluster *ClusterDatabase) relayGroups(c resp.Connection, nodeCmdLines map[string]CmdLine) map[string]resp.Reply {
+	result := make(map[string]resp.Reply, len(nodeCmdLines))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for node, cmdLine := range nodeCmdLines {
+		wg.Add(1)
+		go func(node string, cmdLine CmdLine) {
+			defer wg.Done()
+			re := cluster.relay(node, c, cmdLine)
+			mu.Lock()
+			result[node] = re
+			mu.Unlock()
+		}(node, cmdLine)
 	}
+	wg.Wait()
 	return result
 }
@@ -0,0 +1,50 @@
+package cluster
+
+import (
+	"bytes"
+	"fmt"
+	"goRedis/database"
+	"goRedis/interface/resp"
+	"strings"
+)
+
+// Info returns server information of local node, the cluster section includes stats of peers
+func Info(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	return cluster.db.ExecInfo(args[1:], database.InfoSection{
+		Name: "cluster",
+		Gen:  cluster.genClusterInfo,
+	})
+}
+
+// genClusterInfo generates the cluster section of INFO, including stats of peer connection pools and circuit breakers
+func (cluster *ClusterDatabase) genClusterInfo() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("# Cluster\r\n")
+	buf.WriteString("cluster_enabled:1\r\n")
+	buf.WriteString(fmt.Sprintf("cluster_self:%s\r\n", cluster.self))
+	buf.WriteString(fmt.Sprintf("cluster_known_nodes:%d\r\n", len(cluster.nodes)))
+	i := 0
+	for _, peer := range cluster.nodes {
+		if peer == cluster.self {
+			continue
+		}
+		state, failures, totalFailures, rejected := cluster.peerBreakers[peer].stats()
+		peerPool := cluster.peerConnection[peer]
+		buf.WriteString(fmt.Sprintf("peer%d:addr=%s,breaker=%s,consecutive_failures=%d,failures=%d,rejected=%d,"+
+			"pool_active=%d,pool_idle=%d,pool_max_active=%d,pool_destroyed=%d,pool_destroyed_by_validation=%d\r\n",
+			i, peer, state, failures, totalFailures, rejected,
+			peerPool.GetNumActive(), peerPool.GetNumIdle(), peerPool.Config.MaxTotal,
+			peerPool.GetDestroyedCount(), peerPool.GetDestroyedByBorrowValidationCount()))
+		i++
+	}
+	return buf.Bytes()
+}
+
+// Memory relays MEMORY USAGE to the node holding the key, other subcommands are executed on local node
+func Memory(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) >= 3 && strings.ToLower(string(args[1])) == "usage" {
+		peer := cluster.peerPicker.PickNode(string(args[2]))
+		return cluster.relay(peer, c, args)
+	}
+	return cluster.db.Exec(c, args)
+}
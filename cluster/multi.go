@@ -0,0 +1,88 @@
+package cluster
+
+import (
+	"goRedis/database"
+	"goRedis/interface/resp"
+	"goRedis/resp/parser"
+	"goRedis/resp/reply"
+	"strings"
+)
+
+// execMulti executes queued commands of the connection,
+// commands are grouped by the node of their keys and committed on all related nodes by try-commit-catch
+func execMulti(cluster *ClusterDatabase, c resp.Connection) resp.Reply {
+	if !c.InMultiState() {
+		return reply.MakeErrReply("ERR EXEC without MULTI")
+	}
+	defer c.SetMultiState(false)
+	if len(c.GetTxErrors()) > 0 {
+		return reply.MakeErrReply("EXECABORT Transaction discarded because of previous errors.")
+	}
+	cmdLines := c.GetQueuedCmdLine()
+
+	// group commands by node, keep their index to reassemble the result
+	groupMap := make(map[string][]int)
+	for i, cmdLine := range cmdLines {
+		peer, errReply := cluster.pickCmdNode(cmdLine)
+		if errReply != nil {
+			return errReply
+		}
+		groupMap[peer] = append(groupMap[peer], i)
+	}
+	if len(groupMap) == 0 {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	if _, ok := groupMap[cluster.self]; ok && len(groupMap) == 1 { // all keys are on self node
+		return cluster.db.ExecMulti(c.GetDBIndex(), cmdLines)
+	}
+
+	txID := cluster.nextTxID()
+	nodeCmdLines := make(map[string]CmdLine, len(groupMap))
+	for peer, indexes := range groupMap {
+		args := make([][]byte, 0, len(indexes)+2)
+		args = append(args, []byte("PrepareMulti"), []byte(txID))
+		for _, i := range indexes {
+			args = append(args, encodeCmdLine(cmdLines[i]))
+		}
+		nodeCmdLines[peer] = args
+	}
+	respMap, errReply := cluster.doTransaction(c, txID, nodeCmdLines)
+	if errReply != nil {
+		// nothing is executed if prepare failed, and executed commands are rolled back if commit failed
+		return reply.MakeErrReply("EXECABORT Transaction aborted: " + errReply.Error())
+	}
+
+	results := make([]resp.Reply, len(cmdLines))
+	for peer, indexes := range groupMap {
+		encoded, ok := respMap[peer].(*reply.MultiBulkReply)
+		if !ok || len(encoded.Args) != len(indexes) {
+			return reply.MakeErrReply("error occurs: unexpected reply of node " + peer)
+		}
+		for j, i := range indexes {
+			replies, err := parser.ParseBytes(encoded.Args[j])
+			if err != nil || len(replies) != 1 {
+				return reply.MakeErrReply("error occurs: unexpected reply of node " + peer)
+			}
+			results[i] = replies[0]
+		}
+	}
+	return reply.MakeMultiRawReply(results)
+}
+
+// pickCmdNode returns the node of keys of the given command, keyless command is executed on self node
+// within multi every command must have all its keys on the same node
+func (cluster *ClusterDatabase) pickCmdNode(cmdLine CmdLine) (string, reply.ErrorReply) {
+	writeKeys, readKeys := database.GetRelatedKeys(cmdLine)
+	keys := append(writeKeys, readKeys...)
+	if len(keys) == 0 {
+		return cluster.self, nil
+	}
+	peer := cluster.peerPicker.PickNode(keys[0])
+	for _, key := range keys[1:] {
+		if cluster.peerPicker.PickNode(key) != peer {
+			cmdName := strings.ToLower(string(cmdLine[0]))
+			return "", reply.MakeErrReply("ERR keys of '" + cmdName + "' within MULTI must be on the same node")
+		}
+	}
+	return peer, nil
+}
@@ -1,32 +1,247 @@
 package cluster
 
 import (
+	"goRedis/database"
 	"goRedis/interface/resp"
+	"goRedis/lib/utils"
 	"goRedis/resp/reply"
+	"strings"
 )
 
 // Del atomically removes given writeKeys from cluster, writeKeys can be distributed on any node
 // if the given writeKeys are distributed on different node, Del will use try-commit-catch to remove them
 func Del(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
-	replies := cluster.broadcast(c, args)
-	var errReply reply.ErrorReply
-	var deleted int64 = 0
-	for _, v := range replies {
-		if reply.IsErrorReply(v) {
-			errReply = v.(reply.ErrorReply)
-			break
+	if len(args) < 2 {
+		return reply.MakeArgNumErrReply("del")
+	}
+	keys := make([]string, len(args)-1)
+	for i := 1; i < len(args); i++ {
+		keys[i-1] = string(args[i])
+	}
+	groupMap := cluster.groupBy(keys)
+	if len(groupMap) == 1 { // all keys are on one node, no need of transaction
+		for peer, group := range groupMap {
+			return cluster.relay(peer, c, utils.ToCmdLine2("DEL", group...))
 		}
+	}
+	txID := cluster.nextTxID()
+	nodeCmdLines := make(map[string]CmdLine, len(groupMap))
+	for peer, group := range groupMap {
+		nodeCmdLines[peer] = utils.ToCmdLine2("Prepare", append([]string{txID, "DEL"}, group...)...)
+	}
+	respMap, errReply := cluster.doTransaction(c, txID, nodeCmdLines)
+	if errReply != nil {
+		return reply.MakeErrReply("error occurs: " + errReply.Error())
+	}
+	var deleted int64 = 0
+	for _, v := range respMap {
 		intReply, ok := v.(*reply.IntReply)
 		if !ok {
-			errReply = reply.MakeErrReply("error")
+			return reply.MakeErrReply("error occurs: unexpected reply " + string(v.ToBytes()))
 		}
 		deleted += intReply.Code
 	}
+	return reply.MakeIntReply(deleted)
+}
 
-	if errReply == nil {
-		return reply.MakeIntReply(deleted)
+// MSet atomically sets multi key-value in cluster, writeKeys can be distributed on any node
+func MSet(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	argCount := len(args) - 1
+	if argCount%2 != 0 || argCount < 1 {
+		return reply.MakeArgNumErrReply("mset")
 	}
-	return reply.MakeErrReply("error occurs: " + errReply.Error())
+
+	size := argCount / 2
+	groupMap := make(map[string][][]byte)
+	for i := 0; i < size; i++ {
+		key := args[2*i+1]
+		value := args[2*i+2]
+		peer := cluster.peerPicker.PickNode(string(key))
+		groupMap[peer] = append(groupMap[peer], key, value)
+	}
+	if len(groupMap) == 1 { // all keys are on one node, no need of transaction
+		for peer, group := range groupMap {
+			return cluster.relay(peer, c, utils.ToCmdLine3("MSET", group...))
+		}
+	}
+	txID := cluster.nextTxID()
+	nodeCmdLines := make(map[string]CmdLine, len(groupMap))
+	for peer, group := range groupMap {
+		nodeCmdLines[peer] = utils.ToCmdLine3("Prepare", append([][]byte{[]byte(txID), []byte("MSET")}, group...)...)
+	}
+	_, errReply := cluster.doTransaction(c, txID, nodeCmdLines)
+	if errReply != nil {
+		return reply.MakeErrReply("error occurs: " + errReply.Error())
+	}
+	return &reply.OkReply{}
+}
+
+// MSetNX sets multi key-value in cluster only if none of the given keys exist
+// if the given keys are distributed on different node, MSetNX will use try-commit-catch to set them
+func MSetNX(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	argCount := len(args) - 1
+	if argCount%2 != 0 || argCount < 1 {
+		return reply.MakeArgNumErrReply("msetnx")
+	}
+
+	size := argCount / 2
+	groupMap := make(map[string][][]byte)
+	for i := 0; i < size; i++ {
+		key := args[2*i+1]
+		value := args[2*i+2]
+		peer := cluster.peerPicker.PickNode(string(key))
+		groupMap[peer] = append(groupMap[peer], key, value)
+	}
+	if len(groupMap) == 1 { // all keys are on one node, no need of transaction
+		for peer, group := range groupMap {
+			return cluster.relay(peer, c, utils.ToCmdLine3("MSETNX", group...))
+		}
+	}
+	txID := cluster.nextTxID()
+	nodes := make([]string, 0, len(groupMap))
+	nodeCmdLines := make(map[string]CmdLine, len(groupMap))
+	for peer, group := range groupMap {
+		nodes = append(nodes, peer)
+		nodeCmdLines[peer] = utils.ToCmdLine3("Prepare", append([][]byte{[]byte(txID), []byte("MSETNX")}, group...)...)
+	}
+	// every node returns whether its keys exist when prepare
+	respMap, errReply := requestPrepare(cluster, c, nodeCmdLines)
+	if errReply != nil {
+		requestRollback(cluster, c, txID, nodes)
+		return reply.MakeErrReply("error occurs: " + errReply.Error())
+	}
+	for _, v := range respMap {
+		if existed, ok := v.(*reply.IntReply); ok && existed.Code == 1 {
+			requestRollback(cluster, c, txID, nodes)
+			return reply.MakeIntReply(0)
+		}
+	}
+	_, errReply = requestCommit(cluster, c, txID, nodes)
+	if errReply != nil {
+		return reply.MakeErrReply("error occurs: " + errReply.Error())
+	}
+	return reply.MakeIntReply(1)
+}
+
+// MGet atomically gets multi key-value from cluster
+// keys are grouped by node and every node receives one batched MGET, replies are reassembled in the original order
+func MGet(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) < 2 {
+		return reply.MakeArgNumErrReply("mget")
+	}
+	keys := make([]string, len(args)-1)
+	for i := 1; i < len(args); i++ {
+		keys[i-1] = string(args[i])
+	}
+	groupMap := cluster.groupBy(keys)
+	if len(groupMap) == 1 {
+		for peer := range groupMap {
+			return cluster.relay(peer, c, args)
+		}
+	}
+
+	// send batched requests concurrently
+	nodeCmdLines := make(map[string]CmdLine, len(groupMap))
+	for peer, group := range groupMap {
+		nodeCmdLines[peer] = utils.ToCmdLine2("MGET", group...)
+	}
+	respMap := cluster.relayGroups(c, nodeCmdLines)
+
+	// key -> value, duplicated keys have the same value
+	values := make(map[string][]byte, len(keys))
+	for peer, group := range groupMap {
+		re := respMap[peer]
+		if reply.IsErrorReply(re) {
+			return re
+		}
+		arrReply, ok := re.(*reply.MultiBulkReply)
+		if !ok || len(arrReply.Args) != len(group) {
+			return reply.MakeErrReply("error occurs: unexpected reply of node " + peer)
+		}
+		for i, key := range group {
+			values[key] = arrReply.Args[i]
+		}
+	}
+	result := make([][]byte, len(keys))
+	for i, key := range keys {
+		result[i] = values[key]
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// Exists returns the number of existing keys, keys can be distributed on any node
+func Exists(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) < 2 {
+		return reply.MakeArgNumErrReply("exists")
+	}
+	keys := make([]string, len(args)-1)
+	for i := 1; i < len(args); i++ {
+		keys[i-1] = string(args[i])
+	}
+	groupMap := cluster.groupBy(keys)
+	if len(groupMap) == 1 {
+		for peer := range groupMap {
+			return cluster.relay(peer, c, args)
+		}
+	}
+	nodeCmdLines := make(map[string]CmdLine, len(groupMap))
+	for peer, group := range groupMap {
+		nodeCmdLines[peer] = utils.ToCmdLine2("EXISTS", group...)
+	}
+	return sumIntReplies(cluster.relayGroups(c, nodeCmdLines))
+}
+
+// DBSize returns the number of keys in current database of all nodes
+func DBSize(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	return sumIntReplies(cluster.broadcast(c, args))
+}
+
+// Keys returns keys matching pattern on all nodes
+func Keys(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) != 2 {
+		return reply.MakeArgNumErrReply("keys")
+	}
+	result := make([][]byte, 0)
+	for node, re := range cluster.broadcast(c, args) {
+		switch re := re.(type) {
+		case *reply.MultiBulkReply:
+			result = append(result, re.Args...)
+		case *reply.EmptyMultiBulkReply:
+		default:
+			if reply.IsErrorReply(re) {
+				return reply.MakeErrReply("error occurs: " + re.(reply.ErrorReply).Error())
+			}
+			return reply.MakeErrReply("error occurs: unexpected reply of node " + node)
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// Publish sends message to subscribers on all nodes, returns the number of receivers
+func Publish(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) != 3 {
+		return reply.MakeArgNumErrReply("publish")
+	}
+	if errReply := database.CheckChannelPermission(c, []string{string(args[1])}); errReply != nil {
+		return errReply
+	}
+	return sumIntReplies(cluster.broadcast(c, args))
+}
+
+// sumIntReplies sums int replies of nodes, returns the first error reply if any
+func sumIntReplies(replies map[string]resp.Reply) resp.Reply {
+	var sum int64 = 0
+	for _, v := range replies {
+		if reply.IsErrorReply(v) {
+			return reply.MakeErrReply("error occurs: " + v.(reply.ErrorReply).Error())
+		}
+		intReply, ok := v.(*reply.IntReply)
+		if !ok {
+			return reply.MakeErrReply("error occurs: unexpected reply " + string(v.ToBytes()))
+		}
+		sum += intReply.Code
+	}
+	return reply.MakeIntReply(sum)
 }
 
 // FlushDB removes all data in current database
@@ -49,21 +264,57 @@ func ping(cluster *ClusterDatabase, c resp.Connection, cmdAndArgs [][]byte) resp
 	return cluster.db.Exec(c, cmdAndArgs)
 }
 
-// Rename renames a key, the origin and the destination must within the same node
+// Rename renames a key, the origin and the destination can be distributed on different node
+// if they are distributed on different node, Rename will use try-commit-catch to move the key
 func Rename(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
 	if len(args) != 3 {
-		return reply.MakeErrReply("ERR wrong number of arguments for 'rename' command")
+		return reply.MakeArgNumErrReply(string(args[0]))
 	}
+	cmdName := strings.ToLower(string(args[0]))
 	src := string(args[1])
 	dest := string(args[2])
 
 	srcPeer := cluster.peerPicker.PickNode(src)
 	destPeer := cluster.peerPicker.PickNode(dest)
 
-	if srcPeer != destPeer {
-		return reply.MakeErrReply("ERR rename must within one slot in cluster mode")
+	if srcPeer == destPeer {
+		return cluster.relay(srcPeer, c, args)
+	}
+	nodes := []string{srcPeer, destPeer}
+	txID := cluster.nextTxID()
+	// prepare source node, it returns the command line to rebuild the key
+	srcReply := cluster.relayTCC(srcPeer, c, utils.ToCmdLine("Prepare", txID, "RenameFrom", src))
+	if reply.IsErrorReply(srcReply) {
+		requestRollback(cluster, c, txID, nodes)
+		return srcReply
+	}
+	rebuild, ok := srcReply.(*reply.MultiBulkReply)
+	if !ok || len(rebuild.Args) < 2 {
+		requestRollback(cluster, c, txID, nodes)
+		return reply.MakeErrReply("error occurs: unexpected reply " + string(srcReply.ToBytes()))
+	}
+	// prepare destination node, it returns whether the destination key exists
+	destArgs := [][]byte{[]byte("Prepare"), []byte(txID), []byte("RenameTo"), []byte(dest), rebuild.Args[0]}
+	destArgs = append(destArgs, rebuild.Args[2:]...) // skip the source key
+	destReply := cluster.relayTCC(destPeer, c, destArgs)
+	if reply.IsErrorReply(destReply) {
+		requestRollback(cluster, c, txID, nodes)
+		return destReply
+	}
+	if cmdName == "renamenx" {
+		if existed, ok := destReply.(*reply.IntReply); ok && existed.Code == 1 {
+			requestRollback(cluster, c, txID, nodes)
+			return reply.MakeIntReply(0)
+		}
+	}
+	_, errReply := requestCommit(cluster, c, txID, nodes)
+	if errReply != nil {
+		return reply.MakeErrReply("error occurs: " + errReply.Error())
+	}
+	if cmdName == "renamenx" {
+		return reply.MakeIntReply(1)
 	}
-	return cluster.relay(srcPeer, c, args)
+	return &reply.OkReply{}
 }
 
 func execSelect(cluster *ClusterDatabase, c resp.Connection, cmdAndArgs [][]byte) resp.Reply {
@@ -1,34 +1,76 @@
 package cluster
 
-import "goRedis/interface/resp"
+import (
+	"goRedis/database"
+	"goRedis/interface/resp"
+	"goRedis/resp/reply"
+)
 
 // CmdLine is alias for [][]byte, represents a command line
 type CmdLine = [][]byte
 
+// makeRouter registers commands which need special handling in cluster mode,
+// other commands of database are routed by defaultFunc according to their key positions
 func makeRouter() map[string]CmdFunc {
 	routerMap := make(map[string]CmdFunc)
+	for _, name := range database.ListCommands() {
+		routerMap[name] = defaultFunc
+	}
+
 	routerMap["ping"] = ping
+	routerMap["info"] = Info
+	routerMap["select"] = execSelect
+	routerMap["memory"] = Memory
 
+	// multi-key commands, keys may be distributed on different nodes
 	routerMap["del"] = Del
-
-	routerMap["exists"] = defaultFunc
-	routerMap["type"] = defaultFunc
+	routerMap["exists"] = Exists
 	routerMap["rename"] = Rename
 	routerMap["renamenx"] = Rename
+	routerMap["mset"] = MSet
+	routerMap["msetnx"] = MSetNX
+	routerMap["mget"] = MGet
 
-	routerMap["set"] = defaultFunc
-	routerMap["setnx"] = defaultFunc
-	routerMap["get"] = defaultFunc
-	routerMap["getset"] = defaultFunc
-
+	// keyless commands which are executed on all nodes
 	routerMap["flushdb"] = FlushDB
+	routerMap["dbsize"] = DBSize
+	routerMap["keys"] = Keys
+	routerMap["publish"] = Publish
+
+	// internal commands below are only accepted from peers, see isPeerConn
+	// executes command on local node, sent by broadcast
+	routerMap["local"] = execLocal
+
+	// try-commit-catch distributed transaction, sent by coordinator
+	routerMap["prepare"] = execPrepare
+	routerMap["preparemulti"] = execPrepareMulti
+	routerMap["commit"] = execCommit
+	routerMap["rollback"] = execRollback
 
 	return routerMap
 }
 
-// relay command to responsible peer, and return its reply to client
+// defaultFunc relays command to the node which holds its keys, and return its reply to client
+// keyless command is executed on local node
 func defaultFunc(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
-	key := string(args[1])
-	peer := cluster.peerPicker.PickNode(key)
+	keys, _ := database.GetCommandKeys(args)
+	if len(keys) == 0 {
+		return cluster.db.Exec(c, args)
+	}
+	peer := cluster.peerPicker.PickNode(keys[0])
+	for _, key := range keys[1:] {
+		if cluster.peerPicker.PickNode(key) != peer {
+			return reply.MakeErrReply("CROSSSLOT Keys in request don't hash to the same node")
+		}
+	}
 	return cluster.relay(peer, c, args)
 }
+
+// execLocal executes the wrapped command on local node
+// cmdLine: Local cmdName args...
+func execLocal(cluster *ClusterDatabase, c resp.Connection, cmdLine [][]byte) resp.Reply {
+	if len(cmdLine) < 2 {
+		return reply.MakeArgNumErrReply("local")
+	}
+	return cluster.db.Exec(c, cmdLine[1:])
+}
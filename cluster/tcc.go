@@ -0,0 +1,416 @@
+package cluster
+
+import (
+	"fmt"
+	"goRedis/aof"
+	"goRedis/database"
+	"goRedis/interface/resp"
+	"goRedis/lib/logger"
+	"goRedis/lib/utils"
+	"goRedis/resp/parser"
+	"goRedis/resp/reply"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * try-commit-catch distributed transaction
+ * coordinator: the node which receives the client command, it sends Prepare to every related node,
+ *              then sends Commit if all nodes prepared successfully, otherwise sends Rollback
+ * participant: locks related keys and records undo logs when Prepare,
+ *              executes command when Commit, executes undo logs when Rollback
+ */
+
+// Transaction stores state and data for a try-commit-catch distributed transaction
+type Transaction struct {
+	id       string    // transaction id
+	cmdLines []CmdLine // commands to execute when commit
+	multi    bool      // true if the transaction is created by PrepareMulti
+	cluster  *ClusterDatabase
+	dbIndex  int
+
+	writeKeys  []string
+	readKeys   []string
+	keysLocked bool
+	undoLog    [][]CmdLine // undo logs of every command
+
+	status int8
+	mu     *sync.Mutex
+}
+
+const (
+	maxLockTime       = 3 * time.Second
+	waitBeforeCleanTx = 2 * maxLockTime
+
+	createdStatus    = 0
+	preparedStatus   = 1
+	committedStatus  = 2
+	rolledBackStatus = 3
+)
+
+// NewTransaction creates a try-commit-catch distributed transaction
+func NewTransaction(cluster *ClusterDatabase, c resp.Connection, id string, cmdLines []CmdLine, multi bool) *Transaction {
+	return &Transaction{
+		id:       id,
+		cmdLines: cmdLines,
+		multi:    multi,
+		cluster:  cluster,
+		dbIndex:  c.GetDBIndex(),
+		status:   createdStatus,
+		mu:       new(sync.Mutex),
+	}
+}
+
+// lockKeys is reentrant
+// invoker should hold tx.mu
+func (tx *Transaction) lockKeys() {
+	if !tx.keysLocked {
+		tx.cluster.db.RWLocks(tx.dbIndex, tx.writeKeys, tx.readKeys)
+		tx.keysLocked = true
+	}
+}
+
+func (tx *Transaction) unLockKeys() {
+	if tx.keysLocked {
+		tx.cluster.db.RWUnLocks(tx.dbIndex, tx.writeKeys, tx.readKeys)
+		tx.keysLocked = false
+	}
+}
+
+// prepare locks related keys and records undo logs
+func (tx *Transaction) prepare() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	for _, cmdLine := range tx.cmdLines {
+		write, read := database.GetRelatedKeys(cmdLine)
+		tx.writeKeys = append(tx.writeKeys, write...)
+		tx.readKeys = append(tx.readKeys, read...)
+	}
+	// lock keys
+	tx.lockKeys()
+
+	// build undoLog
+	// every undo log restores its keys to the state before prepare, so they are all valid however they are ordered
+	for _, cmdLine := range tx.cmdLines {
+		tx.undoLog = append(tx.undoLog, tx.cluster.db.GetUndoLogs(tx.dbIndex, cmdLine))
+	}
+	tx.status = preparedStatus
+	time.AfterFunc(maxLockTime, func() {
+		tx.mu.Lock()
+		defer tx.mu.Unlock()
+		if tx.status == preparedStatus { // rollback transaction uncommitted until expire
+			logger.Info("abort transaction: " + tx.id)
+			tx.rollbackWithLock()
+		}
+	})
+}
+
+// rollbackWithLock executes undo logs, invoker should hold tx.mu
+func (tx *Transaction) rollbackWithLock() {
+	if tx.status == rolledBackStatus { // no need to rollback a rolled-back transaction
+		return
+	}
+	tx.lockKeys()
+	for i := len(tx.undoLog) - 1; i >= 0; i-- {
+		for _, cmdLine := range tx.undoLog[i] {
+			tx.cluster.db.ExecWithLock(tx.dbIndex, cmdLine)
+		}
+	}
+	tx.unLockKeys()
+	tx.status = rolledBackStatus
+}
+
+// commitWithLock executes commands of transaction, invoker should hold tx.mu
+func (tx *Transaction) commitWithLock() resp.Reply {
+	results := make([][]byte, 0, len(tx.cmdLines))
+	var result resp.Reply
+	for _, cmdLine := range tx.cmdLines {
+		result = tx.cluster.db.ExecWithLock(tx.dbIndex, cmdLine)
+		if reply.IsErrorReply(result) {
+			tx.rollbackWithLock()
+			return reply.MakeErrReply(fmt.Sprintf("transaction %s rolled back since '%s' failed, origin err: %s",
+				tx.id, strings.ToLower(string(cmdLine[0])), result.(reply.ErrorReply).Error()))
+		}
+		results = append(results, result.ToBytes())
+	}
+	tx.unLockKeys()
+	tx.status = committedStatus
+	if tx.multi {
+		// the reply of every command is encoded as a bulk string, coordinator decodes them by parser.ParseBytes
+		return reply.MakeMultiBulkReply(results)
+	}
+	return result
+}
+
+func (cluster *ClusterDatabase) getTransaction(txID string) (*Transaction, bool) {
+	cluster.transactionMu.RLock()
+	defer cluster.transactionMu.RUnlock()
+	raw, ok := cluster.transactions.Get(txID)
+	if !ok {
+		return nil, false
+	}
+	tx, _ := raw.(*Transaction)
+	return tx, true
+}
+
+// cleanTransaction removes finished transaction later, in case of rollback after commit
+func (cluster *ClusterDatabase) cleanTransaction(txID string) {
+	time.AfterFunc(waitBeforeCleanTx, func() {
+		cluster.transactionMu.Lock()
+		cluster.transactions.Remove(txID)
+		cluster.transactionMu.Unlock()
+	})
+}
+
+func (cluster *ClusterDatabase) startTransaction(c resp.Connection, txID string, cmdLines []CmdLine, multi bool) *Transaction {
+	tx := NewTransaction(cluster, c, txID, cmdLines, multi)
+	cluster.transactionMu.Lock()
+	cluster.transactions.Put(txID, tx)
+	cluster.transactionMu.Unlock()
+	tx.prepare()
+	return tx
+}
+
+// execPrepare prepares a local transaction as a participant
+// cmdLine: Prepare txID cmdName args...
+func execPrepare(cluster *ClusterDatabase, c resp.Connection, cmdLine CmdLine) resp.Reply {
+	if len(cmdLine) < 3 {
+		return reply.MakeArgNumErrReply("prepare")
+	}
+	txID := string(cmdLine[1])
+	cmdName := strings.ToLower(string(cmdLine[2]))
+	// the wrapped command is executed by ExecWithLock on commit, which doesn't check key permissions
+	if errReply := database.CheckPermission(c, cmdLine[2:]); errReply != nil {
+		return errReply
+	}
+	tx := cluster.startTransaction(c, txID, []CmdLine{cmdLine[2:]}, false)
+	prepareFunc, ok := prepareFuncMap[cmdName]
+	if ok {
+		// validate under the protection of key locks, a failed transaction is rolled back by coordinator
+		return prepareFunc(cluster, tx, cmdLine[2:])
+	}
+	return &reply.OkReply{}
+}
+
+// execPrepareMulti prepares a local transaction consisting of several commands as a participant
+// cmdLine: PrepareMulti txID encodedCmdLine..., every command line is encoded as resp multi bulk
+func execPrepareMulti(cluster *ClusterDatabase, c resp.Connection, cmdLine CmdLine) resp.Reply {
+	if len(cmdLine) < 3 {
+		return reply.MakeArgNumErrReply("preparemulti")
+	}
+	txID := string(cmdLine[1])
+	cmdLines := make([]CmdLine, 0, len(cmdLine)-2)
+	for _, raw := range cmdLine[2:] {
+		cmdLine, err := decodeCmdLine(raw)
+		if err != nil {
+			return reply.MakeErrReply("ERR " + err.Error())
+		}
+		if errReply := database.CheckPermission(c, cmdLine); errReply != nil {
+			return errReply
+		}
+		cmdLines = append(cmdLines, cmdLine)
+	}
+	cluster.startTransaction(c, txID, cmdLines, true)
+	return &reply.OkReply{}
+}
+
+// execRollback rollbacks local transaction
+func execRollback(cluster *ClusterDatabase, c resp.Connection, cmdLine CmdLine) resp.Reply {
+	if len(cmdLine) != 2 {
+		return reply.MakeArgNumErrReply("rollback")
+	}
+	txID := string(cmdLine[1])
+	tx, ok := cluster.getTransaction(txID)
+	if !ok {
+		return reply.MakeIntReply(0)
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.rollbackWithLock()
+	cluster.cleanTransaction(txID)
+	return reply.MakeIntReply(1)
+}
+
+// execCommit commits local transaction as a participant when receive Commit command from coordinator
+func execCommit(cluster *ClusterDatabase, c resp.Connection, cmdLine CmdLine) resp.Reply {
+	if len(cmdLine) != 2 {
+		return reply.MakeArgNumErrReply("commit")
+	}
+	txID := string(cmdLine[1])
+	tx, ok := cluster.getTransaction(txID)
+	if !ok {
+		return reply.MakeErrReply("ERR transaction " + txID + " not found")
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.status != preparedStatus {
+		return reply.MakeErrReply("ERR transaction " + txID + " is not prepared")
+	}
+	result := tx.commitWithLock()
+	cluster.cleanTransaction(txID)
+	return result
+}
+
+// relayTCC sends a transaction command to the given node,
+// Prepare, Commit and Rollback of self node is executed directly because relay can't route them to self
+func (cluster *ClusterDatabase) relayTCC(peer string, c resp.Connection, args [][]byte) resp.Reply {
+	if peer != cluster.self {
+		return cluster.relay(peer, c, args)
+	}
+	switch strings.ToLower(string(args[0])) {
+	case "prepare":
+		return execPrepare(cluster, c, args)
+	case "preparemulti":
+		return execPrepareMulti(cluster, c, args)
+	case "commit":
+		return execCommit(cluster, c, args)
+	case "rollback":
+		return execRollback(cluster, c, args)
+	}
+	return cluster.relay(peer, c, args)
+}
+
+// requestPrepare sends Prepare to all related node as coordinator
+// nodeCmdLines: node -> command line to prepare on it, the command line begins with Prepare or PrepareMulti
+// nodes are prepared in sorted order like shard locks, otherwise two coordinators may lock keys on the same nodes
+// in opposite orders and wait for each other until the transactions are rolled back by timeout
+func requestPrepare(cluster *ClusterDatabase, c resp.Connection, nodeCmdLines map[string]CmdLine) (map[string]resp.Reply, reply.ErrorReply) {
+	respMap := make(map[string]resp.Reply, len(nodeCmdLines))
+	for _, node := range sortedNodes(nodeCmdLines) {
+		re := cluster.relayTCC(node, c, nodeCmdLines[node])
+		respMap[node] = re
+		if reply.IsErrorReply(re) {
+			return respMap, toErrReply(re)
+		}
+	}
+	return respMap, nil
+}
+
+// requestCommit commands all node to commit transaction as coordinator
+func requestCommit(cluster *ClusterDatabase, c resp.Connection, txID string, nodes []string) (map[string]resp.Reply, reply.ErrorReply) {
+	var errReply reply.ErrorReply
+	respMap := make(map[string]resp.Reply, len(nodes))
+	for _, node := range nodes {
+		re := cluster.relayTCC(node, c, utils.ToCmdLine("Commit", txID))
+		if reply.IsErrorReply(re) {
+			errReply = toErrReply(re)
+			break
+		}
+		respMap[node] = re
+	}
+	if errReply != nil {
+		requestRollback(cluster, c, txID, nodes)
+		return nil, errReply
+	}
+	return respMap, nil
+}
+
+// requestRollback requests all node rollback transaction as coordinator
+func requestRollback(cluster *ClusterDatabase, c resp.Connection, txID string, nodes []string) {
+	for _, node := range nodes {
+		cluster.relayTCC(node, c, utils.ToCmdLine("Rollback", txID))
+	}
+}
+
+// doTransaction prepares the given command lines on related nodes, then commits them or rollbacks all of them
+// returns replies of Commit grouped by node
+func (cluster *ClusterDatabase) doTransaction(c resp.Connection, txID string, nodeCmdLines map[string]CmdLine) (map[string]resp.Reply, reply.ErrorReply) {
+	nodes := sortedNodes(nodeCmdLines)
+	_, errReply := requestPrepare(cluster, c, nodeCmdLines)
+	if errReply != nil {
+		requestRollback(cluster, c, txID, nodes)
+		return nil, errReply
+	}
+	return requestCommit(cluster, c, txID, nodes)
+}
+
+// sortedNodes returns nodes of nodeCmdLines in ascending order
+func sortedNodes(nodeCmdLines map[string]CmdLine) []string {
+	nodes := make([]string, 0, len(nodeCmdLines))
+	for node := range nodeCmdLines {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// nextTxID returns an unique transaction id within the cluster
+func (cluster *ClusterDatabase) nextTxID() string {
+	id := atomic.AddInt64(&cluster.txCounter, 1)
+	return cluster.self + "-" + strconv.FormatInt(id, 10)
+}
+
+func toErrReply(re resp.Reply) reply.ErrorReply {
+	if errReply, ok := re.(reply.ErrorReply); ok {
+		return errReply
+	}
+	return reply.MakeErrReply(string(re.ToBytes()))
+}
+
+func encodeCmdLine(cmdLine CmdLine) []byte {
+	return reply.MakeMultiBulkReply(cmdLine).ToBytes()
+}
+
+func decodeCmdLine(raw []byte) (CmdLine, error) {
+	replies, err := parser.ParseBytes(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(replies) != 1 {
+		return nil, fmt.Errorf("illegal command line: %q", raw)
+	}
+	mbr, ok := replies[0].(*reply.MultiBulkReply)
+	if !ok {
+		return nil, fmt.Errorf("illegal command line: %q", raw)
+	}
+	return mbr.Args, nil
+}
+
+/* ---- prepare functions, validate command when prepare, invoker holds the locks of related keys ---- */
+
+// prepareFunc validates command when prepare, an error reply aborts the transaction
+// other replies are returned to coordinator as the result of Prepare
+type prepareFunc func(cluster *ClusterDatabase, tx *Transaction, cmdLine CmdLine) resp.Reply
+
+var prepareFuncMap = map[string]prepareFunc{
+	"renamefrom": prepareRenameFrom,
+	"renameto":   prepareRenameTo,
+	"msetnx":     prepareMSetNX,
+}
+
+// prepareRenameFrom checks the source key exists and returns the command line to rebuild it
+func prepareRenameFrom(cluster *ClusterDatabase, tx *Transaction, cmdLine CmdLine) resp.Reply {
+	key := string(cmdLine[1])
+	entity, ok := cluster.db.GetEntity(tx.dbIndex, key)
+	if !ok {
+		return reply.MakeErrReply("ERR no such key")
+	}
+	return aof.EntityToCmd(key, entity)
+}
+
+// prepareRenameTo returns whether the destination key exists, renamenx aborts the transaction if it does
+func prepareRenameTo(cluster *ClusterDatabase, tx *Transaction, cmdLine CmdLine) resp.Reply {
+	key := string(cmdLine[1])
+	if _, ok := cluster.db.GetEntity(tx.dbIndex, key); ok {
+		return reply.MakeIntReply(1)
+	}
+	return reply.MakeIntReply(0)
+}
+
+// prepareMSetNX returns whether any of the given keys exists, msetnx aborts the transaction if it does
+func prepareMSetNX(cluster *ClusterDatabase, tx *Transaction, cmdLine CmdLine) resp.Reply {
+	for i := 1; i < len(cmdLine); i += 2 {
+		key := string(cmdLine[i])
+		if _, ok := cluster.db.GetEntity(tx.dbIndex, key); ok {
+			return reply.MakeIntReply(1)
+		}
+	}
+	return reply.MakeIntReply(0)
+}
@@ -0,0 +1,249 @@
+package cluster
+
+import (
+	"goRedis/lib/utils"
+	"goRedis/resp/connection"
+	"goRedis/resp/reply"
+	"net"
+	"testing"
+	"time"
+)
+
+func makeTestCluster(t *testing.T) *ClusterDatabase {
+	cluster := MakeClusterDatabase()
+	t.Cleanup(cluster.Close)
+	return cluster
+}
+
+// execTest executes command on the local database of cluster and returns the reply in resp format
+func execTest(cluster *ClusterDatabase, args ...string) string {
+	return string(cluster.db.Exec(&connection.FakeConn{}, utils.ToCmdLine(args...)).ToBytes())
+}
+
+// assertValues checks values of keys, empty value means the key doesn't exist
+func assertValues(t *testing.T, cluster *ClusterDatabase, values map[string]string) {
+	t.Helper()
+	for key, value := range values {
+		expected := string(reply.MakeBulkReply([]byte(value)).ToBytes())
+		if value == "" {
+			expected = string(reply.MakeNullBulkReply().ToBytes())
+		}
+		if actual := execTest(cluster, "GET", key); actual != expected {
+			t.Errorf("%s: expected %q, got %q", key, expected, actual)
+		}
+	}
+}
+
+func TestTccCommitAndRollback(t *testing.T) {
+	tests := []struct {
+		name      string
+		setup     [][]string        // commands executed before transaction
+		cmdLine   []string          // command to prepare
+		committed map[string]string // values after commit
+	}{
+		{
+			name:      "del",
+			setup:     [][]string{{"SET", "a", "1"}},
+			cmdLine:   []string{"DEL", "a", "b"},
+			committed: map[string]string{"a": "", "b": ""},
+		},
+		{
+			name:      "mset",
+			setup:     [][]string{{"SET", "a", "1"}},
+			cmdLine:   []string{"MSET", "a", "2", "b", "3"},
+			committed: map[string]string{"a": "2", "b": "3"},
+		},
+		{
+			name:      "msetnx",
+			cmdLine:   []string{"MSETNX", "a", "2", "b", "3"},
+			committed: map[string]string{"a": "2", "b": "3"},
+		},
+		{
+			name:      "rename from",
+			setup:     [][]string{{"SET", "a", "1"}},
+			cmdLine:   []string{"RenameFrom", "a"},
+			committed: map[string]string{"a": ""},
+		},
+		{
+			name:      "rename to",
+			setup:     [][]string{{"SET", "b", "1"}},
+			cmdLine:   []string{"RenameTo", "b", "SET", "2"},
+			committed: map[string]string{"b": "2"},
+		},
+	}
+	for _, tt := range tests {
+		for _, commitFirst := range []bool{true, false} {
+			name := tt.name + " rollback after prepare"
+			if commitFirst {
+				name = tt.name + " rollback after commit"
+			}
+			t.Run(name, func(t *testing.T) {
+				cluster := makeTestCluster(t)
+				conn := &connection.FakeConn{}
+				for _, cmdLine := range tt.setup {
+					execTest(cluster, cmdLine...)
+				}
+				// the original values of all keys touched by the command
+				origin := make(map[string]string)
+				for key := range tt.committed {
+					result := cluster.db.Exec(conn, utils.ToCmdLine("GET", key))
+					if bulk, ok := result.(*reply.BulkReply); ok {
+						origin[key] = string(bulk.Arg)
+					} else {
+						origin[key] = ""
+					}
+				}
+				txID := cluster.nextTxID()
+				prepareLine := utils.ToCmdLine(append([]string{"Prepare", txID}, tt.cmdLine...)...)
+				if result := execPrepare(cluster, conn, prepareLine); reply.IsErrorReply(result) {
+					t.Fatalf("prepare failed: %q", result.ToBytes())
+				}
+				if commitFirst {
+					if result := execCommit(cluster, conn, utils.ToCmdLine("Commit", txID)); reply.IsErrorReply(result) {
+						t.Fatalf("commit failed: %q", result.ToBytes())
+					}
+					assertValues(t, cluster, tt.committed)
+				}
+				if result := execRollback(cluster, conn, utils.ToCmdLine("Rollback", txID)); string(result.ToBytes()) != ":1\r\n" {
+					t.Fatalf("rollback failed: %q", result.ToBytes())
+				}
+				assertValues(t, cluster, origin)
+			})
+		}
+	}
+}
+
+func TestTccPrepareMulti(t *testing.T) {
+	cluster := makeTestCluster(t)
+	conn := &connection.FakeConn{}
+	execTest(cluster, "SET", "a", "1")
+	execTest(cluster, "SET", "b", "2")
+	prepareMulti := func(txID string) {
+		cmdLine := utils.ToCmdLine("PrepareMulti", txID)
+		cmdLine = append(cmdLine,
+			encodeCmdLine(utils.ToCmdLine("SET", "a", "10")),
+			encodeCmdLine(utils.ToCmdLine("DEL", "b")),
+			encodeCmdLine(utils.ToCmdLine("MSET", "a", "20", "c", "30")),
+			encodeCmdLine(utils.ToCmdLine("GET", "a")),
+		)
+		if result := execPrepareMulti(cluster, conn, cmdLine); reply.IsErrorReply(result) {
+			t.Fatalf("prepare failed: %q", result.ToBytes())
+		}
+	}
+
+	// undo logs of all commands restore values before prepare, even if a key is written by several commands
+	txID := cluster.nextTxID()
+	prepareMulti(txID)
+	execCommit(cluster, conn, utils.ToCmdLine("Commit", txID))
+	assertValues(t, cluster, map[string]string{"a": "20", "b": "", "c": "30"})
+	execRollback(cluster, conn, utils.ToCmdLine("Rollback", txID))
+	assertValues(t, cluster, map[string]string{"a": "1", "b": "2", "c": ""})
+
+	// replies of commands are encoded as bulk strings
+	txID = cluster.nextTxID()
+	prepareMulti(txID)
+	result := execCommit(cluster, conn, utils.ToCmdLine("Commit", txID))
+	mbr, ok := result.(*reply.MultiBulkReply)
+	if !ok || len(mbr.Args) != 4 {
+		t.Fatalf("unexpected reply of commit: %q", result.ToBytes())
+	}
+	expected := []string{"+OK\r\n", ":1\r\n", "+OK\r\n", "$2\r\n20\r\n"}
+	for i, arg := range mbr.Args {
+		if string(arg) != expected[i] {
+			t.Errorf("reply %d: expected %q, got %q", i, expected[i], arg)
+		}
+	}
+}
+
+func TestTccPrepareValidation(t *testing.T) {
+	cluster := makeTestCluster(t)
+	conn := &connection.FakeConn{}
+	execTest(cluster, "SET", "a", "1")
+
+	result := execPrepare(cluster, conn, utils.ToCmdLine("Prepare", cluster.nextTxID(), "RenameFrom", "missing"))
+	if !reply.IsErrorReply(result) {
+		t.Fatalf("renaming missing key should fail, got %q", result.ToBytes())
+	}
+	txID := cluster.nextTxID()
+	result = execPrepare(cluster, conn, utils.ToCmdLine("Prepare", txID, "MSETNX", "b", "2", "a", "2"))
+	if string(result.ToBytes()) != ":1\r\n" {
+		t.Fatalf("msetnx should report existing key, got %q", result.ToBytes())
+	}
+	execRollback(cluster, conn, utils.ToCmdLine("Rollback", txID))
+
+	result = execCommit(cluster, conn, utils.ToCmdLine("Commit", "unknown"))
+	if !reply.IsErrorReply(result) {
+		t.Fatalf("committing unknown transaction should fail, got %q", result.ToBytes())
+	}
+	if result = execRollback(cluster, conn, utils.ToCmdLine("Rollback", "unknown")); string(result.ToBytes()) != ":0\r\n" {
+		t.Fatalf("unexpected reply of rolling back unknown transaction: %q", result.ToBytes())
+	}
+}
+
+// TestTccTimeout checks that a transaction not committed in maxLockTime is rolled back and releases its keys
+func TestTccTimeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for maxLockTime")
+	}
+	cluster := makeTestCluster(t)
+	conn := &connection.FakeConn{}
+	execTest(cluster, "SET", "a", "1")
+	txID := cluster.nextTxID()
+	execPrepare(cluster, conn, utils.ToCmdLine("Prepare", txID, "DEL", "a"))
+
+	done := make(chan string, 1)
+	go func() {
+		done <- execTest(cluster, "SET", "a", "2")
+	}()
+	select {
+	case <-done:
+		t.Fatal("key should be locked by prepared transaction")
+	case <-time.After(maxLockTime / 2):
+	}
+	select {
+	case <-done:
+	case <-time.After(maxLockTime):
+		t.Fatal("key is still locked after maxLockTime")
+	}
+	assertValues(t, cluster, map[string]string{"a": "2"})
+	if result := execCommit(cluster, conn, utils.ToCmdLine("Commit", txID)); !reply.IsErrorReply(result) {
+		t.Fatalf("committing a rolled back transaction should fail, got %q", result.ToBytes())
+	}
+	assertValues(t, cluster, map[string]string{"a": "2"})
+}
+
+// TestTccPrepareCheckPermission checks keys of command lines wrapped by Prepare and PrepareMulti,
+// since they are executed without permission checking on commit
+func TestTccPrepareCheckPermission(t *testing.T) {
+	cluster := makeTestCluster(t)
+	if result := execTest(cluster, "ACL", "SETUSER", "tester", "on", "nopass", "+@all", "~user:*"); result != "+OK\r\n" {
+		t.Fatalf("failed to create user: %q", result)
+	}
+	t.Cleanup(func() {
+		execTest(cluster, "ACL", "DELUSER", "tester")
+	})
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	conn := connection.NewConn(server)
+	conn.SetUser("tester")
+	const noKey = "-NOPERM No permissions to access a key\r\n"
+
+	result := execPrepare(cluster, conn, utils.ToCmdLine("Prepare", cluster.nextTxID(), "DEL", "user:1", "order:1"))
+	if string(result.ToBytes()) != noKey {
+		t.Fatalf("unexpected reply of Prepare: %q", result.ToBytes())
+	}
+	result = execPrepareMulti(cluster, conn, utils.ToCmdLine("PrepareMulti", cluster.nextTxID(),
+		string(encodeCmdLine(utils.ToCmdLine("SET", "user:1", "a"))),
+		string(encodeCmdLine(utils.ToCmdLine("SET", "order:1", "b"))),
+	))
+	if string(result.ToBytes()) != noKey {
+		t.Fatalf("unexpected reply of PrepareMulti: %q", result.ToBytes())
+	}
+	txID := cluster.nextTxID()
+	result = execPrepare(cluster, conn, utils.ToCmdLine("Prepare", txID, "RenameTo", "user:2", "SET", "a"))
+	if reply.IsErrorReply(result) {
+		t.Fatalf("prepare failed: %q", result.ToBytes())
+	}
+	execRollback(cluster, conn, utils.ToCmdLine("Rollback", txID))
+}
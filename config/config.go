@@ -10,6 +10,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,10 +19,14 @@ var (
 	StandaloneMode = "standalone"
 )
 
-// ServerProperties defines global config properties
+// RedisVersion is the version of redis whose protocol and commands are compatible with goRedis
+const RedisVersion = "7.0.0"
+
+// ServerProperties defines global config properties, fields are named by `cfg` tag,
+// fields tagged with omitempty are generated by server, they are neither read from config file nor shown by CONFIG GET
 type ServerProperties struct {
 	// for Public configuration
-	RunID             string `cfg:"runid"` // runID always different at every exec.
+	RunID             string `cfg:"runid,omitempty"` // runID always different at every exec.
 	Bind              string `cfg:"bind"`
 	Port              int    `cfg:"port"`
 	Dir               string `cfg:"dir"`
@@ -31,10 +36,15 @@ type ServerProperties struct {
 	AppendFsync       string `cfg:"appendfsync"`
 	AofUseRdbPreamble bool   `cfg:"aof-use-rdb-preamble"`
 	MaxClients        int    `cfg:"maxclients"`
+	Timeout           int    `cfg:"timeout"`       // close idle clients after seconds, 0 means never
+	TCPKeepAlive      int    `cfg:"tcp-keepalive"` // seconds between TCP keepalive probes, 0 disables keepalive
 	RequirePass       string `cfg:"requirepass"`
 	Databases         int    `cfg:"databases"`
 	RDBFilename       string `cfg:"dbfilename"`
 	MasterAuth        string `cfg:"masterauth"`
+	MasterUser        string `cfg:"masteruser"`
+	AclFile           string `cfg:"aclfile"`
+	ProtoMaxBulkLen   int    `cfg:"proto-max-bulk-len"` // max length of bulk string in requests, 512MB if not set
 	SlaveAnnouncePort int    `cfg:"slave-announce-port"`
 	SlaveAnnounceIP   string `cfg:"slave-announce-ip"`
 	ReplTimeout       int    `cfg:"repl-timeout"`
@@ -43,11 +53,35 @@ type ServerProperties struct {
 	ClusterSeed       string `cfg:"cluster-seed"`
 	ClusterConfigFile string `cfg:"cluster-config-file"`
 
+	// classes of keyspace events published to subscribers, empty disables notifications
+	NotifyKeyspaceEvents string `cfg:"notify-keyspace-events"`
+
+	// memory limit of dataset in bytes, 0 means no limit. units such as 100mb are accepted
+	MaxMemory        int    `cfg:"maxmemory"`
+	MaxMemoryPolicy  string `cfg:"maxmemory-policy"` // noeviction if not set
+	MaxMemorySamples int    `cfg:"maxmemory-samples"`
+	LfuLogFactor     int    `cfg:"lfu-log-factor"`
+	LfuDecayTime     int    `cfg:"lfu-decay-time"` // minutes
+
+	// commands took more than slowlog-log-slower-than microseconds are logged, negative value disables slowlog
+	SlowlogLogSlowerThan int `cfg:"slowlog-log-slower-than"`
+	SlowlogMaxLen        int `cfg:"slowlog-max-len"`
+
 	// for cluster mode configuration
 	ClusterEnabled string   `cfg:"cluster-enabled"` // Not used at present.
 	Peers          []string `cfg:"peers"`
 	Self           string   `cfg:"self"`
 
+	// connection pool and circuit breaker between cluster nodes, durations are in milliseconds
+	PeerPoolMaxActive     int `cfg:"peer-pool-max-active"`
+	PeerPoolMaxIdle       int `cfg:"peer-pool-max-idle"`
+	PeerPoolCheckInterval int `cfg:"peer-pool-check-interval"`
+	PeerBorrowTimeout     int `cfg:"peer-borrow-timeout"`
+	PeerConnectTimeout    int `cfg:"peer-connect-timeout"`
+	PeerTimeout           int `cfg:"peer-timeout"`
+	PeerBreakerThreshold  int `cfg:"peer-breaker-threshold"`
+	PeerBreakerCooldown   int `cfg:"peer-breaker-cooldown"`
+
 	// config file path
 	CfPath string `cfg:"cf,omitempty"`
 }
@@ -56,14 +90,36 @@ type ServerInfo struct {
 	StartUpTime time.Time
 }
 
+// GetMode returns ClusterMode if peers are configured, otherwise returns StandaloneMode
+func (p *ServerProperties) GetMode() string {
+	if p.Self != "" && len(p.Peers) > 0 {
+		return ClusterMode
+	}
+	return StandaloneMode
+}
+
 func (p *ServerProperties) AnnounceAddress() string {
 	return p.AnnounceHost + ":" + strconv.Itoa(p.Port)
 }
 
-// Properties holds global config properties
-var Properties *ServerProperties
+// defaultDatabases is the number of databases if databases is not configured
+const defaultDatabases = 16
+
+// properties holds global config properties. It is replaced as a whole by SetConfig instead of being modified,
+// so that readers always see a consistent snapshot without locks
+var properties atomic.Value // *ServerProperties
 var EachTimeServerInfo *ServerInfo
 
+// Properties returns the current config properties, the result must not be modified
+func Properties() *ServerProperties {
+	return properties.Load().(*ServerProperties)
+}
+
+// SetProperties replaces all config properties, used at startup
+func SetProperties(p *ServerProperties) {
+	properties.Store(p)
+}
+
 func init() {
 	// A few stats we don't want to reset: server startup time, and peak mem.
 	EachTimeServerInfo = &ServerInfo{
@@ -71,12 +127,13 @@ func init() {
 	}
 
 	// default config
-	Properties = &ServerProperties{
+	SetProperties(&ServerProperties{
 		Bind:       "127.0.0.1",
 		Port:       6379,
 		AppendOnly: false,
+		Databases:  defaultDatabases,
 		RunID:      utils.RandString(40),
-	}
+	})
 }
 
 func parse(src io.Reader) *ServerProperties {
@@ -102,36 +159,12 @@ func parse(src io.Reader) *ServerProperties {
 	}
 
 	// parse format
-	t := reflect.TypeOf(config)
-	v := reflect.ValueOf(config)
-	n := t.Elem().NumField()
-	for i := 0; i < n; i++ {
-		field := t.Elem().Field(i)
-		fieldVal := v.Elem().Field(i)
-		key, ok := field.Tag.Lookup("cfg")
-		if !ok || strings.TrimLeft(key, " ") == "" {
-			key = field.Name
-		}
-		value, ok := rawMap[strings.ToLower(key)]
+	v := reflect.ValueOf(config).Elem()
+	for _, field := range listFields(v) {
+		value, ok := rawMap[field.name]
 		if ok {
-			// fill config
-			switch field.Type.Kind() {
-			case reflect.String:
-				fieldVal.SetString(value)
-			case reflect.Int:
-				intValue, err := strconv.ParseInt(value, 10, 64)
-				if err == nil {
-					fieldVal.SetInt(intValue)
-				}
-			case reflect.Bool:
-				boolValue := "yes" == value
-				fieldVal.SetBool(boolValue)
-			case reflect.Slice:
-				if field.Type.Elem().Kind() == reflect.String {
-					slice := strings.Split(value, ",")
-					fieldVal.Set(reflect.ValueOf(slice))
-				}
-			}
+			// fill config, invalid value is ignored
+			_ = setFieldValue(field.value, value)
 		}
 	}
 	return config
@@ -144,18 +177,20 @@ func SetupConfig(configFilename string) {
 		panic(err)
 	}
 	defer file.Close()
-	Properties = parse(file)
-	Properties.RunID = utils.RandString(40)
-	configFilePath, err := filepath.Abs(configFilename)
-	if err != nil {
-		return
+	props := parse(file)
+	props.RunID = utils.RandString(40)
+	if props.Dir == "" {
+		props.Dir = "."
+	}
+	if props.Databases <= 0 {
+		props.Databases = defaultDatabases
 	}
-	Properties.CfPath = configFilePath
-	if Properties.Dir == "" {
-		Properties.Dir = "."
+	if configFilePath, err := filepath.Abs(configFilename); err == nil {
+		props.CfPath = configFilePath
 	}
+	SetProperties(props)
 }
 
 func GetTmpDir() string {
-	return Properties.Dir + "/tmp"
+	return Properties().Dir + "/tmp"
 }
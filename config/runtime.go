@@ -0,0 +1,244 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// configField is a field of ServerProperties which could be set by config file or CONFIG SET
+type configField struct {
+	name  string
+	value reflect.Value
+}
+
+// listFields returns configurable fields of the given ServerProperties in declaration order
+func listFields(v reflect.Value) []configField {
+	t := v.Type()
+	fields := make([]configField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("cfg"); ok {
+			options := strings.Split(tag, ",")
+			if len(options) > 1 && options[1] == "omitempty" {
+				continue
+			}
+			if strings.TrimSpace(options[0]) != "" {
+				name = strings.TrimSpace(options[0])
+			}
+		}
+		fields = append(fields, configField{
+			name:  strings.ToLower(name),
+			value: v.Field(i),
+		})
+	}
+	return fields
+}
+
+func findField(p *ServerProperties, name string) (configField, bool) {
+	name = strings.ToLower(name)
+	for _, field := range listFields(reflect.ValueOf(p).Elem()) {
+		if field.name == name {
+			return field, true
+		}
+	}
+	return configField{}, false
+}
+
+// setFieldValue parses value according to the type of field
+func setFieldValue(fieldVal reflect.Value, value string) error {
+	switch fieldVal.Kind() {
+	case reflect.String:
+		fieldVal.SetString(value)
+	case reflect.Int:
+		intValue, err := parseMemory(value)
+		if err != nil {
+			return errors.New("argument couldn't be parsed into an integer")
+		}
+		fieldVal.SetInt(intValue)
+	case reflect.Bool:
+		switch strings.ToLower(value) {
+		case "yes":
+			fieldVal.SetBool(true)
+		case "no":
+			fieldVal.SetBool(false)
+		default:
+			return errors.New("argument must be 'yes' or 'no'")
+		}
+	case reflect.Slice:
+		if fieldVal.Type().Elem().Kind() == reflect.String {
+			slice := strings.Split(value, ",")
+			fieldVal.Set(reflect.ValueOf(slice))
+		}
+	}
+	return nil
+}
+
+// memoryUnits are units of memory like redis, `k` means 1000 bytes and `kb` means 1024 bytes
+var memoryUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+	{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+	{"b", 1},
+}
+
+// parseMemory parses integer with an optional memory unit, such as 100mb
+func parseMemory(value string) (int64, error) {
+	lower := strings.ToLower(value)
+	factor := int64(1)
+	for _, unit := range memoryUnits {
+		if strings.HasSuffix(lower, unit.suffix) {
+			lower = strings.TrimSuffix(lower, unit.suffix)
+			factor = unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * factor, nil
+}
+
+// formatFieldValue formats value in the same way as config file
+func formatFieldValue(fieldVal reflect.Value) string {
+	switch fieldVal.Kind() {
+	case reflect.String:
+		return fieldVal.String()
+	case reflect.Int:
+		return strconv.FormatInt(fieldVal.Int(), 10)
+	case reflect.Bool:
+		if fieldVal.Bool() {
+			return "yes"
+		}
+		return "no"
+	case reflect.Slice:
+		if strs, ok := fieldVal.Interface().([]string); ok {
+			return strings.Join(strs, ",")
+		}
+	}
+	return ""
+}
+
+// ListConfigNames returns names of all configs in declaration order
+func ListConfigNames() []string {
+	fields := listFields(reflect.ValueOf(Properties()).Elem())
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = field.name
+	}
+	return names
+}
+
+// GetConfig returns the current value of config, returns false if the config doesn't exist
+func GetConfig(name string) (string, bool) {
+	field, ok := findField(Properties(), name)
+	if !ok {
+		return "", false
+	}
+	return formatFieldValue(field.value), true
+}
+
+var (
+	// changedConfigs records configs changed by SetConfig, CONFIG REWRITE appends them if absent in config file
+	changedConfigs   = make(map[string]bool)
+	changedConfigsMu sync.Mutex
+	// setConfigMu serializes SetConfig, otherwise concurrent copies of properties would lose updates
+	setConfigMu sync.Mutex
+)
+
+// SetConfig parses value and sets config at runtime, invoker should check whether the config is mutable.
+// properties are copied and replaced, readers holding the old properties are not affected
+func SetConfig(name string, value string) error {
+	setConfigMu.Lock()
+	defer setConfigMu.Unlock()
+	props := *Properties()
+	field, ok := findField(&props, name)
+	if !ok {
+		return errors.New("unknown config")
+	}
+	if err := setFieldValue(field.value, value); err != nil {
+		return err
+	}
+	SetProperties(&props)
+	changedConfigsMu.Lock()
+	changedConfigs[field.name] = true
+	changedConfigsMu.Unlock()
+	return nil
+}
+
+// RewriteConfig persists current configs into config file. Comments and unknown lines are kept,
+// lines of known configs are updated in place and changed configs absent in the file are appended
+func RewriteConfig() error {
+	cfPath := Properties().CfPath
+	if cfPath == "" {
+		return errors.New("The server is running without a config file")
+	}
+	file, err := os.Open(cfPath)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	_ = file.Close()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	written := make(map[string]bool)
+	result := make([]string, 0, len(lines))
+	for _, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || trimmed[0] == '#' {
+			result = append(result, line)
+			continue
+		}
+		name := strings.ToLower(strings.SplitN(trimmed, " ", 2)[0])
+		value, ok := GetConfig(name)
+		if !ok {
+			result = append(result, line)
+			continue
+		}
+		if written[name] || value == "" {
+			continue // drop duplicated lines and empty values, which can't be parsed
+		}
+		written[name] = true
+		result = append(result, name+" "+value)
+	}
+
+	changedConfigsMu.Lock()
+	appended := false
+	for _, name := range ListConfigNames() {
+		if !changedConfigs[name] || written[name] {
+			continue
+		}
+		value, _ := GetConfig(name)
+		if value == "" {
+			continue
+		}
+		if !appended {
+			result = append(result, "# Generated by CONFIG REWRITE")
+			appended = true
+		}
+		result = append(result, name+" "+value)
+	}
+	changedConfigsMu.Unlock()
+
+	// write to a temp file and rename, so that a crash won't leave a broken config file
+	tmpPath := cfPath + ".tmp"
+	content := strings.Join(result, "\n") + "\n"
+	if err := os.WriteFile(tmpPath, []byte(content), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, cfPath)
+}
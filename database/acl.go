@@ -0,0 +1,690 @@
+package database
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"goRedis/config"
+	"goRedis/interface/resp"
+	"goRedis/lib/wildcard"
+	"goRedis/resp/reply"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// aclUser holds permissions of a user, it is immutable once stored into aclUsers
+type aclUser struct {
+	name      string
+	enabled   bool
+	noPass    bool
+	passwords []string // sha256 of passwords in hex
+
+	allowedCommands map[string]bool
+	allCommands     bool     // allows commands which are not in cmdTable, such as internal commands of cluster
+	commandRules    []string // rules of commands in order, used to describe the user
+
+	keyPatterns      []string // patterns of keys which could be read and written
+	keyMatchers      []*wildcard.Pattern
+	readKeyPatterns  []string // patterns of `%R~`, keys which could only be read
+	readKeyMatchers  []*wildcard.Pattern
+	writeKeyPatterns []string // patterns of `%W~`, keys which could only be written
+	writeKeyMatchers []*wildcard.Pattern
+	channelPatterns  []string
+	channelMatchers  []*wildcard.Pattern
+}
+
+var (
+	aclUsers = make(map[string]*aclUser)
+	aclMu    sync.RWMutex
+)
+
+// makeDefaultUser creates the default user according to requirepass
+func makeDefaultUser() *aclUser {
+	user := newAclUser(defaultUser)
+	rules := []string{"on", "~*", "&*", "+@all"}
+	if config.Properties().RequirePass != "" {
+		rules = append(rules, ">"+config.Properties().RequirePass)
+	} else {
+		rules = append(rules, "nopass")
+	}
+	for _, rule := range rules {
+		_ = user.applyRule(rule)
+	}
+	return user
+}
+
+// newAclUser creates a user which is disabled and has no permission
+func newAclUser(name string) *aclUser {
+	return &aclUser{
+		name:            name,
+		allowedCommands: make(map[string]bool),
+	}
+}
+
+// initACL creates the default user and loads users from aclfile
+func initACL() error {
+	aclMu.Lock()
+	defer aclMu.Unlock()
+	aclUsers = map[string]*aclUser{defaultUser: makeDefaultUser()}
+	if config.Properties().AclFile == "" {
+		return nil
+	}
+	users, err := loadAclFile(config.Properties().AclFile)
+	if err != nil {
+		return err
+	}
+	aclUsers = users
+	return nil
+}
+
+func getAclUser(name string) *aclUser {
+	aclMu.RLock()
+	defer aclMu.RUnlock()
+	return aclUsers[name]
+}
+
+// clone returns a deep copy of user, so that modifying doesn't affect connections using the user
+func (u *aclUser) clone() *aclUser {
+	cp := *u
+	cp.passwords = append([]string(nil), u.passwords...)
+	cp.allowedCommands = make(map[string]bool, len(u.allowedCommands))
+	for name := range u.allowedCommands {
+		cp.allowedCommands[name] = true
+	}
+	cp.commandRules = append([]string(nil), u.commandRules...)
+	cp.keyPatterns = append([]string(nil), u.keyPatterns...)
+	cp.keyMatchers = append([]*wildcard.Pattern(nil), u.keyMatchers...)
+	cp.readKeyPatterns = append([]string(nil), u.readKeyPatterns...)
+	cp.readKeyMatchers = append([]*wildcard.Pattern(nil), u.readKeyMatchers...)
+	cp.writeKeyPatterns = append([]string(nil), u.writeKeyPatterns...)
+	cp.writeKeyMatchers = append([]*wildcard.Pattern(nil), u.writeKeyMatchers...)
+	cp.channelPatterns = append([]string(nil), u.channelPatterns...)
+	cp.channelMatchers = append([]*wildcard.Pattern(nil), u.channelMatchers...)
+	return &cp
+}
+
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// applyRule modifies user according to a rule of ACL SETUSER, see https://redis.io/commands/acl-setuser/
+func (u *aclUser) applyRule(rule string) error {
+	lower := strings.ToLower(rule)
+	switch lower {
+	case "on":
+		u.enabled = true
+		return nil
+	case "off":
+		u.enabled = false
+		return nil
+	case "nopass":
+		u.noPass = true
+		u.passwords = nil
+		return nil
+	case "resetpass":
+		u.noPass = false
+		u.passwords = nil
+		return nil
+	case "allkeys":
+		return u.applyRule("~*")
+	case "resetkeys":
+		u.keyPatterns = nil
+		u.keyMatchers = nil
+		u.readKeyPatterns = nil
+		u.readKeyMatchers = nil
+		u.writeKeyPatterns = nil
+		u.writeKeyMatchers = nil
+		return nil
+	case "allchannels":
+		return u.applyRule("&*")
+	case "resetchannels":
+		u.channelPatterns = nil
+		u.channelMatchers = nil
+		return nil
+	case "allcommands":
+		return u.applyRule("+@all")
+	case "nocommands":
+		return u.applyRule("-@all")
+	case "reset":
+		for _, r := range []string{"resetpass", "resetkeys", "resetchannels", "nocommands", "off"} {
+			_ = u.applyRule(r)
+		}
+		return nil
+	}
+	if rule == "" {
+		return errors.New("empty rule")
+	}
+	switch rule[0] {
+	case '>':
+		u.addPasswordHash(hashPassword(rule[1:]))
+	case '<':
+		return u.removePasswordHash(hashPassword(rule[1:]))
+	case '#':
+		hash := strings.ToLower(rule[1:])
+		if !isValidPasswordHash(hash) {
+			return errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+		}
+		u.addPasswordHash(hash)
+	case '!':
+		return u.removePasswordHash(strings.ToLower(rule[1:]))
+	case '~':
+		u.keyPatterns, u.keyMatchers = addPattern(u.keyPatterns, u.keyMatchers, rule[1:])
+	case '%':
+		return u.applyKeyPermissionRule(rule)
+	case '&':
+		u.channelPatterns, u.channelMatchers = addPattern(u.channelPatterns, u.channelMatchers, rule[1:])
+	case '+', '-':
+		return u.applyCommandRule(rule[0] == '+', lower[1:])
+	default:
+		return errors.New("Syntax error")
+	}
+	return nil
+}
+
+func (u *aclUser) addPasswordHash(hash string) {
+	u.noPass = false
+	for _, p := range u.passwords {
+		if p == hash {
+			return
+		}
+	}
+	u.passwords = append(u.passwords, hash)
+}
+
+func (u *aclUser) removePasswordHash(hash string) error {
+	for i, p := range u.passwords {
+		if p == hash {
+			u.passwords = append(u.passwords[:i:i], u.passwords[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("no such password")
+}
+
+func isValidPasswordHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+func addPattern(patterns []string, matchers []*wildcard.Pattern, pattern string) ([]string, []*wildcard.Pattern) {
+	for _, p := range patterns {
+		if p == pattern || p == "*" {
+			return patterns, matchers
+		}
+	}
+	if pattern == "*" {
+		// `*` covers all other patterns
+		return []string{pattern}, []*wildcard.Pattern{wildcard.CompilePattern(pattern)}
+	}
+	return append(patterns, pattern), append(matchers, wildcard.CompilePattern(pattern))
+}
+
+// applyKeyPermissionRule adds key pattern with permissions, such as `%R~user:*`, `%W~log:*` and `%RW~tmp:*`
+func (u *aclUser) applyKeyPermissionRule(rule string) error {
+	sep := strings.IndexByte(rule, '~')
+	if sep < 0 {
+		return errors.New("Syntax error")
+	}
+	var read, write bool
+	for _, perm := range strings.ToUpper(rule[1:sep]) {
+		switch perm {
+		case 'R':
+			read = true
+		case 'W':
+			write = true
+		default:
+			return errors.New("Syntax error")
+		}
+	}
+	pattern := rule[sep+1:]
+	switch {
+	case read && write:
+		u.keyPatterns, u.keyMatchers = addPattern(u.keyPatterns, u.keyMatchers, pattern)
+	case read:
+		u.readKeyPatterns, u.readKeyMatchers = addPattern(u.readKeyPatterns, u.readKeyMatchers, pattern)
+	case write:
+		u.writeKeyPatterns, u.writeKeyMatchers = addPattern(u.writeKeyPatterns, u.writeKeyMatchers, pattern)
+	default:
+		return errors.New("Syntax error")
+	}
+	return nil
+}
+
+// applyCommandRule allows or disallows a command or a category of commands
+// target is command name or `@category` in lower case
+func (u *aclUser) applyCommandRule(allow bool, target string) error {
+	sign := "-"
+	if allow {
+		sign = "+"
+	}
+	if strings.HasPrefix(target, "@") {
+		category := target[1:]
+		if category == "all" {
+			u.allCommands = allow
+			u.allowedCommands = make(map[string]bool)
+			if allow {
+				for name := range cmdTable {
+					u.allowedCommands[name] = true
+				}
+			}
+			// rules before +@all or -@all have no effect
+			u.commandRules = []string{sign + target}
+			return nil
+		}
+		if !isAclCategory(category) {
+			return errors.New("Unknown command or category name in ACL")
+		}
+		for name, cmd := range cmdTable {
+			if cmd.hasCategory(category) {
+				u.setCommandAllowed(name, allow)
+			}
+		}
+	} else {
+		if _, ok := cmdTable[target]; !ok {
+			return errors.New("Unknown command or category name in ACL")
+		}
+		u.setCommandAllowed(target, allow)
+	}
+	u.commandRules = append(u.commandRules, sign+target)
+	return nil
+}
+
+func (u *aclUser) setCommandAllowed(name string, allow bool) {
+	if allow {
+		u.allowedCommands[name] = true
+	} else {
+		delete(u.allowedCommands, name)
+		u.allCommands = false
+	}
+}
+
+func isAclCategory(category string) bool {
+	for _, c := range aclCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCategory returns whether command belongs to the given acl category
+func (cmd *command) hasCategory(category string) bool {
+	for _, c := range cmd.getCategories() {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *aclUser) checkPassword(password string) bool {
+	if !u.enabled {
+		return false
+	}
+	if u.noPass {
+		return true
+	}
+	hash := hashPassword(password)
+	for _, p := range u.passwords {
+		if p == hash {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *aclUser) canExecute(cmdName string) bool {
+	if _, ok := cmdTable[cmdName]; !ok {
+		return u.allCommands
+	}
+	return u.allowedCommands[cmdName]
+}
+
+// canAccessKey returns whether the key could be written if write is true, or be read otherwise
+func (u *aclUser) canAccessKey(key string, write bool) bool {
+	if matchAny(u.keyMatchers, key) {
+		return true
+	}
+	if write {
+		return matchAny(u.writeKeyMatchers, key)
+	}
+	return matchAny(u.readKeyMatchers, key)
+}
+
+func matchAny(matchers []*wildcard.Pattern, s string) bool {
+	for _, matcher := range matchers {
+		if matcher.IsMatch(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *aclUser) canAccessChannel(channel string) bool {
+	for _, matcher := range u.channelMatchers {
+		if matcher.IsMatch(channel) {
+			return true
+		}
+	}
+	return false
+}
+
+// describe returns rules of user in the format of ACL LIST and aclfile
+func (u *aclUser) describe() string {
+	parts := []string{"user", u.name}
+	parts = append(parts, u.getFlags()...)
+	for _, p := range u.passwords {
+		parts = append(parts, "#"+p)
+	}
+	parts = append(parts, u.describeKeys()...)
+	if len(u.channelPatterns) == 0 {
+		parts = append(parts, "resetchannels")
+	}
+	for _, p := range u.channelPatterns {
+		parts = append(parts, "&"+p)
+	}
+	parts = append(parts, u.describeCommands())
+	return strings.Join(parts, " ")
+}
+
+// describeKeys returns key patterns with permissions, such as `~user:*` and `%R~order:*`
+func (u *aclUser) describeKeys() []string {
+	parts := make([]string, 0, len(u.keyPatterns)+len(u.readKeyPatterns)+len(u.writeKeyPatterns))
+	for _, p := range u.keyPatterns {
+		parts = append(parts, "~"+p)
+	}
+	for _, p := range u.readKeyPatterns {
+		parts = append(parts, "%R~"+p)
+	}
+	for _, p := range u.writeKeyPatterns {
+		parts = append(parts, "%W~"+p)
+	}
+	return parts
+}
+
+func (u *aclUser) getFlags() []string {
+	flags := []string{"off"}
+	if u.enabled {
+		flags[0] = "on"
+	}
+	if u.noPass {
+		flags = append(flags, "nopass")
+	}
+	return flags
+}
+
+func (u *aclUser) describeCommands() string {
+	if len(u.commandRules) == 0 {
+		return "-@all"
+	}
+	return strings.Join(u.commandRules, " ")
+}
+
+// setAclUser applies rules to the user, creates the user if not exists
+// all rules are applied or none of them
+func setAclUser(name string, rules []string) error {
+	aclMu.Lock()
+	defer aclMu.Unlock()
+	var user *aclUser
+	if old, ok := aclUsers[name]; ok {
+		user = old.clone()
+	} else {
+		user = newAclUser(name)
+	}
+	for _, rule := range rules {
+		if err := user.applyRule(rule); err != nil {
+			return fmt.Errorf("Error in ACL SETUSER modifier '%s': %s", rule, err.Error())
+		}
+	}
+	aclUsers[name] = user
+	return nil
+}
+
+// deleteAclUsers removes users and returns the number of removed users
+func deleteAclUsers(names []string) (int, error) {
+	aclMu.Lock()
+	defer aclMu.Unlock()
+	for _, name := range names {
+		if name == defaultUser {
+			return 0, errors.New("The 'default' user cannot be removed")
+		}
+	}
+	count := 0
+	for _, name := range names {
+		if _, ok := aclUsers[name]; ok {
+			delete(aclUsers, name)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// listAclUsers returns all users ordered by name
+func listAclUsers() []*aclUser {
+	aclMu.RLock()
+	defer aclMu.RUnlock()
+	users := make([]*aclUser, 0, len(aclUsers))
+	for _, user := range aclUsers {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].name < users[j].name
+	})
+	return users
+}
+
+// loadAclFile parses aclfile, each line is a user in the format of ACL LIST
+func loadAclFile(filename string) (map[string]*aclUser, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	users := make(map[string]*aclUser)
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "user" {
+			return nil, fmt.Errorf("%s:%d: line should start with user keyword", filename, lineNum)
+		}
+		name := fields[1]
+		if _, ok := users[name]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate user '%s' found", filename, lineNum, name)
+		}
+		user := newAclUser(name)
+		for _, rule := range fields[2:] {
+			if err := user.applyRule(rule); err != nil {
+				return nil, fmt.Errorf("%s:%d: %s. Error in user declaration '%s'", filename, lineNum, err.Error(), name)
+			}
+		}
+		users[name] = user
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if _, ok := users[defaultUser]; !ok {
+		users[defaultUser] = makeDefaultUser()
+	}
+	return users, nil
+}
+
+// saveAclFile writes all users into aclfile
+func saveAclFile(filename string) error {
+	var buf strings.Builder
+	for _, user := range listAclUsers() {
+		buf.WriteString(user.describe())
+		buf.WriteString("\n")
+	}
+	tmpFile := filename + ".tmp"
+	if err := os.WriteFile(tmpFile, []byte(buf.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, filename)
+}
+
+// getConnUser returns the user of connection,
+// connection which has not authenticated uses the default user if it doesn't require password
+// returns nil if the connection is not authenticated or its user has been removed or disabled
+func getConnUser(c resp.Connection) *aclUser {
+	name := c.GetUser()
+	if name == "" {
+		user := getAclUser(defaultUser)
+		if user != nil && user.enabled && user.noPass {
+			return user
+		}
+		return nil
+	}
+	user := getAclUser(name)
+	if user == nil || !user.enabled {
+		return nil
+	}
+	return user
+}
+
+// getConnUserName returns name of the user of connection for ACL WHOAMI and ACL LOG
+func getConnUserName(c resp.Connection) string {
+	if name := c.GetUser(); name != "" {
+		return name
+	}
+	return defaultUser
+}
+
+// CheckPermission returns NOPERM error if the user of connection is not allowed to execute the command or access the keys
+// returns nil if the command could be executed
+func CheckPermission(c resp.Connection, cmdLine [][]byte) resp.Reply {
+	if isInternalConn(c) {
+		return nil
+	}
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	if noAuthCommands[cmdName] {
+		return nil
+	}
+	// everyone could know who he is and which categories exist
+	if cmdName == "acl" && len(cmdLine) > 1 {
+		subCmd := strings.ToLower(string(cmdLine[1]))
+		if subCmd == "whoami" || subCmd == "cat" {
+			return nil
+		}
+	}
+	user := getConnUser(c)
+	if user == nil {
+		return noAuthReply
+	}
+	var errReply resp.Reply
+	if !user.canExecute(cmdName) {
+		addAclLog(c, "command", cmdName)
+		errReply = reply.MakeErrReply(fmt.Sprintf("NOPERM User %s has no permissions to run the '%s' command", user.name, cmdName))
+	} else if cmd, ok := lookupCommand(cmdName); ok && validateArity(cmd.arity, cmdLine) {
+		// keys of internal commands wrapped by Prepare of cluster are checked as well
+		// keys of write commands require write permission, keys of other commands require read permission
+		write := cmd.flags&flagWrite > 0
+		for _, key := range cmd.extractKeys(cmdLine) {
+			if !user.canAccessKey(key, write) {
+				addAclLog(c, "key", key)
+				errReply = reply.MakeErrReply("NOPERM No permissions to access a key")
+				break
+			}
+		}
+	}
+	if errReply != nil && c.InMultiState() {
+		// EXEC fails with EXECABORT like other errors within multi
+		c.AddTxError(errReply.(error))
+	}
+	return errReply
+}
+
+// CheckChannelPermission returns NOPERM error if the user of connection is not allowed to access the channels
+func CheckChannelPermission(c resp.Connection, channels []string) resp.Reply {
+	if isInternalConn(c) {
+		return nil
+	}
+	user := getConnUser(c)
+	if user == nil {
+		return noAuthReply
+	}
+	for _, channel := range channels {
+		if !user.canAccessChannel(channel) {
+			addAclLog(c, "channel", channel)
+			return reply.MakeErrReply("NOPERM No permissions to access a channel")
+		}
+	}
+	return nil
+}
+
+/* ---- ACL LOG ---- */
+
+const maxAclLogLen = 128
+
+type aclLogEntry struct {
+	count      int64
+	reason     string // command, key, channel or auth
+	context    string // toplevel or multi
+	object     string
+	username   string
+	clientInfo string
+	entryID    int64
+	createdAt  time.Time
+	updatedAt  time.Time
+}
+
+var (
+	aclLog       []*aclLogEntry // newest first
+	aclLogNextID int64
+	aclLogMu     sync.Mutex
+)
+
+// addAclLog records a denied command, similar entries within 60 seconds are merged
+func addAclLog(c resp.Connection, reason string, object string) {
+	username := getConnUserName(c)
+	context := "toplevel"
+	if c.InMultiState() {
+		context = "multi"
+	}
+	addAclLogEntry(c, reason, context, object, username)
+}
+
+func addAclLogEntry(c resp.Connection, reason string, context string, object string, username string) {
+	aclLogMu.Lock()
+	defer aclLogMu.Unlock()
+	now := time.Now()
+	for _, entry := range aclLog {
+		if entry.reason == reason && entry.context == context && entry.object == object &&
+			entry.username == username && now.Sub(entry.updatedAt) < 60*time.Second {
+			entry.count++
+			entry.updatedAt = now
+			entry.clientInfo = clientInfo(c)
+			return
+		}
+	}
+	entry := &aclLogEntry{
+		count:      1,
+		reason:     reason,
+		context:    context,
+		object:     object,
+		username:   username,
+		clientInfo: clientInfo(c),
+		entryID:    aclLogNextID,
+		createdAt:  now,
+		updatedAt:  now,
+	}
+	aclLogNextID++
+	aclLog = append([]*aclLogEntry{entry}, aclLog...)
+	if len(aclLog) > maxAclLogLen {
+		aclLog = aclLog[:maxAclLogLen]
+	}
+}
@@ -0,0 +1,213 @@
+package database
+
+import (
+	"goRedis/config"
+	"goRedis/interface/resp"
+	"goRedis/resp/reply"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var noAclFileReply = reply.MakeErrReply("ERR This Redis instance is not configured to use an ACL file. " +
+	"You may want to specify users via the ACL SETUSER command and then issue a CONFIG REWRITE " +
+	"(assuming you have a Redis configuration file set) in order to store users in the Redis configuration.")
+
+// ExecACL executes ACL subcommands, users are stored in local node even in cluster mode
+func ExecACL(c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("acl")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	args = args[1:]
+	switch subCmd {
+	case "setuser":
+		if len(args) < 1 {
+			return reply.MakeArgNumErrReply("acl|setuser")
+		}
+		rules := make([]string, len(args)-1)
+		for i, rule := range args[1:] {
+			rules[i] = string(rule)
+		}
+		if err := setAclUser(string(args[0]), rules); err != nil {
+			return reply.MakeErrReply("ERR " + err.Error())
+		}
+		return reply.MakeOkReply()
+	case "getuser":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("acl|getuser")
+		}
+		return execAclGetUser(string(args[0]))
+	case "deluser":
+		if len(args) < 1 {
+			return reply.MakeArgNumErrReply("acl|deluser")
+		}
+		names := make([]string, len(args))
+		for i, name := range args {
+			names[i] = string(name)
+		}
+		count, err := deleteAclUsers(names)
+		if err != nil {
+			return reply.MakeErrReply("ERR " + err.Error())
+		}
+		return reply.MakeIntReply(int64(count))
+	case "list":
+		users := listAclUsers()
+		lines := make([][]byte, len(users))
+		for i, user := range users {
+			lines[i] = []byte(user.describe())
+		}
+		return reply.MakeMultiBulkReply(lines)
+	case "users":
+		users := listAclUsers()
+		names := make([][]byte, len(users))
+		for i, user := range users {
+			names[i] = []byte(user.name)
+		}
+		return reply.MakeMultiBulkReply(names)
+	case "whoami":
+		return reply.MakeBulkReply([]byte(getConnUserName(c)))
+	case "cat":
+		return execAclCat(args)
+	case "log":
+		return execAclLog(args)
+	case "load":
+		return execAclLoad()
+	case "save":
+		if config.Properties().AclFile == "" {
+			return noAclFileReply
+		}
+		if err := saveAclFile(config.Properties().AclFile); err != nil {
+			return reply.MakeErrReply("ERR There was an error trying to save the ACLs. Please check the server logs for more information")
+		}
+		return reply.MakeOkReply()
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try ACL HELP.")
+}
+
+func execAclGetUser(name string) resp.Reply {
+	user := getAclUser(name)
+	if user == nil {
+		return reply.MakeNullBulkReply()
+	}
+	toBytes := func(strs []string) [][]byte {
+		result := make([][]byte, len(strs))
+		for i, s := range strs {
+			result[i] = []byte(s)
+		}
+		return result
+	}
+	return reply.MakeMapReply([]resp.Reply{
+		reply.MakeBulkReply([]byte("flags")),
+		reply.MakeMultiBulkReply(toBytes(user.getFlags())),
+		reply.MakeBulkReply([]byte("passwords")),
+		reply.MakeMultiBulkReply(toBytes(user.passwords)),
+		reply.MakeBulkReply([]byte("commands")),
+		reply.MakeBulkReply([]byte(user.describeCommands())),
+		reply.MakeBulkReply([]byte("keys")),
+		reply.MakeBulkReply([]byte(strings.Join(user.describeKeys(), " "))),
+		reply.MakeBulkReply([]byte("channels")),
+		reply.MakeBulkReply([]byte(joinPatterns(user.channelPatterns, "&"))),
+		reply.MakeBulkReply([]byte("selectors")),
+		reply.MakeEmptyMultiBulkReply(),
+	})
+}
+
+// joinPatterns formats patterns like `~user:* ~order:*`
+func joinPatterns(patterns []string, prefix string) string {
+	parts := make([]string, len(patterns))
+	for i, p := range patterns {
+		parts[i] = prefix + p
+	}
+	return strings.Join(parts, " ")
+}
+
+// execAclCat lists categories, or commands in the given category
+func execAclCat(args [][]byte) resp.Reply {
+	if len(args) > 1 {
+		return reply.MakeArgNumErrReply("acl|cat")
+	}
+	if len(args) == 0 {
+		categories := make([][]byte, len(aclCategories))
+		for i, category := range aclCategories {
+			categories[i] = []byte(category)
+		}
+		return reply.MakeMultiBulkReply(categories)
+	}
+	category := strings.ToLower(string(args[0]))
+	if !isAclCategory(category) {
+		return reply.MakeErrReply("ERR Unknown category '" + category + "'")
+	}
+	var names [][]byte
+	for _, cmd := range sortedCommands() {
+		if cmd.hasCategory(category) {
+			names = append(names, []byte(cmd.name))
+		}
+	}
+	return reply.MakeMultiBulkReply(names)
+}
+
+// execAclLog shows recent denied commands and failed authentications
+// ACL LOG [count | RESET]
+func execAclLog(args [][]byte) resp.Reply {
+	if len(args) > 1 {
+		return reply.MakeArgNumErrReply("acl|log")
+	}
+	count := maxAclLogLen
+	if len(args) == 1 {
+		if strings.ToLower(string(args[0])) == "reset" {
+			aclLogMu.Lock()
+			aclLog = nil
+			aclLogMu.Unlock()
+			return reply.MakeOkReply()
+		}
+		n, err := strconv.Atoi(string(args[0]))
+		if err != nil || n < 0 {
+			return reply.MakeErrReply("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+	aclLogMu.Lock()
+	defer aclLogMu.Unlock()
+	if count > len(aclLog) {
+		count = len(aclLog)
+	}
+	now := time.Now()
+	entries := make([]resp.Reply, count)
+	for i, entry := range aclLog[:count] {
+		age := now.Sub(entry.createdAt).Seconds()
+		entries[i] = reply.MakeMapReply([]resp.Reply{
+			reply.MakeBulkReply([]byte("count")), reply.MakeIntReply(entry.count),
+			reply.MakeBulkReply([]byte("reason")), reply.MakeBulkReply([]byte(entry.reason)),
+			reply.MakeBulkReply([]byte("context")), reply.MakeBulkReply([]byte(entry.context)),
+			reply.MakeBulkReply([]byte("object")), reply.MakeBulkReply([]byte(entry.object)),
+			reply.MakeBulkReply([]byte("username")), reply.MakeBulkReply([]byte(entry.username)),
+			reply.MakeBulkReply([]byte("age-seconds")), reply.MakeBulkReply([]byte(strconv.FormatFloat(age, 'f', 3, 64))),
+			reply.MakeBulkReply([]byte("client-info")), reply.MakeBulkReply([]byte(entry.clientInfo)),
+			reply.MakeBulkReply([]byte("entry-id")), reply.MakeIntReply(entry.entryID),
+			reply.MakeBulkReply([]byte("timestamp-created")), reply.MakeIntReply(entry.createdAt.UnixMilli()),
+			reply.MakeBulkReply([]byte("timestamp-last-updated")), reply.MakeIntReply(entry.updatedAt.UnixMilli()),
+		})
+	}
+	return reply.MakeMultiRawReply(entries)
+}
+
+// execAclLoad reloads users from aclfile, users are not changed if aclfile is invalid
+func execAclLoad() resp.Reply {
+	if config.Properties().AclFile == "" {
+		return noAclFileReply
+	}
+	users, err := loadAclFile(config.Properties().AclFile)
+	if err != nil {
+		return reply.MakeErrReply("ERR " + err.Error())
+	}
+	aclMu.Lock()
+	aclUsers = users
+	aclMu.Unlock()
+	return reply.MakeOkReply()
+}
+
+func init() {
+	registerSpecialCommand("Acl", -2, flagAdmin|flagNoScript).
+		attachDocs("server", "A container for Access List Control commands.", "6.0.0")
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"goRedis/lib/utils"
+	"goRedis/resp/connection"
+	"net"
+	"strings"
+	"testing"
+)
+
+// makeUserConn creates a user by rules of ACL SETUSER, and returns a client connection authenticated as the user
+func makeUserConn(t *testing.T, name string, rules string) *connection.Connection {
+	t.Helper()
+	if err := setAclUser(name, strings.Fields("reset on nopass "+rules)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = deleteAclUsers([]string{name})
+	})
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		_ = server.Close()
+		_ = client.Close()
+	})
+	conn := connection.NewConn(server)
+	conn.SetUser(name)
+	return conn
+}
+
+func TestCheckPermission(t *testing.T) {
+	const (
+		allowed  = ""
+		noKey    = "-NOPERM No permissions to access a key\r\n"
+		noDelCmd = "-NOPERM User tester has no permissions to run the 'del' command\r\n"
+	)
+	tests := []struct {
+		name     string
+		rules    string
+		cmdLine  string
+		expected string
+	}{
+		// key patterns
+		{"key matched", "+@all ~user:*", "GET user:1", allowed},
+		{"key not matched", "+@all ~user:*", "GET order:1", noKey},
+		{"all keys matched", "+@all ~user:* ~order:*", "MSET user:1 a order:1 b", allowed},
+		{"one of keys not matched", "+@all ~user:*", "MGET user:1 order:1", noKey},
+		{"no key patterns", "+@all", "GET user:1", noKey},
+		{"command without keys", "+@all", "PING", allowed},
+		{"all keys", "+@all allkeys", "DEL user:1", allowed},
+		{"reset keys", "+@all ~user:* resetkeys", "GET user:1", noKey},
+		{"movable keys", "+@all ~user:*", "MIGRATE 127.0.0.1 6379 order:1 0 1000", noKey},
+
+		// read and write permissions
+		{"read by read pattern", "+@all %R~user:*", "GET user:1", allowed},
+		{"write by read pattern", "+@all %R~user:*", "SET user:1 a", noKey},
+		{"write by write pattern", "+@all %W~log:*", "SET log:1 a", allowed},
+		{"read by write pattern", "+@all %W~log:*", "STRLEN log:1", noKey},
+		{"read and write pattern", "+@all %RW~user:*", "GETSET user:1 a", allowed},
+		{"lower case permissions", "+@all %rw~user:*", "SET user:1 a", allowed},
+		{"read all but write some", "+@all %R~* %W~log:*", "RENAME log:1 log:2", allowed},
+		{"write to read only key", "+@all %R~* %W~log:*", "RENAME log:1 user:1", noKey},
+
+		// commands and categories
+		{"command allowed", "+get ~*", "GET user:1", allowed},
+		{"command not allowed", "+get ~*", "DEL user:1", noDelCmd},
+		{"category allowed", "+@read ~*", "MGET user:1", allowed},
+		{"category not allowed", "+@read ~*", "DEL user:1", noDelCmd},
+		{"category removed", "+@all -@dangerous ~*", "FLUSHDB", "-NOPERM User tester has no permissions to run the 'flushdb' command\r\n"},
+		{"command removed from category", "+@all -del ~*", "DEL user:1", noDelCmd},
+		{"command checked before keys", "+get ~user:*", "DEL order:1", noDelCmd},
+
+		// command lines wrapped by Prepare and PrepareMulti of cluster
+		{"wrapped key matched", "+@all ~user:*", "RenameFrom user:1", allowed},
+		{"wrapped key not matched", "+@all ~user:*", "RenameTo order:1 SET a", noKey},
+		{"wrapped write by read pattern", "+@all %R~user:*", "RenameFrom user:1", noKey},
+		{"internal command not allowed", "+@read +@write ~*", "RenameFrom user:1",
+			"-NOPERM User tester has no permissions to run the 'renamefrom' command\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := makeUserConn(t, "tester", tt.rules)
+			result := CheckPermission(conn, utils.ToCmdLine(strings.Fields(tt.cmdLine)...))
+			actual := allowed
+			if result != nil {
+				actual = string(result.ToBytes())
+			}
+			if actual != tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCheckPermissionInMulti(t *testing.T) {
+	conn := makeUserConn(t, "tester", "+@all ~user:*")
+	conn.SetMultiState(true)
+	if result := CheckPermission(conn, utils.ToCmdLine("GET", "order:1")); result == nil {
+		t.Fatal("access to order:1 should be denied")
+	}
+	// EXEC fails with EXECABORT
+	if len(conn.GetTxErrors()) != 1 {
+		t.Fatalf("expected 1 error of transaction, got %d", len(conn.GetTxErrors()))
+	}
+}
+
+func TestKeyPermissionRule(t *testing.T) {
+	tests := []struct {
+		rules    string
+		expected string // keys of ACL GETUSER, or error
+	}{
+		{"~user:* %R~order:* %W~log:*", "~user:* %R~order:* %W~log:*"},
+		{"%RW~user:* %WR~order:*", "~user:* ~order:*"},
+		{"%R~* %R~user:*", "%R~*"},
+		{"%X~user:*", "Error in ACL SETUSER modifier '%X~user:*': Syntax error"},
+		{"%~user:*", "Error in ACL SETUSER modifier '%~user:*': Syntax error"},
+		{"%R", "Error in ACL SETUSER modifier '%R': Syntax error"},
+	}
+	for _, tt := range tests {
+		err := setAclUser("tester", strings.Fields("reset "+tt.rules))
+		actual := ""
+		if err != nil {
+			actual = err.Error()
+		} else {
+			actual = strings.Join(getAclUser("tester").describeKeys(), " ")
+		}
+		if actual != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.rules, tt.expected, actual)
+		}
+	}
+	_, _ = deleteAclUsers([]string{"tester"})
+}
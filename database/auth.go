@@ -0,0 +1,88 @@
+package database
+
+import (
+	"goRedis/interface/resp"
+	"goRedis/resp/connection"
+	"goRedis/resp/reply"
+	"strings"
+)
+
+// defaultUser is the user authenticated by the legacy `AUTH password`
+const defaultUser = "default"
+
+var (
+	noAuthReply   = reply.MakeErrReply("NOAUTH Authentication required.")
+	wrongPassword = reply.MakeErrReply("WRONGPASS invalid username-password pair or user is disabled.")
+)
+
+// noAuthCommands could be executed before authentication
+var noAuthCommands = map[string]bool{
+	"auth":  true,
+	"hello": true,
+	"quit":  true,
+}
+
+// Auth validates password of connection
+// AUTH [username] password
+func Auth(c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) != 1 && len(args) != 2 {
+		return reply.MakeArgNumErrReply("auth")
+	}
+	user := defaultUser
+	password := string(args[0])
+	if len(args) == 2 {
+		user = string(args[0])
+		password = string(args[1])
+	} else if u := getAclUser(defaultUser); u != nil && u.noPass {
+		return reply.MakeErrReply("ERR AUTH <password> called without any password configured for the default user. " +
+			"Are you sure your configuration is correct?")
+	}
+	if !checkPassword(user, password) {
+		addAclLogEntry(c, "auth", "toplevel", "AUTH", user)
+		return wrongPassword
+	}
+	c.SetUser(user)
+	return reply.MakeOkReply()
+}
+
+// checkPassword returns whether the given user could log in with password
+func checkPassword(user string, password string) bool {
+	u := getAclUser(user)
+	return u != nil && u.checkPassword(password)
+}
+
+// isAuthenticated returns whether connection could execute commands
+func isAuthenticated(c resp.Connection) bool {
+	if isInternalConn(c) {
+		return true
+	}
+	return getConnUser(c) != nil
+}
+
+// isInternalConn returns whether the connection is created by server itself, such as aof loading
+func isInternalConn(c resp.Connection) bool {
+	if c == nil {
+		return true
+	}
+	_, ok := c.(*connection.FakeConn)
+	return ok
+}
+
+// CheckAuth returns NOAUTH error if the connection is not allowed to execute the command before authentication
+// returns nil if the command could be executed
+func CheckAuth(c resp.Connection, cmdName string) resp.Reply {
+	if noAuthCommands[strings.ToLower(cmdName)] || isAuthenticated(c) {
+		return nil
+	}
+	return noAuthReply
+}
+
+func init() {
+	registerSpecialCommand("Auth", -2, flagNoScript|flagFast).
+		attachCategories(aclConnection).
+		attachDocs("connection", "Authenticates the connection.", "1.0.0")
+	// quit is handled by RespHandler
+	registerSpecialCommand("Quit", -1, flagNoScript|flagFast).
+		attachCategories(aclConnection).
+		attachDocs("connection", "Closes the connection.", "1.0.0")
+}
@@ -0,0 +1,415 @@
+package database
+
+import (
+	"goRedis/interface/resp"
+	"goRedis/resp/connection"
+	"goRedis/resp/reply"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ExecClient executes CLIENT subcommands, clients are connections of local node even in cluster mode
+func ExecClient(c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("client")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	args = args[1:]
+	switch subCmd {
+	case "id":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("client|id")
+		}
+		return reply.MakeIntReply(int64(c.GetID()))
+	case "setname":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("client|setname")
+		}
+		if errReply := setClientName(c, string(args[0])); errReply != nil {
+			return errReply
+		}
+		return reply.MakeOkReply()
+	case "getname":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("client|getname")
+		}
+		name := c.GetName()
+		if name == "" {
+			return reply.MakeNullBulkReply()
+		}
+		return reply.MakeBulkReply([]byte(name))
+	case "info":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("client|info")
+		}
+		return reply.MakeVerbatimReply("txt", []byte(clientInfo(c)+"\n"))
+	case "list":
+		return execClientList(args)
+	case "kill":
+		return execClientKill(c, args)
+	case "pause":
+		return execClientPause(args)
+	case "unpause":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("client|unpause")
+		}
+		unpauseClients()
+		return reply.MakeOkReply()
+	case "no-evict":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("client|no-evict")
+		}
+		conn, ok := c.(*connection.Connection)
+		switch strings.ToLower(string(args[0])) {
+		case "on":
+			if ok {
+				conn.SetNoEvict(true)
+			}
+		case "off":
+			if ok {
+				conn.SetNoEvict(false)
+			}
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+		return reply.MakeOkReply()
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try CLIENT HELP.")
+}
+
+// setClientName is used by CLIENT SETNAME and HELLO SETNAME, empty name removes the name
+func setClientName(c resp.Connection, name string) resp.Reply {
+	for i := 0; i < len(name); i++ {
+		// spaces, newlines and other special characters would break the output of CLIENT LIST
+		if name[i] < '!' || name[i] > '~' {
+			return reply.MakeErrReply("ERR Client names cannot contain spaces, newlines or special characters.")
+		}
+	}
+	c.SetName(name)
+	return nil
+}
+
+// clientInfo describes connection in the format of CLIENT LIST, it is also used by ACL LOG
+func clientInfo(c resp.Connection) string {
+	conn, ok := c.(*connection.Connection)
+	if !ok {
+		// fake connections of aof loading
+		return "id=" + strconv.FormatUint(c.GetID(), 10) + " addr= db=" + strconv.Itoa(c.GetDBIndex()) +
+			" user=" + getConnUserName(c)
+	}
+	flags := ""
+	if conn.SubsCount() > 0 {
+		flags += "P"
+	}
+	multi := -1
+	if conn.InMultiState() {
+		flags += "x"
+		multi = conn.QueuedCmdCount()
+	}
+	if conn.IsCloseAfterReply() {
+		flags += "c"
+	}
+	if conn.IsNoEvict() {
+		flags += "e"
+	}
+	if conn.IsMonitor() {
+		flags += "O"
+	}
+	if flags == "" {
+		flags = "N"
+	}
+	var b strings.Builder
+	b.WriteString("id=" + strconv.FormatUint(conn.GetID(), 10))
+	b.WriteString(" addr=" + conn.RemoteAddr().String())
+	b.WriteString(" laddr=" + conn.LocalAddr().String())
+	b.WriteString(" name=" + conn.GetName())
+	b.WriteString(" age=" + strconv.FormatInt(int64(conn.GetAge()/time.Second), 10))
+	b.WriteString(" idle=" + strconv.FormatInt(int64(conn.GetIdleTime()/time.Second), 10))
+	b.WriteString(" flags=" + flags)
+	b.WriteString(" db=" + strconv.Itoa(conn.GetDBIndex()))
+	b.WriteString(" sub=" + strconv.Itoa(len(conn.GetChannels())))
+	b.WriteString(" psub=" + strconv.Itoa(len(conn.GetPatterns())))
+	b.WriteString(" multi=" + strconv.Itoa(multi))
+	b.WriteString(" cmd=" + conn.GetLastCommand())
+	b.WriteString(" user=" + getConnUserName(conn))
+	b.WriteString(" resp=" + strconv.Itoa(conn.GetProtocol()))
+	return b.String()
+}
+
+// clientTypes are the types of CLIENT LIST TYPE and CLIENT KILL TYPE, goRedis has no replication
+var clientTypes = map[string]bool{"normal": true, "master": true, "replica": true, "slave": true, "pubsub": true}
+
+// matchClientType returns whether connection belongs to the given type
+func matchClientType(conn *connection.Connection, typ string) bool {
+	switch typ {
+	case "normal":
+		return conn.SubsCount() == 0
+	case "pubsub":
+		return conn.SubsCount() > 0
+	}
+	return false
+}
+
+// execClientList lists connected clients
+// CLIENT LIST [TYPE normal|master|replica|pubsub] [ID client-id [client-id ...]]
+func execClientList(args [][]byte) resp.Reply {
+	typ := ""
+	var ids map[uint64]bool
+	if len(args) > 0 {
+		switch strings.ToLower(string(args[0])) {
+		case "type":
+			if len(args) != 2 {
+				return reply.MakeSyntaxErrReply()
+			}
+			typ = strings.ToLower(string(args[1]))
+			if !clientTypes[typ] {
+				return reply.MakeErrReply("ERR Unknown client type '" + string(args[1]) + "'")
+			}
+		case "id":
+			if len(args) < 2 {
+				return reply.MakeSyntaxErrReply()
+			}
+			ids = make(map[uint64]bool)
+			for _, arg := range args[1:] {
+				id, err := strconv.ParseUint(string(arg), 10, 64)
+				if err != nil || id == 0 {
+					return reply.MakeErrReply("ERR Invalid client ID")
+				}
+				ids[id] = true
+			}
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	var b strings.Builder
+	for _, conn := range connection.ListClients() {
+		if typ != "" && !matchClientType(conn, typ) {
+			continue
+		}
+		if ids != nil && !ids[conn.GetID()] {
+			continue
+		}
+		b.WriteString(clientInfo(conn))
+		b.WriteByte('\n')
+	}
+	return reply.MakeVerbatimReply("txt", []byte(b.String()))
+}
+
+// execClientKill closes connections matching all the given filters, current connection is closed after reply
+// CLIENT KILL ip:port
+// CLIENT KILL [ID client-id] [TYPE type] [USER username] [ADDR ip:port] [LADDR ip:port] [SKIPME yes|no]
+func execClientKill(c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("client|kill")
+	}
+	if len(args) == 1 {
+		// old form only returns OK or error
+		addr := string(args[0])
+		for _, conn := range connection.ListClients() {
+			if conn.RemoteAddr().String() == addr {
+				killClient(c, conn)
+				return reply.MakeOkReply()
+			}
+		}
+		return reply.MakeErrReply("ERR No such client")
+	}
+	if len(args)%2 != 0 {
+		return reply.MakeSyntaxErrReply()
+	}
+	var id uint64
+	var typ, user, addr, laddr string
+	skipMe := true
+	for i := 0; i < len(args); i += 2 {
+		value := string(args[i+1])
+		switch strings.ToLower(string(args[i])) {
+		case "id":
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil || n == 0 {
+				return reply.MakeErrReply("ERR client-id should be greater than 0")
+			}
+			id = n
+		case "type":
+			typ = strings.ToLower(value)
+			if !clientTypes[typ] {
+				return reply.MakeErrReply("ERR Unknown client type '" + value + "'")
+			}
+		case "user":
+			if getAclUser(value) == nil {
+				return reply.MakeErrReply("ERR No such user '" + value + "'")
+			}
+			user = value
+		case "addr":
+			addr = value
+		case "laddr":
+			laddr = value
+		case "skipme":
+			switch strings.ToLower(value) {
+			case "yes":
+				skipMe = true
+			case "no":
+				skipMe = false
+			default:
+				return reply.MakeSyntaxErrReply()
+			}
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	killed := 0
+	for _, conn := range connection.ListClients() {
+		if (id != 0 && conn.GetID() != id) ||
+			(typ != "" && !matchClientType(conn, typ)) ||
+			(user != "" && getConnUserName(conn) != user) ||
+			(addr != "" && conn.RemoteAddr().String() != addr) ||
+			(laddr != "" && conn.LocalAddr().String() != laddr) ||
+			(skipMe && conn.GetID() == c.GetID()) {
+			continue
+		}
+		killClient(c, conn)
+		killed++
+	}
+	return reply.MakeIntReply(int64(killed))
+}
+
+func killClient(c resp.Connection, target *connection.Connection) {
+	if target.GetID() == c.GetID() {
+		// the reply of CLIENT KILL should be sent before closing
+		target.SetCloseAfterReply()
+		return
+	}
+	target.Kill()
+}
+
+// clientPause holds the state of CLIENT PAUSE
+var clientPause struct {
+	mu  sync.Mutex
+	end time.Time
+	// all is false if only write commands are paused
+	all bool
+	// resumed is closed when pause ends, nil if not paused
+	resumed chan struct{}
+}
+
+// execClientPause suspends clients for the given milliseconds
+// CLIENT PAUSE timeout [WRITE | ALL]
+func execClientPause(args [][]byte) resp.Reply {
+	if len(args) != 1 && len(args) != 2 {
+		return reply.MakeArgNumErrReply("client|pause")
+	}
+	timeout, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil || timeout < 0 {
+		return reply.MakeErrReply("ERR timeout is not an integer or out of range")
+	}
+	all := true
+	if len(args) == 2 {
+		switch strings.ToLower(string(args[1])) {
+		case "write":
+			all = false
+		case "all":
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	pauseClients(time.Duration(timeout)*time.Millisecond, all)
+	return reply.MakeOkReply()
+}
+
+// pauseClients keeps the later end time if clients have been paused, the mode is replaced by the new one
+func pauseClients(duration time.Duration, all bool) {
+	clientPause.mu.Lock()
+	defer clientPause.mu.Unlock()
+	end := time.Now().Add(duration)
+	if clientPause.resumed == nil {
+		clientPause.resumed = make(chan struct{})
+		clientPause.end = end
+	} else if end.After(clientPause.end) {
+		clientPause.end = end
+	}
+	clientPause.all = all
+	time.AfterFunc(duration, func() {
+		clientPause.mu.Lock()
+		defer clientPause.mu.Unlock()
+		// pause may be extended by another CLIENT PAUSE, whose timer will resume clients
+		if clientPause.resumed != nil && !time.Now().Before(clientPause.end) {
+			close(clientPause.resumed)
+			clientPause.resumed = nil
+		}
+	})
+}
+
+func unpauseClients() {
+	clientPause.mu.Lock()
+	defer clientPause.mu.Unlock()
+	if clientPause.resumed != nil {
+		close(clientPause.resumed)
+		clientPause.resumed = nil
+	}
+}
+
+// getPauseChan returns a channel closed when pause ends if the command should be paused, otherwise returns nil
+func getPauseChan(c resp.Connection, cmdLine [][]byte) <-chan struct{} {
+	if isInternalConn(c) {
+		return nil
+	}
+	clientPause.mu.Lock()
+	defer clientPause.mu.Unlock()
+	if clientPause.resumed == nil {
+		return nil
+	}
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	if cmdName == "client" {
+		// so that CLIENT UNPAUSE works during pause
+		return nil
+	}
+	if clientPause.all || mayWrite(c, cmdName) {
+		return clientPause.resumed
+	}
+	return nil
+}
+
+// mayWrite returns whether the command may modify data, a transaction may write if any queued command may write
+func mayWrite(c resp.Connection, cmdName string) bool {
+	switch cmdName {
+	case "publish":
+		return true
+	case "exec":
+		if !c.InMultiState() {
+			return false
+		}
+		for _, cmdLine := range c.GetQueuedCmdLine() {
+			if mayWrite(c, strings.ToLower(string(cmdLine[0]))) {
+				return true
+			}
+		}
+		return false
+	}
+	cmd, ok := cmdTable[cmdName]
+	return ok && cmd.flags&flagWrite > 0
+}
+
+// IsClientPaused returns whether the command should wait until clients are resumed by CLIENT UNPAUSE or timeout
+func IsClientPaused(c resp.Connection, cmdLine [][]byte) bool {
+	return getPauseChan(c, cmdLine) != nil
+}
+
+// WaitClientUnpause blocks until the command is allowed to execute
+func WaitClientUnpause(c resp.Connection, cmdLine [][]byte) {
+	atomic.AddInt64(&stats.blockedClients, 1)
+	defer atomic.AddInt64(&stats.blockedClients, -1)
+	for {
+		resumed := getPauseChan(c, cmdLine)
+		if resumed == nil {
+			return
+		}
+		<-resumed
+	}
+}
+
+func init() {
+	registerSpecialCommand("Client", -2, flagAdmin|flagNoScript).
+		attachCategories(aclConnection).
+		attachDocs("connection", "A container for client connection commands.", "2.4.0")
+}
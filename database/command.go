@@ -6,18 +6,211 @@ import (
 
 var cmdTable = make(map[string]*command)
 
+// internalCmdTable holds commands sent between nodes of cluster within transactions,
+// they are neither listed by COMMAND nor executable by clients
+var internalCmdTable = make(map[string]*command)
+
 type command struct {
+	name     string
 	executor ExecFunc
-	arity    int // allow number of args, arity < 0 means len(args) >= -arity
+	prepare  PreFunc  // return related keys command
+	undo     UndoFunc // return undo commands, used by multi and cluster transactions
+	arity    int      // allow number of args, arity < 0 means len(args) >= -arity
+	flags    int      // bit mask of flagWrite, flagReadOnly ...
+
+	// key positions in command line, used by cluster to route commands
+	firstKey int // position of the first key, 0 means the command has no key
+	lastKey  int // position of the last key, negative means counting from the end, -1 is the last arg
+	keyStep  int // step between keys, for example the step of `mset` is 2
+
+	categories []string // acl categories besides the ones derived from flags, without '@'
+
+	// documents for COMMAND DOCS
+	group   string
+	summary string
+	since   string
+}
+
+// command flags, see https://redis.io/commands/command/
+const (
+	flagWrite    = 1 << iota // may modify the keyspace
+	flagReadOnly             // doesn't modify the keyspace
+	flagDenyOOM              // may increase memory usage, rejected when out of memory
+	flagAdmin                // administrative command
+	flagPubSub               // pub/sub related command
+	flagNoScript             // not allowed in scripts
+	flagFast                 // runs in O(1) or O(log(N)) time
+	flagMovable              // movablekeys, keys can't be determined by key positions, they are extracted by prepare function
+)
+
+var flagNames = []string{"write", "readonly", "denyoom", "admin", "pubsub", "noscript", "fast", "movablekeys"}
+
+// acl categories, see https://redis.io/docs/management/security/acl/#command-categories
+const (
+	aclKeyspace    = "keyspace"
+	aclRead        = "read"
+	aclWrite       = "write"
+	aclString      = "string"
+	aclPubSub      = "pubsub"
+	aclAdmin       = "admin"
+	aclFast        = "fast"
+	aclSlow        = "slow"
+	aclDangerous   = "dangerous"
+	aclConnection  = "connection"
+	aclTransaction = "transaction"
+)
+
+// aclCategories lists all acl categories in the order shown by ACL CAT
+var aclCategories = []string{
+	aclKeyspace, aclRead, aclWrite, aclString, aclPubSub, aclAdmin,
+	aclFast, aclSlow, aclDangerous, aclConnection, aclTransaction,
 }
 
 // RegisterCommand registers a new command
 // arity means allowed number of cmdArgs, arity < 0 means len(args) >= -arity.
 // for example: the arity of `get` is 2, `mget` is -2
-func RegisterCommand(name string, executor ExecFunc, arity int) {
+func RegisterCommand(name string, executor ExecFunc, prepare PreFunc, rollback UndoFunc, arity int, flags int) *command {
+	name = strings.ToLower(name)
+	cmd := &command{
+		name:     name,
+		executor: executor,
+		prepare:  prepare,
+		undo:     rollback,
+		arity:    arity,
+		flags:    flags,
+	}
+	cmdTable[name] = cmd
+	return cmd
+}
+
+// registerInternalCommand registers a command which could only be executed by transactions of cluster
+func registerInternalCommand(name string, executor ExecFunc, prepare PreFunc, rollback UndoFunc, arity int, flags int) *command {
 	name = strings.ToLower(name)
-	cmdTable[name] = &command{
+	cmd := &command{
+		name:     name,
 		executor: executor,
+		prepare:  prepare,
+		undo:     rollback,
 		arity:    arity,
+		flags:    flags,
+	}
+	internalCmdTable[name] = cmd
+	return cmd
+}
+
+// lookupCommand returns the registered command or the internal command with the given name
+func lookupCommand(name string) (*command, bool) {
+	if cmd, ok := cmdTable[name]; ok {
+		return cmd, true
+	}
+	cmd, ok := internalCmdTable[name]
+	return cmd, ok
+}
+
+// registerSpecialCommand registers metadata of command which is executed by StandaloneDatabase instead of DB,
+// such as select and multi
+func registerSpecialCommand(name string, arity int, flags int) *command {
+	return RegisterCommand(name, nil, nil, nil, arity, flags)
+}
+
+// attachKeys declares key positions of command, commands without keys don't need to call it
+// for example: `get key` is (1, 1, 1), `mset k1 v1 k2 v2` is (1, -1, 2), `rename src dest` is (1, 2, 1)
+func (cmd *command) attachKeys(firstKey int, lastKey int, keyStep int) *command {
+	cmd.firstKey = firstKey
+	cmd.lastKey = lastKey
+	cmd.keyStep = keyStep
+	return cmd
+}
+
+// attachCategories declares acl categories which can't be derived from flags, such as string and keyspace
+func (cmd *command) attachCategories(categories ...string) *command {
+	cmd.categories = append(cmd.categories, categories...)
+	return cmd
+}
+
+// attachDocs declares documents shown by COMMAND DOCS
+func (cmd *command) attachDocs(group string, summary string, since string) *command {
+	cmd.group = group
+	cmd.summary = summary
+	cmd.since = since
+	return cmd
+}
+
+// getFlagNames returns names of flags
+func (cmd *command) getFlagNames() []string {
+	names := make([]string, 0, len(flagNames))
+	for i, name := range flagNames {
+		if cmd.flags&(1<<i) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// getCategories returns acl categories of command, including the ones derived from flags
+func (cmd *command) getCategories() []string {
+	categories := make([]string, 0, len(cmd.categories)+4)
+	categories = append(categories, cmd.categories...)
+	if cmd.flags&flagWrite > 0 {
+		categories = append(categories, aclWrite)
+	}
+	if cmd.flags&flagReadOnly > 0 {
+		categories = append(categories, aclRead)
+	}
+	if cmd.flags&flagAdmin > 0 {
+		categories = append(categories, aclAdmin, aclDangerous)
+	}
+	if cmd.flags&flagPubSub > 0 {
+		categories = append(categories, aclPubSub)
+	}
+	if cmd.flags&flagFast > 0 {
+		categories = append(categories, aclFast)
+	} else {
+		categories = append(categories, aclSlow)
+	}
+	return categories
+}
+
+// extractKeys returns keys in cmdLine according to key positions
+func (cmd *command) extractKeys(cmdLine [][]byte) []string {
+	if cmd.flags&flagMovable > 0 {
+		writeKeys, readKeys := cmd.prepare(cmdLine[1:])
+		return append(writeKeys, readKeys...)
+	}
+	if cmd.firstKey <= 0 {
+		return nil
+	}
+	last := cmd.lastKey
+	if last < 0 {
+		last = len(cmdLine) + last
+	}
+	step := cmd.keyStep
+	if step <= 0 {
+		step = 1
+	}
+	keys := make([]string, 0, (last-cmd.firstKey)/step+1)
+	for i := cmd.firstKey; i <= last && i < len(cmdLine); i += step {
+		keys = append(keys, string(cmdLine[i]))
+	}
+	return keys
+}
+
+// GetCommandKeys returns keys of the given command line according to key positions declared at registration
+// returns false if the command is not registered
+func GetCommandKeys(cmdLine [][]byte) ([]string, bool) {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		return nil, false
+	}
+	return cmd.extractKeys(cmdLine), true
+}
+
+// ListCommands returns names of all registered commands
+func ListCommands() []string {
+	names := make([]string, 0, len(cmdTable))
+	for name := range cmdTable {
+		names = append(names, name)
 	}
+	return names
 }
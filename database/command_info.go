@@ -0,0 +1,143 @@
+package database
+
+import (
+	"goRedis/interface/resp"
+	"goRedis/resp/reply"
+	"sort"
+	"strings"
+)
+
+// execCommand returns metadata of registered commands, so that clients can introspect the server
+// COMMAND [COUNT | INFO [name ...] | GETKEYS cmd args... | DOCS [name ...]]
+func execCommand(db *DB, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return makeCommandInfoList(sortedCommands())
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "count":
+		if len(args) != 1 {
+			return reply.MakeErrReply("ERR wrong number of arguments for 'command|count' command")
+		}
+		return reply.MakeIntReply(int64(len(cmdTable)))
+	case "info":
+		if len(args) == 1 {
+			return makeCommandInfoList(sortedCommands())
+		}
+		replies := make([]resp.Reply, 0, len(args)-1)
+		for _, name := range args[1:] {
+			cmd, ok := cmdTable[strings.ToLower(string(name))]
+			if !ok {
+				replies = append(replies, reply.MakeNullBulkReply())
+				continue
+			}
+			replies = append(replies, makeCommandInfo(cmd))
+		}
+		return reply.MakeMultiRawReply(replies)
+	case "getkeys":
+		if len(args) < 2 {
+			return reply.MakeErrReply("ERR wrong number of arguments for 'command|getkeys' command")
+		}
+		return execCommandGetKeys(args[1:])
+	case "docs":
+		var cmds []*command
+		if len(args) == 1 {
+			cmds = sortedCommands()
+		} else {
+			for _, name := range args[1:] {
+				if cmd, ok := cmdTable[strings.ToLower(string(name))]; ok {
+					cmds = append(cmds, cmd)
+				}
+			}
+		}
+		return makeCommandDocs(cmds)
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try COMMAND HELP.")
+}
+
+// execCommandGetKeys extracts keys from a full command line
+func execCommandGetKeys(cmdLine [][]byte) resp.Reply {
+	cmd, ok := cmdTable[strings.ToLower(string(cmdLine[0]))]
+	if !ok {
+		return reply.MakeErrReply("ERR Invalid command specified")
+	}
+	if !validateArity(cmd.arity, cmdLine) {
+		return reply.MakeErrReply("ERR Invalid number of arguments specified for command")
+	}
+	keys := cmd.extractKeys(cmdLine)
+	if len(keys) == 0 {
+		return reply.MakeErrReply("ERR The command has no key arguments")
+	}
+	result := make([][]byte, len(keys))
+	for i, key := range keys {
+		result[i] = []byte(key)
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// sortedCommands returns all registered commands ordered by name
+func sortedCommands() []*command {
+	cmds := make([]*command, 0, len(cmdTable))
+	for _, cmd := range cmdTable {
+		cmds = append(cmds, cmd)
+	}
+	sort.Slice(cmds, func(i, j int) bool {
+		return cmds[i].name < cmds[j].name
+	})
+	return cmds
+}
+
+func makeCommandInfoList(cmds []*command) resp.Reply {
+	replies := make([]resp.Reply, len(cmds))
+	for i, cmd := range cmds {
+		replies[i] = makeCommandInfo(cmd)
+	}
+	return reply.MakeMultiRawReply(replies)
+}
+
+// makeCommandInfo returns the reply of COMMAND INFO for a single command, the same layout as redis 7:
+// name, arity, flags, first key, last key, key step, acl categories, tips, key specs, subcommands
+func makeCommandInfo(cmd *command) resp.Reply {
+	flags := cmd.getFlagNames()
+	flagReplies := make([]resp.Reply, len(flags))
+	for i, flag := range flags {
+		flagReplies[i] = reply.MakeStatusReply(flag)
+	}
+	categories := cmd.getCategories()
+	categoryReplies := make([]resp.Reply, len(categories))
+	for i, category := range categories {
+		categoryReplies[i] = reply.MakeStatusReply("@" + category)
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(cmd.name)),
+		reply.MakeIntReply(int64(cmd.arity)),
+		reply.MakeSetReply(flagReplies),
+		reply.MakeIntReply(int64(cmd.firstKey)),
+		reply.MakeIntReply(int64(cmd.lastKey)),
+		reply.MakeIntReply(int64(cmd.keyStep)),
+		reply.MakeSetReply(categoryReplies),
+		reply.MakeEmptyMultiBulkReply(), // tips
+		reply.MakeEmptyMultiBulkReply(), // key specs
+		reply.MakeEmptyMultiBulkReply(), // subcommands
+	})
+}
+
+// makeCommandDocs returns the reply of COMMAND DOCS, a map from command name to its documents
+func makeCommandDocs(cmds []*command) resp.Reply {
+	replies := make([]resp.Reply, 0, 2*len(cmds))
+	for _, cmd := range cmds {
+		docs := reply.MakeMapReply([]resp.Reply{
+			reply.MakeBulkReply([]byte("summary")), reply.MakeBulkReply([]byte(cmd.summary)),
+			reply.MakeBulkReply([]byte("since")), reply.MakeBulkReply([]byte(cmd.since)),
+			reply.MakeBulkReply([]byte("group")), reply.MakeBulkReply([]byte(cmd.group)),
+		})
+		replies = append(replies, reply.MakeBulkReply([]byte(cmd.name)), docs)
+	}
+	return reply.MakeMapReply(replies)
+}
+
+func init() {
+	RegisterCommand("Command", execCommand, noPrepare, nil, -1, 0).
+		attachCategories(aclConnection).
+		attachDocs("server", "Returns detailed information about all commands.", "2.8.13")
+}
@@ -0,0 +1,252 @@
+package database
+
+import (
+	"errors"
+	"goRedis/aof"
+	"goRedis/config"
+	"goRedis/interface/resp"
+	"goRedis/lib/wildcard"
+	"goRedis/resp/connection"
+	"goRedis/resp/reply"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// mutableConfig describes a config which could be changed by CONFIG SET
+type mutableConfig struct {
+	// check validates value before any config is changed, nil means any value parsed by config is valid
+	check func(value string) error
+	// apply makes the new value take effect, it is invoked after the config is changed
+	apply func(mdb *StandaloneDatabase) error
+}
+
+// mutableConfigs are configs which could be changed at runtime, others require restart
+var mutableConfigs = map[string]*mutableConfig{
+	"appendonly": {
+		apply: func(mdb *StandaloneDatabase) error {
+			return mdb.setAppendOnly(config.Properties().AppendOnly)
+		},
+	},
+	"appendfsync": {
+		// aof goroutine reads it for each write
+		check: func(value string) error {
+			switch strings.ToLower(value) {
+			case aof.FsyncAlways, aof.FsyncEverySec, aof.FsyncNo:
+				return nil
+			}
+			return errors.New("argument(s) must be one of the following: always, everysec, no")
+		},
+	},
+	"requirepass": {
+		apply: func(mdb *StandaloneDatabase) error {
+			// requirepass is an alias of the password of default user
+			rules := []string{"resetpass", "nopass"}
+			if config.Properties().RequirePass != "" {
+				rules = []string{"resetpass", ">" + config.Properties().RequirePass}
+			}
+			return setAclUser(defaultUser, rules)
+		},
+	},
+	"masterauth": {},
+	"masteruser": {},
+	"timeout": {
+		check: checkNonNegative,
+	},
+	"slowlog-log-slower-than": {},
+	"slowlog-max-len": {
+		check: checkNonNegative,
+	},
+	"notify-keyspace-events": {
+		check: func(value string) error {
+			_, err := parseNotifyFlags(value)
+			return err
+		},
+		apply: func(mdb *StandaloneDatabase) error {
+			return setNotifyFlags(config.Properties().NotifyKeyspaceEvents)
+		},
+	},
+	"maxmemory": {
+		// keys are evicted before the next command
+		check: checkNonNegative,
+	},
+	"maxmemory-policy": {
+		check: func(value string) error {
+			if !evictionPolicies[strings.ToLower(value)] {
+				return errors.New("argument(s) must be one of the following: " +
+					"volatile-lru, allkeys-lru, volatile-lfu, allkeys-lfu, volatile-random, allkeys-random, volatile-ttl, noeviction")
+			}
+			return nil
+		},
+	},
+	"maxmemory-samples": {
+		check: func(value string) error {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err == nil && (n < 1 || n > 64) {
+				return errors.New("argument must be between 1 and 64 inclusive")
+			}
+			return nil
+		},
+	},
+	"lfu-log-factor": {
+		check: checkNonNegative,
+	},
+	"lfu-decay-time": {
+		check: checkNonNegative,
+	},
+	"proto-max-bulk-len": {
+		// new value takes effect on new connections
+		check: func(value string) error {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err == nil && n < 1024*1024 {
+				return errors.New("argument must be at least 1mb")
+			}
+			return nil
+		},
+	},
+}
+
+func checkNonNegative(value string) error {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err == nil && n < 0 {
+		return errors.New("argument must be a non-negative integer")
+	}
+	return nil
+}
+
+// ExecConfig executes CONFIG subcommands, configs are stored in local node even in cluster mode
+func (mdb *StandaloneDatabase) ExecConfig(args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("config")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	args = args[1:]
+	switch subCmd {
+	case "get":
+		if len(args) == 0 {
+			return reply.MakeArgNumErrReply("config|get")
+		}
+		return execConfigGet(args)
+	case "set":
+		if len(args) == 0 || len(args)%2 != 0 {
+			return reply.MakeArgNumErrReply("config|set")
+		}
+		return mdb.execConfigSet(args)
+	case "rewrite":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("config|rewrite")
+		}
+		if err := config.RewriteConfig(); err != nil {
+			return reply.MakeErrReply("ERR " + err.Error())
+		}
+		return reply.MakeOkReply()
+	case "resetstat":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("config|resetstat")
+		}
+		stats.reset()
+		connection.ResetStats()
+		return reply.MakeOkReply()
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try CONFIG HELP.")
+}
+
+// execConfigGet returns configs matching any of the glob patterns
+// CONFIG GET parameter [parameter ...]
+func execConfigGet(patterns [][]byte) resp.Reply {
+	matchers := make([]*wildcard.Pattern, len(patterns))
+	for i, pattern := range patterns {
+		matchers[i] = wildcard.CompilePattern(strings.ToLower(string(pattern)))
+	}
+	var pairs []resp.Reply
+	for _, name := range config.ListConfigNames() {
+		for _, matcher := range matchers {
+			if matcher.IsMatch(name) {
+				value, _ := config.GetConfig(name)
+				pairs = append(pairs, reply.MakeBulkReply([]byte(name)), reply.MakeBulkReply([]byte(value)))
+				break
+			}
+		}
+	}
+	return reply.MakeMapReply(pairs)
+}
+
+// configSetMu serializes CONFIG SET, so that a concurrent one can't interleave with reverting configs
+var configSetMu sync.Mutex
+
+// execConfigSet sets configs atomically, if any of them failed, all of them are reverted
+// CONFIG SET parameter value [parameter value ...]
+func (mdb *StandaloneDatabase) execConfigSet(args [][]byte) resp.Reply {
+	configSetMu.Lock()
+	defer configSetMu.Unlock()
+	names := make([]string, 0, len(args)/2)
+	values := make([]string, 0, len(args)/2)
+	seen := make(map[string]bool)
+	for i := 0; i < len(args); i += 2 {
+		name := strings.ToLower(string(args[i]))
+		value := string(args[i+1])
+		if _, ok := config.GetConfig(name); !ok {
+			return reply.MakeErrReply("ERR Unknown option or number of arguments for CONFIG SET - '" + name + "'")
+		}
+		mutable, ok := mutableConfigs[name]
+		if !ok {
+			return makeConfigSetErrReply(name, "can't set immutable config")
+		}
+		if seen[name] {
+			return makeConfigSetErrReply(name, "duplicate parameter")
+		}
+		seen[name] = true
+		if mutable.check != nil {
+			if err := mutable.check(value); err != nil {
+				return makeConfigSetErrReply(name, err.Error())
+			}
+		}
+		names = append(names, name)
+		values = append(values, value)
+	}
+
+	oldValues := make([]string, len(names))
+	for i, name := range names {
+		oldValues[i], _ = config.GetConfig(name)
+	}
+	for i, name := range names {
+		if err := config.SetConfig(name, values[i]); err != nil {
+			mdb.revertConfigs(names[:i], oldValues, false)
+			return makeConfigSetErrReply(name, err.Error())
+		}
+	}
+	for i, name := range names {
+		apply := mutableConfigs[name].apply
+		if apply == nil {
+			continue
+		}
+		if err := apply(mdb); err != nil {
+			// the side effect of the failed config doesn't happen, only previous configs need to be applied again
+			_ = config.SetConfig(name, oldValues[i])
+			mdb.revertConfigs(names[:i], oldValues, true)
+			mdb.revertConfigs(names[i+1:], oldValues[i+1:], false)
+			return makeConfigSetErrReply(name, err.Error())
+		}
+	}
+	return reply.MakeOkReply()
+}
+
+// revertConfigs restores configs to old values, side effects are applied again if reapply is true
+func (mdb *StandaloneDatabase) revertConfigs(names []string, oldValues []string, reapply bool) {
+	for i, name := range names {
+		_ = config.SetConfig(name, oldValues[i])
+		if apply := mutableConfigs[name].apply; reapply && apply != nil {
+			_ = apply(mdb)
+		}
+	}
+}
+
+func makeConfigSetErrReply(name string, reason string) resp.Reply {
+	return reply.MakeErrReply("ERR CONFIG SET failed (possibly related to argument '" + name + "') - " + reason)
+}
+
+func init() {
+	registerSpecialCommand("Config", -2, flagAdmin|flagNoScript).
+		attachCategories(aclDangerous).
+		attachDocs("server", "A container for server configuration commands.", "2.0.0")
+}
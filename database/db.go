@@ -6,32 +6,47 @@ import (
 	"goRedis/interface/resp"
 	"goRedis/resp/reply"
 	"strings"
+	"sync/atomic"
 )
 
 const (
-	dataDictSize = 1 << 16
+	// dataDictSize is the number of shard locks of a db, the hash table grows from it with the number of keys
+	dataDictSize = 1 << 10
 )
 
 // DB store data and execute user's commands
 type DB struct {
 	index  int
-	data   dict.Dict
+	data   *dict.ConcurrentDict
 	addAof func(CmdLine)
+	// notify publishes keyspace events, such as `set` of string commands
+	notify func(class int32, event string, key string)
+	// usedMemory is the estimated memory of keys and values in bytes, accessed atomically
+	usedMemory int64
 }
 
 // ExecFunc is interface for command executor
 // arg don't include cmd line
 type ExecFunc func(db *DB, args [][]byte) resp.Reply
 
+// PreFunc analyses command line when queued command to `multi`
+// returns related write keys and read keys
+type PreFunc func(args [][]byte) ([]string, []string)
+
 // CmdLine is alias for [][]byte,represents a command line
 type CmdLine = [][]byte
 
+// UndoFunc returns undo logs for the given command line
+// execute from head to tail when undo
+type UndoFunc func(db *DB, args [][]byte) []CmdLine
+
 // makeDB create DB instance
 func makeDB() *DB {
 	db := &DB{
 		//data: dict.MakeSyncDict(),
 		data:   dict.MakeConcurrent(dataDictSize),
 		addAof: func(line CmdLine) {},
+		notify: func(class int32, event string, key string) {},
 	}
 	return db
 }
@@ -40,15 +55,35 @@ func makeDB() *DB {
 func (db *DB) Exec(c resp.Connection, cmdLine [][]byte) resp.Reply {
 	cmdName := strings.ToLower(string(cmdLine[0]))
 	cmd, ok := cmdTable[cmdName] // 这里是一个注册的函数表，根据命令名字获取对应的函数
-	if !ok {
+	if !ok || cmd.executor == nil {
 		return reply.MakeErrReply("ERR unknown command '" + cmdName + "'")
 	}
 	if !validateArity(cmd.arity, cmdLine) { // 验证这个命令的参数个数，arity为期望的参数，
 		return reply.MakeArgNumErrReply(cmdName)
 	}
+	// commands without prepare lock keys by themselves, such as SCAN
+	var write, read []string
+	if cmd.prepare != nil {
+		write, read = cmd.prepare(cmdLine[1:])
+	}
+	db.RWLocks(write, read) // 给相关的key加锁，执行器内部不再加锁
+	defer db.RWUnLocks(write, read)
 	fun := cmd.executor // 获取的函数的执行器
 	return fun(db, cmdLine[1:])
+}
 
+// execWithLock executes normal commands, invoker should provide locks
+func (db *DB) execWithLock(cmdLine [][]byte) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := lookupCommand(cmdName)
+	if !ok || cmd.executor == nil {
+		return reply.MakeErrReply("ERR unknown command '" + cmdName + "'")
+	}
+	if !validateArity(cmd.arity, cmdLine) {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	fun := cmd.executor
+	return fun(db, cmdLine[1:])
 }
 
 func validateArity(arity int, cmdArgs [][]byte) bool {
@@ -62,41 +97,77 @@ func validateArity(arity int, cmdArgs [][]byte) bool {
 /* ---- data Access ----- */
 
 // GetEntity returns DataEntity bind to given key
+// invoker should hold the lock of key
 func (db *DB) GetEntity(key string) (*database.DataEntity, bool) {
 
-	raw, ok := db.data.Get(key)
+	raw, ok := db.data.GetWithLock(key)
 	if !ok {
 		return nil, false
 	}
 	entity, _ := raw.(*database.DataEntity)
+	touchEntity(entity)
 	return entity, true
 }
 
 // PutEntity a DataEntity into DB
 func (db *DB) PutEntity(key string, entity *database.DataEntity) int {
-	return db.data.Put(key, entity)
+	initEntityClock(entity)
+	old, _ := db.data.GetWithLock(key)
+	result := db.data.PutWithLock(key, entity)
+	db.updateUsedMemory(key, old, entity)
+	if result > 0 {
+		db.notify(notifyNew, "new", key)
+	}
+	return result
 }
 
 // PutIfExists edit an existing DataEntity
 func (db *DB) PutIfExists(key string, entity *database.DataEntity) int {
-	return db.data.PutIfExists(key, entity)
+	initEntityClock(entity)
+	old, _ := db.data.GetWithLock(key)
+	result := db.data.PutIfExistsWithLock(key, entity)
+	if result > 0 {
+		db.updateUsedMemory(key, old, entity)
+	}
+	return result
 }
 
 // PutIfAbsent insert an DataEntity only if the key not exists
 func (db *DB) PutIfAbsent(key string, entity *database.DataEntity) int {
-	return db.data.PutIfAbsent(key, entity)
+	initEntityClock(entity)
+	result := db.data.PutIfAbsentWithLock(key, entity)
+	if result > 0 {
+		db.updateUsedMemory(key, nil, entity)
+		db.notify(notifyNew, "new", key)
+	}
+	return result
 }
 
 // Remove the given key from db
 func (db *DB) Remove(key string) {
-	db.data.Remove(key)
+	old, result := db.data.RemoveWithLock(key)
+	if result > 0 {
+		db.updateUsedMemory(key, old, nil)
+	}
+}
+
+// updateUsedMemory updates estimated memory after the value of key is changed from old to new, nil means absent
+func (db *DB) updateUsedMemory(key string, old interface{}, new interface{}) {
+	var delta int64
+	if entity, ok := old.(*database.DataEntity); ok && entity != nil {
+		delta -= estimateEntitySize(key, entity)
+	}
+	if entity, ok := new.(*database.DataEntity); ok && entity != nil {
+		delta += estimateEntitySize(key, entity)
+	}
+	atomic.AddInt64(&db.usedMemory, delta)
 }
 
 // Removes the given keys from db
 func (db *DB) Removes(keys ...string) (deleted int) {
 	deleted = 0
 	for _, key := range keys {
-		_, exists := db.data.Get(key)
+		_, exists := db.data.GetWithLock(key)
 		if exists {
 			db.Remove(key)
 			deleted++
@@ -105,8 +176,22 @@ func (db *DB) Removes(keys ...string) (deleted int) {
 	return deleted
 }
 
-// Flush clean database
+// Flush clean database, writers are blocked until keys and used memory are both reset
 func (db *DB) Flush() {
-	db.data.Clear()
+	db.data.LockAll()
+	defer db.data.UnLockAll()
+	db.data.ClearWithLock()
+	atomic.StoreInt64(&db.usedMemory, 0)
+}
+
+/* ---- Lock Function ----- */
+
+// RWLocks lock keys for writing and reading
+func (db *DB) RWLocks(writeKeys []string, readKeys []string) {
+	db.data.RWLocks(writeKeys, readKeys)
+}
 
+// RWUnLocks unlock keys for writing and reading
+func (db *DB) RWUnLocks(writeKeys []string, readKeys []string) {
+	db.data.RWUnLocks(writeKeys, readKeys)
 }
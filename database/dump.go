@@ -0,0 +1,140 @@
+package database
+
+import (
+	"goRedis/aof"
+	"goRedis/interface/database"
+	"goRedis/interface/resp"
+	"goRedis/lib/rdb"
+	"goRedis/lib/utils"
+	"goRedis/resp/reply"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// execDump serializes value of key in the format of redis DUMP, so it can be restored by redis or goRedis
+// DUMP key
+func execDump(db *DB, args [][]byte) resp.Reply {
+	entity, exists := db.GetEntity(string(args[0]))
+	if !exists {
+		return reply.MakeNullBulkReply()
+	}
+	payload, err := rdb.MakeDumpPayload(entity.Data)
+	if err != nil {
+		return reply.MakeErrReply("ERR " + err.Error())
+	}
+	return reply.MakeBulkReply(payload)
+}
+
+// restoreOptions are options of RESTORE, negative idle and freq mean not given
+type restoreOptions struct {
+	replace bool
+	absTTL  bool
+	idle    int64
+	freq    int64
+}
+
+func parseRestoreOptions(args [][]byte) (*restoreOptions, resp.Reply) {
+	opts := &restoreOptions{idle: -1, freq: -1}
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "replace":
+			opts.replace = true
+		case "absttl":
+			opts.absTTL = true
+		case "idletime":
+			// IDLETIME and FREQ are exclusive
+			if i+1 >= len(args) || opts.freq >= 0 {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			idle, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if idle < 0 {
+				return nil, reply.MakeErrReply("ERR Invalid IDLETIME value, must be >= 0")
+			}
+			opts.idle = idle
+			i++
+		case "freq":
+			if i+1 >= len(args) || opts.idle >= 0 {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			freq, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if freq < 0 || freq > lfuMaxVal {
+				return nil, reply.MakeErrReply("ERR Invalid FREQ value, must be >= 0 and <= 255")
+			}
+			opts.freq = freq
+			i++
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+	}
+	return opts, nil
+}
+
+// execRestore creates key from payload of DUMP. goRedis doesn't support expiration,
+// so ttl must be 0 unless it is an ABSTTL in the past, which means the key has expired and won't be created
+// RESTORE key ttl serialized-value [REPLACE] [ABSTTL] [IDLETIME seconds] [FREQ frequency]
+func execRestore(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	opts, errReply := parseRestoreOptions(args[3:])
+	if errReply != nil {
+		return errReply
+	}
+	if _, exists := db.GetEntity(key); exists && !opts.replace {
+		return reply.MakeErrReply("BUSYKEY Target key name already exists.")
+	}
+	ttl, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if ttl < 0 {
+		return reply.MakeErrReply("ERR Invalid TTL value, must be >= 0")
+	}
+	value, err := rdb.ParseDumpPayload(args[2])
+	if err == rdb.ErrVersionOrChecksum {
+		return reply.MakeErrReply("ERR " + err.Error())
+	} else if err != nil {
+		return reply.MakeErrReply("ERR " + rdb.ErrBadDataFormat.Error())
+	}
+	expired := ttl > 0 && opts.absTTL && ttl <= time.Now().UnixMilli()
+	if ttl > 0 && !expired {
+		return reply.MakeErrReply("ERR goRedis doesn't support key expiration, TTL must be 0")
+	}
+
+	deleted := false
+	if opts.replace {
+		deleted = db.Removes(key) > 0
+	}
+	if expired {
+		if deleted {
+			db.addAof(utils.ToCmdLine("del", key))
+			db.notify(notifyGeneric, "del", key)
+		}
+		return reply.MakeOkReply()
+	}
+	entity := &database.DataEntity{Data: value}
+	db.PutEntity(key, entity)
+	restoreEntityClock(entity, opts.idle, opts.freq)
+	if deleted {
+		db.addAof(utils.ToCmdLine("del", key))
+	}
+	db.addAof(aof.EntityToCmd(key, entity).Args)
+	db.notify(notifyGeneric, "restore", key)
+	return reply.MakeOkReply()
+}
+
+func init() {
+	RegisterCommand("Dump", execDump, readFirstKey, nil, 2, flagReadOnly).
+		attachKeys(1, 1, 1).
+		attachCategories(aclKeyspace).
+		attachDocs("generic", "Returns a serialized representation of the value stored at a key.", "2.6.0")
+	RegisterCommand("Restore", execRestore, writeFirstKey, rollbackFirstKey, -4, flagWrite|flagDenyOOM).
+		attachKeys(1, 1, 1).
+		attachCategories(aclKeyspace, aclDangerous).
+		attachDocs("generic", "Creates a key from the serialized representation of a value.", "2.6.0")
+}
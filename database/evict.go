@@ -0,0 +1,336 @@
+package database
+
+import (
+	"goRedis/config"
+	"goRedis/interface/database"
+	"goRedis/interface/resp"
+	"goRedis/lib/utils"
+	"goRedis/resp/connection"
+	"goRedis/resp/reply"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// eviction policies of maxmemory-policy, see https://redis.io/docs/reference/eviction/
+const (
+	policyNoEviction     = "noeviction"
+	policyAllKeysLRU     = "allkeys-lru"
+	policyAllKeysLFU     = "allkeys-lfu"
+	policyAllKeysRandom  = "allkeys-random"
+	policyVolatileLRU    = "volatile-lru"
+	policyVolatileLFU    = "volatile-lfu"
+	policyVolatileRandom = "volatile-random"
+	policyVolatileTTL    = "volatile-ttl"
+)
+
+var evictionPolicies = map[string]bool{
+	policyNoEviction: true, policyAllKeysLRU: true, policyAllKeysLFU: true, policyAllKeysRandom: true,
+	policyVolatileLRU: true, policyVolatileLFU: true, policyVolatileRandom: true, policyVolatileTTL: true,
+}
+
+const (
+	lruClockMax = 1<<24 - 1 // LRU clock is 24 bits in seconds, like redis
+	lfuInitVal  = 5         // counter of new keys, so that they are not evicted immediately
+	lfuMaxVal   = 255
+
+	evictionPoolSize      = 16
+	defaultEvictionSample = 5
+)
+
+var oomReply = reply.MakeErrReply("OOM command not allowed when used memory > 'maxmemory'.")
+
+func getEvictionPolicy() string {
+	policy := strings.ToLower(config.Properties().MaxMemoryPolicy)
+	if !evictionPolicies[policy] {
+		return policyNoEviction
+	}
+	return policy
+}
+
+func isLFUPolicy(policy string) bool {
+	return policy == policyAllKeysLFU || policy == policyVolatileLFU
+}
+
+/* ---- access clocks ---- */
+
+func lruClock() uint32 {
+	return uint32(time.Now().Unix()) & lruClockMax
+}
+
+// lruIdle returns seconds since the last access, clock wraps around about every 194 days
+func lruIdle(clock uint32) uint32 {
+	now := lruClock()
+	if now >= clock {
+		return now - clock
+	}
+	return now + lruClockMax - clock
+}
+
+// LFU clock holds the last decrement time in minutes in the high 16 bits and a logarithmic counter in the low 8 bits
+func lfuMinutes() uint32 {
+	return uint32(time.Now().Unix()/60) & 0xffff
+}
+
+// lfuDecr returns counter decreased by the number of lfu-decay-time periods since the last decrement
+func lfuDecr(clock uint32) uint32 {
+	ldt := clock >> 8
+	counter := clock & 0xff
+	decayTime := config.Properties().LfuDecayTime
+	if decayTime <= 0 {
+		return counter
+	}
+	now := lfuMinutes()
+	elapsed := now - ldt
+	if now < ldt {
+		elapsed = 0xffff - ldt + now
+	}
+	periods := elapsed / uint32(decayTime)
+	if periods >= counter {
+		return 0
+	}
+	return counter - periods
+}
+
+// lfuLogIncr increases counter with probability 1/((counter-lfuInitVal)*lfu-log-factor+1)
+func lfuLogIncr(counter uint32) uint32 {
+	if counter >= lfuMaxVal {
+		return lfuMaxVal
+	}
+	base := float64(counter) - lfuInitVal
+	if base < 0 {
+		base = 0
+	}
+	if rand.Float64() < 1.0/(base*float64(config.Properties().LfuLogFactor)+1) {
+		counter++
+	}
+	return counter
+}
+
+// initEntityClock initializes clock of new entity
+func initEntityClock(entity *database.DataEntity) {
+	if entity == nil || atomic.LoadUint32(&entity.Clock) != 0 {
+		return
+	}
+	if isLFUPolicy(getEvictionPolicy()) {
+		atomic.StoreUint32(&entity.Clock, lfuMinutes()<<8|lfuInitVal)
+	} else {
+		atomic.StoreUint32(&entity.Clock, lruClock())
+	}
+}
+
+// touchEntity updates clock of entity when it is accessed, readers of the same key may touch it concurrently
+func touchEntity(entity *database.DataEntity) {
+	if entity == nil {
+		return
+	}
+	if isLFUPolicy(getEvictionPolicy()) {
+		counter := lfuLogIncr(lfuDecr(atomic.LoadUint32(&entity.Clock)))
+		atomic.StoreUint32(&entity.Clock, lfuMinutes()<<8|counter)
+	} else {
+		atomic.StoreUint32(&entity.Clock, lruClock())
+	}
+}
+
+// restoreEntityClock sets clock of entity created by RESTORE with IDLETIME or FREQ, negative value means not given.
+// like redis, FREQ takes effect only with LFU policies and IDLETIME only with other policies
+func restoreEntityClock(entity *database.DataEntity, idle int64, freq int64) {
+	if isLFUPolicy(getEvictionPolicy()) {
+		if freq >= 0 {
+			atomic.StoreUint32(&entity.Clock, lfuMinutes()<<8|uint32(freq))
+		}
+		return
+	}
+	if idle >= 0 {
+		if idle > lruClockMax {
+			idle = lruClockMax
+		}
+		now := int64(lruClock())
+		clock := now - idle
+		if clock < 0 {
+			clock += lruClockMax
+		}
+		atomic.StoreUint32(&entity.Clock, uint32(clock))
+	}
+}
+
+// evictionScore returns the priority of eviction, keys with higher score are evicted first
+func evictionScore(policy string, entity *database.DataEntity) uint32 {
+	clock := atomic.LoadUint32(&entity.Clock)
+	if isLFUPolicy(policy) {
+		return lfuMaxVal - lfuDecr(clock)
+	}
+	return lruIdle(clock)
+}
+
+/* ---- eviction ---- */
+
+type evictionCandidate struct {
+	dbIndex int
+	key     string
+	score   uint32
+}
+
+// evictor samples keys and keeps the best candidates across rounds like the eviction pool of redis
+type evictor struct {
+	mu     sync.Mutex
+	pool   []*evictionCandidate // sorted by score ascending
+	nextDB int                  // round robin of allkeys-random
+}
+
+// freeMemoryIfNeeded evicts keys until used memory is under maxmemory, returns false if it is still over maxmemory.
+// goRedis has no ttl, so no key is volatile and volatile policies can't evict anything, the same as redis without expires
+func (mdb *StandaloneDatabase) freeMemoryIfNeeded() bool {
+	maxMemory := int64(config.Properties().MaxMemory)
+	if maxMemory <= 0 || mdb.getUsedMemory() <= maxMemory {
+		return true
+	}
+	policy := getEvictionPolicy()
+	switch policy {
+	case policyAllKeysLRU, policyAllKeysLFU, policyAllKeysRandom:
+	default:
+		return false
+	}
+	e := mdb.evictor
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for mdb.getUsedMemory() > maxMemory {
+		var evicted bool
+		if policy == policyAllKeysRandom {
+			evicted = mdb.evictRandom()
+		} else {
+			evicted = mdb.evictFromPool(policy)
+		}
+		if !evicted {
+			return false
+		}
+	}
+	return true
+}
+
+// checkMaxMemory evicts keys before executing command, commands which may increase memory are rejected if evicting failed
+func (mdb *StandaloneDatabase) checkMaxMemory(c resp.Connection, cmdName string) resp.Reply {
+	if config.Properties().MaxMemory <= 0 {
+		return nil
+	}
+	if _, ok := c.(*connection.FakeConn); ok {
+		return nil // don't evict when loading aof
+	}
+	if mdb.freeMemoryIfNeeded() {
+		return nil
+	}
+	denyOOM := false
+	if cmd, ok := cmdTable[cmdName]; ok && cmd.flags&flagDenyOOM > 0 {
+		denyOOM = true
+	}
+	if cmdName == "exec" && c.InMultiState() {
+		for _, cmdLine := range c.GetQueuedCmdLine() {
+			if cmd, ok := cmdTable[strings.ToLower(string(cmdLine[0]))]; ok && cmd.flags&flagDenyOOM > 0 {
+				denyOOM = true
+				break
+			}
+		}
+		if denyOOM {
+			// the transaction is discarded like redis
+			c.ClearQueuedCmds()
+			c.SetMultiState(false)
+			return oomReply
+		}
+	}
+	if !denyOOM {
+		return nil
+	}
+	if c.InMultiState() {
+		c.AddTxError(oomReply)
+	}
+	return oomReply
+}
+
+func (mdb *StandaloneDatabase) evictRandom() bool {
+	e := mdb.evictor
+	for i := 0; i < len(mdb.dbSet); i++ {
+		db := mdb.dbSet[(e.nextDB+i)%len(mdb.dbSet)]
+		if db.data.Len() == 0 {
+			continue
+		}
+		var key string
+		db.data.TrySample(1, func(k string, val interface{}) {
+			key = k
+		})
+		if key != "" && mdb.evictKey(db, key) {
+			e.nextDB = (db.index + 1) % len(mdb.dbSet)
+			return true
+		}
+	}
+	return false
+}
+
+// evictFromPool samples keys of all databases into pool, and evicts the candidate with the highest score
+func (mdb *StandaloneDatabase) evictFromPool(policy string) bool {
+	e := mdb.evictor
+	samples := config.Properties().MaxMemorySamples
+	if samples <= 0 {
+		samples = defaultEvictionSample
+	}
+	for _, db := range mdb.dbSet {
+		if db.data.Len() == 0 {
+			continue
+		}
+		// keys locked by other goroutines are neither sampled nor evicted, so that eviction never waits for them
+		db.data.TrySample(samples, func(key string, raw interface{}) {
+			if entity, _ := raw.(*database.DataEntity); entity != nil {
+				e.addCandidate(&evictionCandidate{dbIndex: db.index, key: key, score: evictionScore(policy, entity)})
+			}
+		})
+	}
+	// the best candidate may be deleted or evicted by other goroutine, or locked
+	for len(e.pool) > 0 {
+		best := e.pool[len(e.pool)-1]
+		e.pool = e.pool[:len(e.pool)-1]
+		if mdb.evictKey(mdb.dbSet[best.dbIndex], best.key) {
+			return true
+		}
+	}
+	return false
+}
+
+// addCandidate inserts candidate into pool, the candidate with the lowest score is dropped if pool is full
+func (e *evictor) addCandidate(candidate *evictionCandidate) {
+	for i, c := range e.pool {
+		if c.dbIndex == candidate.dbIndex && c.key == candidate.key {
+			e.pool[i] = candidate // update score
+			sort.Slice(e.pool, func(i, j int) bool { return e.pool[i].score < e.pool[j].score })
+			return
+		}
+	}
+	if len(e.pool) >= evictionPoolSize {
+		if candidate.score <= e.pool[0].score {
+			return
+		}
+		e.pool = e.pool[1:]
+	}
+	i := sort.Search(len(e.pool), func(i int) bool { return e.pool[i].score >= candidate.score })
+	e.pool = append(e.pool, nil)
+	copy(e.pool[i+1:], e.pool[i:])
+	e.pool[i] = candidate
+}
+
+// evictKey removes key and propagates deletion to aof, returns false if the key doesn't exist or is locked.
+// the evictor lock is held by invoker, waiting for a key locked by a transaction would block all clients
+func (mdb *StandaloneDatabase) evictKey(db *DB, key string) bool {
+	if !db.data.TryLockKey(key) {
+		return false
+	}
+	defer db.data.UnLockKey(key)
+	if _, exists := db.data.GetWithLock(key); !exists {
+		return false
+	}
+	db.Remove(key)
+	db.addAof(utils.ToCmdLine("del", key))
+	db.notify(notifyEvicted, "evicted", key)
+	atomic.AddInt64(&stats.evictedKeys, 1)
+	return true
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"goRedis/config"
+	"goRedis/interface/resp"
+	"goRedis/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// Hello switches RESP version of connection and returns information of server
+// HELLO [protover [AUTH username password] [SETNAME clientname]]
+func Hello(c resp.Connection, args [][]byte) resp.Reply {
+	protocol := c.GetProtocol()
+	if len(args) > 0 {
+		version, err := strconv.Atoi(string(args[0]))
+		if err != nil {
+			return reply.MakeErrReply("ERR Protocol version is not an integer or out of range")
+		}
+		if version != 2 && version != 3 {
+			return reply.MakeErrReply("NOPROTO unsupported protocol version")
+		}
+		protocol = version
+	}
+	authenticated := false
+	name, setName := "", false
+	for i := 1; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		if option == "auth" && i+2 < len(args) {
+			if errReply := Auth(c, args[i+1:i+3]); !reply.IsOKReply(errReply) {
+				return errReply
+			}
+			authenticated = true
+			i += 2
+			continue
+		}
+		if option == "setname" && i+1 < len(args) {
+			name, setName = string(args[i+1]), true
+			i++
+			continue
+		}
+		return reply.MakeErrReply("ERR Syntax error in HELLO option '" + string(args[i]) + "'")
+	}
+	if !authenticated && !isAuthenticated(c) {
+		return reply.MakeErrReply("NOAUTH HELLO must be called with the client already authenticated, " +
+			"otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client " +
+			"and select the RESP protocol version at the same time")
+	}
+	if setName {
+		if errReply := setClientName(c, name); errReply != nil {
+			return errReply
+		}
+	}
+	c.SetProtocol(protocol)
+	return reply.MakeMapReply([]resp.Reply{
+		reply.MakeBulkReply([]byte("server")), reply.MakeBulkReply([]byte("redis")),
+		reply.MakeBulkReply([]byte("version")), reply.MakeBulkReply([]byte(config.RedisVersion)),
+		reply.MakeBulkReply([]byte("proto")), reply.MakeIntReply(int64(protocol)),
+		reply.MakeBulkReply([]byte("id")), reply.MakeIntReply(int64(c.GetID())),
+		reply.MakeBulkReply([]byte("mode")), reply.MakeBulkReply([]byte(config.Properties().GetMode())),
+		reply.MakeBulkReply([]byte("role")), reply.MakeBulkReply([]byte("master")),
+		reply.MakeBulkReply([]byte("modules")), reply.MakeEmptyMultiBulkReply(),
+	})
+}
+
+func init() {
+	registerSpecialCommand("Hello", -1, flagNoScript|flagFast).
+		attachCategories(aclConnection).
+		attachDocs("connection", "Handshakes with the Redis server.", "6.0.0")
+}
@@ -0,0 +1,231 @@
+package database
+
+import (
+	"bytes"
+	"goRedis/config"
+	"goRedis/interface/resp"
+	"goRedis/resp/connection"
+	"goRedis/resp/reply"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// InfoSection generates a section of INFO, the result starts with a header like `# Server`
+type InfoSection struct {
+	Name string
+	Gen  func() []byte
+}
+
+// defaultInfoSections are returned by INFO without arguments, in the same order as redis
+var defaultInfoSections = []string{"server", "clients", "memory", "persistence", "stats", "replication", "cluster", "keyspace"}
+
+// ExecInfo returns information and statistics of server,
+// extra sections replace the sections of the same name, such as cluster section in cluster mode
+// INFO [section [section ...]]
+func (mdb *StandaloneDatabase) ExecInfo(args [][]byte, extra ...InfoSection) resp.Reply {
+	sections := map[string]func() []byte{
+		"server":      genServerInfo,
+		"clients":     genClientsInfo,
+		"memory":      mdb.genMemoryInfo,
+		"persistence": genPersistenceInfo,
+		"stats":       mdb.genStatsInfo,
+		"replication": genReplicationInfo,
+		"cluster":     genClusterInfo,
+		"keyspace":    mdb.genKeyspaceInfo,
+	}
+	for _, section := range extra {
+		sections[section.Name] = section.Gen
+	}
+
+	var names []string
+	if len(args) == 0 {
+		names = defaultInfoSections
+	}
+	for _, arg := range args {
+		name := strings.ToLower(string(arg))
+		if name == "default" || name == "all" || name == "everything" {
+			names = append(names, defaultInfoSections...)
+		} else {
+			names = append(names, name)
+		}
+	}
+
+	var buf bytes.Buffer
+	generated := make(map[string]bool)
+	for _, name := range names {
+		gen, ok := sections[name]
+		if !ok || generated[name] {
+			continue // unknown section is ignored like redis
+		}
+		generated[name] = true
+		if buf.Len() > 0 {
+			buf.WriteString("\r\n")
+		}
+		buf.Write(gen())
+	}
+	return reply.MakeVerbatimReply("txt", buf.Bytes())
+}
+
+// infoWriter writes `field:value` lines of a section
+type infoWriter struct {
+	buf bytes.Buffer
+}
+
+func makeInfoWriter(title string) *infoWriter {
+	w := &infoWriter{}
+	w.buf.WriteString("# " + title + "\r\n")
+	return w
+}
+
+func (w *infoWriter) add(field string, value string) {
+	w.buf.WriteString(field + ":" + value + "\r\n")
+}
+
+func (w *infoWriter) addInt(field string, value int64) {
+	w.add(field, strconv.FormatInt(value, 10))
+}
+
+func (w *infoWriter) bytes() []byte {
+	return w.buf.Bytes()
+}
+
+func genServerInfo() []byte {
+	w := makeInfoWriter("Server")
+	uptime := time.Since(config.EachTimeServerInfo.StartUpTime)
+	executable, _ := os.Executable()
+	w.add("redis_version", config.RedisVersion)
+	w.add("redis_mode", config.Properties().GetMode())
+	w.add("os", runtime.GOOS+" "+runtime.GOARCH)
+	w.addInt("arch_bits", strconv.IntSize)
+	w.add("go_version", runtime.Version())
+	w.addInt("process_id", int64(os.Getpid()))
+	w.add("run_id", config.Properties().RunID)
+	w.addInt("tcp_port", int64(config.Properties().Port))
+	w.addInt("server_time_usec", time.Now().UnixMicro())
+	w.addInt("uptime_in_seconds", int64(uptime/time.Second))
+	w.addInt("uptime_in_days", int64(uptime/(24*time.Hour)))
+	w.add("executable", executable)
+	w.add("config_file", config.Properties().CfPath)
+	return w.bytes()
+}
+
+func genClientsInfo() []byte {
+	w := makeInfoWriter("Clients")
+	pubsubClients := 0
+	for _, c := range connection.ListClients() {
+		if c.SubsCount() > 0 {
+			pubsubClients++
+		}
+	}
+	w.addInt("connected_clients", int64(connection.CountClients()))
+	w.addInt("maxclients", int64(config.Properties().MaxClients))
+	w.addInt("blocked_clients", atomic.LoadInt64(&stats.blockedClients))
+	w.addInt("pubsub_clients", int64(pubsubClients))
+	return w.bytes()
+}
+
+func (mdb *StandaloneDatabase) genMemoryInfo() []byte {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	peak := stats.updatePeakMemory(m.Alloc)
+	w := makeInfoWriter("Memory")
+	w.addInt("used_memory", int64(m.Alloc))
+	w.add("used_memory_human", humanBytes(m.Alloc))
+	w.addInt("used_memory_rss", int64(m.Sys))
+	w.add("used_memory_rss_human", humanBytes(m.Sys))
+	w.addInt("used_memory_peak", int64(peak))
+	w.add("used_memory_peak_human", humanBytes(peak))
+	w.addInt("used_memory_dataset", mdb.getUsedMemory())
+	w.addInt("maxmemory", int64(config.Properties().MaxMemory))
+	w.add("maxmemory_human", humanBytes(uint64(config.Properties().MaxMemory)))
+	w.add("maxmemory_policy", getEvictionPolicy())
+	// memory is managed by the runtime of go, go_version is shown in the server section
+	w.add("mem_allocator", "go")
+	return w.bytes()
+}
+
+// humanBytes formats bytes like redis, such as 1.50M
+func humanBytes(n uint64) string {
+	units := []string{"B", "K", "M", "G", "T", "P"}
+	value := float64(n)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return strconv.FormatUint(n, 10) + "B"
+	}
+	return strconv.FormatFloat(value, 'f', 2, 64) + units[i]
+}
+
+func genPersistenceInfo() []byte {
+	w := makeInfoWriter("Persistence")
+	w.addInt("loading", 0)
+	aofEnabled := 0
+	if config.Properties().AppendOnly {
+		aofEnabled = 1
+	}
+	w.addInt("aof_enabled", int64(aofEnabled))
+	w.addInt("aof_rewrite_in_progress", 0)
+	if config.Properties().AppendOnly {
+		var size int64
+		if info, err := os.Stat(config.Properties().AppendFilename); err == nil {
+			size = info.Size()
+		}
+		w.addInt("aof_current_size", size)
+	}
+	return w.bytes()
+}
+
+func (mdb *StandaloneDatabase) genStatsInfo() []byte {
+	channels, patterns := mdb.hub.Count()
+	w := makeInfoWriter("Stats")
+	w.addInt("total_connections_received", connection.GetTotalConnections())
+	w.addInt("total_commands_processed", stats.getTotalCommands())
+	w.addInt("instantaneous_ops_per_sec", stats.getInstantaneousOps())
+	w.addInt("evicted_keys", atomic.LoadInt64(&stats.evictedKeys))
+	w.addInt("pubsub_channels", int64(channels))
+	w.addInt("pubsub_patterns", int64(patterns))
+	return w.bytes()
+}
+
+func genReplicationInfo() []byte {
+	w := makeInfoWriter("Replication")
+	w.add("role", "master")
+	w.addInt("connected_slaves", 0)
+	w.add("master_replid", config.Properties().RunID)
+	w.addInt("master_repl_offset", 0)
+	return w.bytes()
+}
+
+// genClusterInfo is the cluster section of standalone mode, ClusterDatabase provides its own
+func genClusterInfo() []byte {
+	w := makeInfoWriter("Cluster")
+	w.addInt("cluster_enabled", 0)
+	return w.bytes()
+}
+
+// genKeyspaceInfo shows the number of keys of non-empty databases, such as `db0:keys=1`.
+// goRedis has no ttl, so expires and avg_ttl of redis are omitted
+func (mdb *StandaloneDatabase) genKeyspaceInfo() []byte {
+	w := makeInfoWriter("Keyspace")
+	for i, db := range mdb.dbSet {
+		keys := db.data.Len()
+		if keys == 0 {
+			continue
+		}
+		w.add("db"+strconv.Itoa(i), "keys="+strconv.Itoa(keys))
+	}
+	return w.bytes()
+}
+
+func init() {
+	registerSpecialCommand("Info", -1, 0).
+		attachCategories(aclDangerous).
+		attachDocs("server", "Returns information and statistics about the server.", "1.0.0")
+}
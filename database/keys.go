@@ -1,8 +1,10 @@
 package database
 
 import (
+	"goRedis/interface/database"
 	"goRedis/interface/resp"
 	"goRedis/lib/utils"
+	"goRedis/lib/wildcard"
 	"goRedis/resp/reply"
 )
 
@@ -13,7 +15,13 @@ func execDel(db *DB, args [][]byte) resp.Reply {
 		keys[i] = string(v)
 	}
 
-	deleted := db.Removes(keys...)
+	deleted := 0
+	for _, key := range keys {
+		if db.Removes(key) > 0 {
+			db.notify(notifyGeneric, "del", key)
+			deleted++
+		}
+	}
 	if deleted > 0 {
 		db.addAof(utils.ToCmdLine3("del", args...))
 	}
@@ -40,6 +48,11 @@ func execFlushDB(db *DB, args [][]byte) resp.Reply {
 	return &reply.OkReply{}
 }
 
+// execDBSize returns the number of keys in db
+func execDBSize(db *DB, args [][]byte) resp.Reply {
+	return reply.MakeIntReply(int64(db.data.Len()))
+}
+
 // execType returns the type of entity, including: string, list, hash, set and zset
 func execType(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
@@ -47,11 +60,20 @@ func execType(db *DB, args [][]byte) resp.Reply {
 	if !exists {
 		return reply.MakeStatusReply("none")
 	}
+	typ := entityType(entity)
+	if typ == "" {
+		return &reply.UnknownErrReply{}
+	}
+	return reply.MakeStatusReply(typ)
+}
+
+// entityType returns the type name of entity shown by TYPE, empty string means unknown type
+func entityType(entity *database.DataEntity) string {
 	switch entity.Data.(type) {
 	case []byte:
-		return reply.MakeStatusReply("string")
+		return "string"
 	}
-	return &reply.UnknownErrReply{}
+	return ""
 }
 
 // execRename a key
@@ -69,6 +91,8 @@ func execRename(db *DB, args [][]byte) resp.Reply {
 	db.PutEntity(dest, entity)
 	db.Remove(src)
 	db.addAof(utils.ToCmdLine3("rename", args...))
+	db.notify(notifyGeneric, "rename_from", src)
+	db.notify(notifyGeneric, "rename_to", dest)
 	return &reply.OkReply{}
 }
 
@@ -89,28 +113,98 @@ func execRenameNx(db *DB, args [][]byte) resp.Reply {
 	db.Removes(src, dest) // clean src and dest with their ttl
 	db.PutEntity(dest, entity)
 	db.addAof(utils.ToCmdLine3("renamenx", args...))
+	db.notify(notifyGeneric, "rename_from", src)
+	db.notify(notifyGeneric, "rename_to", dest)
 	return reply.MakeIntReply(1)
 }
 
-// execKeys returns all keys matching the given pattern
-//func execKeys(db *DB, args [][]byte) resp.Reply {
-//	pattern := wildcard.CompilePattern(string(args[0]))
-//	result := make([][]byte, 0)
-//	db.data.ForEach(func(key string, val interface{}) bool {
-//		if pattern.IsMatch(key) {
-//			result = append(result, []byte(key))
-//		}
-//		return true
-//	})
-//	return reply.MakeMultiBulkReply(result)
-//}
+// execKeys returns all keys matching the given glob-style pattern
+func execKeys(db *DB, args [][]byte) resp.Reply {
+	pattern := wildcard.CompilePattern(string(args[0]))
+	matchAll := pattern.IsMatchAll()
+	result := make([][]byte, 0)
+	db.data.ForEach(func(key string, val interface{}) bool {
+		if matchAll || pattern.IsMatch(key) {
+			result = append(result, []byte(key))
+		}
+		return true
+	})
+	return reply.MakeMultiBulkReply(result)
+}
+
+// execRenameFrom removes the source key of a cross-node rename, used by cluster transactions only
+func execRenameFrom(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	db.Remove(key)
+	db.addAof(utils.ToCmdLine3("del", args...))
+	db.notify(notifyGeneric, "rename_from", key)
+	return &reply.OkReply{}
+}
+
+// execRenameTo rebuilds the destination key of a cross-node rename, used by cluster transactions only
+// args: dest cmdName cmdArgs..., cmdName and cmdArgs come from aof.EntityToCmd of the source key
+func execRenameTo(db *DB, args [][]byte) resp.Reply {
+	dest := string(args[0])
+	if db.Removes(dest) > 0 {
+		db.addAof(utils.ToCmdLine("del", dest))
+	}
+	cmdLine := make([][]byte, 0, len(args))
+	cmdLine = append(cmdLine, args[1], args[0]) // replace the source key with dest
+	cmdLine = append(cmdLine, args[2:]...)
+	result := db.execWithLock(cmdLine)
+	if !reply.IsErrorReply(result) {
+		db.notify(notifyGeneric, "rename_to", dest)
+	}
+	return result
+}
+
+func prepareRename(args [][]byte) ([]string, []string) {
+	src := string(args[0])
+	dest := string(args[1])
+	return []string{src, dest}, nil
+}
+
+func undoRename(db *DB, args [][]byte) []CmdLine {
+	src := string(args[0])
+	dest := string(args[1])
+	return rollbackGivenKeys(db, src, dest)
+}
 
 func init() {
-	RegisterCommand("Del", execDel, -2)
-	RegisterCommand("Exists", execExists, -2)
-	//RegisterCommand("Keys", execKeys, 2)
-	RegisterCommand("FlushDB", execFlushDB, -1)
-	RegisterCommand("Type", execType, 2)
-	RegisterCommand("Rename", execRename, 3)
-	RegisterCommand("RenameNx", execRenameNx, 3)
+	RegisterCommand("Del", execDel, writeAllKeys, rollbackAllKeys, -2, flagWrite).
+		attachKeys(1, -1, 1).
+		attachCategories(aclKeyspace).
+		attachDocs("generic", "Deletes one or more keys.", "1.0.0")
+	RegisterCommand("Exists", execExists, readAllKeys, nil, -2, flagReadOnly|flagFast).
+		attachKeys(1, -1, 1).
+		attachCategories(aclKeyspace).
+		attachDocs("generic", "Determines whether one or more keys exist.", "1.0.0")
+	// KEYS locks shards while iterating, it can't be queued within MULTI whose keys are locked by EXEC
+	RegisterCommand("Keys", execKeys, nil, nil, 2, flagReadOnly).
+		attachCategories(aclKeyspace, aclDangerous).
+		attachDocs("generic", "Returns all key names that match a pattern.", "1.0.0")
+	// FLUSHDB locks all shards, it can't be queued within MULTI whose keys are locked by EXEC
+	RegisterCommand("FlushDB", execFlushDB, nil, nil, -1, flagWrite).
+		attachCategories(aclKeyspace, aclDangerous).
+		attachDocs("server", "Removes all keys from the current database.", "1.0.0")
+	RegisterCommand("DBSize", execDBSize, noPrepare, nil, 1, flagReadOnly|flagFast).
+		attachCategories(aclKeyspace).
+		attachDocs("server", "Returns the number of keys in the database.", "1.0.0")
+	RegisterCommand("Type", execType, readFirstKey, nil, 2, flagReadOnly|flagFast).
+		attachKeys(1, 1, 1).
+		attachCategories(aclKeyspace).
+		attachDocs("generic", "Determines the type of value stored at a key.", "1.0.0")
+	RegisterCommand("Rename", execRename, prepareRename, undoRename, 3, flagWrite).
+		attachKeys(1, 2, 1).
+		attachCategories(aclKeyspace).
+		attachDocs("generic", "Renames a key and overwrites the destination.", "1.0.0")
+	RegisterCommand("RenameNx", execRenameNx, prepareRename, undoRename, 3, flagWrite|flagFast).
+		attachKeys(1, 2, 1).
+		attachCategories(aclKeyspace).
+		attachDocs("generic", "Renames a key only when the target key name doesn't exist.", "1.0.0")
+	// internal commands of cross-node rename in cluster mode
+	registerInternalCommand("RenameFrom", execRenameFrom, writeFirstKey, rollbackFirstKey, 2, flagWrite).
+		attachKeys(1, 1, 1)
+	registerInternalCommand("RenameTo", execRenameTo, writeFirstKey, rollbackFirstKey, -3, flagWrite).
+		attachKeys(1, 1, 1)
 }
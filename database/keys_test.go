@@ -0,0 +1,27 @@
+package database
+
+import (
+	"goRedis/resp/connection"
+	"testing"
+)
+
+func TestKeysInMulti(t *testing.T) {
+	mdb := NewStandaloneDatabase()
+	defer mdb.Close()
+	conn := &connection.FakeConn{}
+	execWithTimeout(t, mdb, conn, "SET", "k", "v")
+	execWithTimeout(t, mdb, conn, "MULTI")
+	execWithTimeout(t, mdb, conn, "SET", "a", "1")
+	result := execWithTimeout(t, mdb, conn, "KEYS", "*")
+	if result != "-ERR command 'keys' cannot be used in MULTI\r\n" {
+		t.Fatalf("unexpected reply of KEYS in MULTI: %q", result)
+	}
+	result = execWithTimeout(t, mdb, conn, "EXEC")
+	if result != "-EXECABORT Transaction discarded because of previous errors.\r\n" {
+		t.Fatalf("unexpected reply of EXEC: %q", result)
+	}
+	result = execWithTimeout(t, mdb, conn, "KEYS", "*")
+	if result != "*1\r\n$1\r\nk\r\n" {
+		t.Fatalf("unexpected reply of KEYS: %q", result)
+	}
+}
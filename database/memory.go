@@ -0,0 +1,225 @@
+package database
+
+import (
+	"goRedis/config"
+	"goRedis/interface/database"
+	"goRedis/interface/resp"
+	"goRedis/resp/connection"
+	"goRedis/resp/reply"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// entityOverhead approximates memory of dict entry, DataEntity and headers of key and value
+	entityOverhead = 64
+	// clientOverhead approximates memory of a connection, mainly the read buffer of parser
+	clientOverhead = 16*1024 + 1024
+)
+
+// estimateEntitySize returns the approximate memory of key and its value in bytes
+func estimateEntitySize(key string, entity *database.DataEntity) int64 {
+	size := int64(len(key)) + entityOverhead
+	switch val := entity.Data.(type) {
+	case []byte:
+		size += int64(len(val))
+	}
+	return size
+}
+
+// getUsedMemory returns estimated memory of all databases, which is compared with maxmemory
+func (mdb *StandaloneDatabase) getUsedMemory() int64 {
+	var used int64
+	for _, db := range mdb.dbSet {
+		used += atomic.LoadInt64(&db.usedMemory)
+	}
+	return used
+}
+
+// ExecMemory executes MEMORY subcommands, in cluster mode MEMORY USAGE is executed on the node holding the key
+func (mdb *StandaloneDatabase) ExecMemory(c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("memory")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	args = args[1:]
+	switch subCmd {
+	case "usage":
+		return mdb.execMemoryUsage(c, args)
+	case "stats":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("memory|stats")
+		}
+		return mdb.execMemoryStats()
+	case "doctor":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("memory|doctor")
+		}
+		return reply.MakeVerbatimReply("txt", []byte(mdb.memoryDoctor()))
+	case "purge":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("memory|purge")
+		}
+		debug.FreeOSMemory()
+		return reply.MakeOkReply()
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try MEMORY HELP.")
+}
+
+// execMemoryUsage returns the estimated memory of key and its value, access clock of the key is not updated
+// MEMORY USAGE key [SAMPLES count]
+func (mdb *StandaloneDatabase) execMemoryUsage(c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) != 1 && len(args) != 3 {
+		return reply.MakeArgNumErrReply("memory|usage")
+	}
+	if len(args) == 3 {
+		if strings.ToLower(string(args[1])) != "samples" {
+			return reply.MakeSyntaxErrReply()
+		}
+		if _, err := strconv.ParseInt(string(args[2]), 10, 64); err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		// all values are strings so far, samples will take effect once aggregate types are supported
+	}
+	key := string(args[0])
+	db := mdb.dbSet[c.GetDBIndex()]
+	keys := []string{key}
+	db.RWLocks(nil, keys)
+	defer db.RWUnLocks(nil, keys)
+	raw, ok := db.data.GetWithLock(key)
+	if !ok {
+		return reply.MakeNullBulkReply()
+	}
+	entity, _ := raw.(*database.DataEntity)
+	if entity == nil {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeIntReply(estimateEntitySize(key, entity))
+}
+
+// memoryStats holds the numbers of MEMORY STATS and MEMORY DOCTOR
+type memoryStats struct {
+	peak          uint64
+	total         uint64
+	startup       uint64
+	clients       int64
+	dbKeys        []int64
+	overheadTotal int64
+	keys          int64
+	dataset       int64
+	rss           uint64
+}
+
+func (mdb *StandaloneDatabase) getMemoryStats() *memoryStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	s := &memoryStats{
+		peak:    stats.updatePeakMemory(m.Alloc),
+		total:   m.Alloc,
+		startup: stats.getStartupMemory(),
+		clients: int64(connection.CountClients()) * clientOverhead,
+		dbKeys:  make([]int64, len(mdb.dbSet)),
+		rss:     m.Sys - m.HeapReleased,
+	}
+	s.overheadTotal = int64(s.startup) + s.clients
+	for i, db := range mdb.dbSet {
+		keys := int64(db.data.Len())
+		s.dbKeys[i] = keys
+		s.keys += keys
+		s.overheadTotal += keys * entityOverhead
+		s.dataset += atomic.LoadInt64(&db.usedMemory) - keys*entityOverhead
+	}
+	return s
+}
+
+func percentage(part float64, total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return part * 100 / total
+}
+
+// execMemoryStats returns memory usage of server, totals come from go runtime and dataset is estimated by goRedis
+func (mdb *StandaloneDatabase) execMemoryStats() resp.Reply {
+	s := mdb.getMemoryStats()
+	field := func(name string) resp.Reply {
+		return reply.MakeBulkReply([]byte(name))
+	}
+	pairs := []resp.Reply{
+		field("peak.allocated"), reply.MakeIntReply(int64(s.peak)),
+		field("total.allocated"), reply.MakeIntReply(int64(s.total)),
+		field("startup.allocated"), reply.MakeIntReply(int64(s.startup)),
+		field("replication.backlog"), reply.MakeIntReply(0),
+		field("clients.slaves"), reply.MakeIntReply(0),
+		field("clients.normal"), reply.MakeIntReply(s.clients),
+		field("aof.buffer"), reply.MakeIntReply(0),
+	}
+	for i, keys := range s.dbKeys {
+		if keys == 0 {
+			continue
+		}
+		pairs = append(pairs, field("db."+strconv.Itoa(i)), reply.MakeMapReply([]resp.Reply{
+			field("overhead.hashtable.main"), reply.MakeIntReply(keys * entityOverhead),
+			field("overhead.hashtable.expires"), reply.MakeIntReply(0),
+		}))
+	}
+	var bytesPerKey int64
+	if s.keys > 0 && s.total > s.startup {
+		bytesPerKey = int64(s.total-s.startup) / s.keys
+	}
+	pairs = append(pairs,
+		field("overhead.total"), reply.MakeIntReply(s.overheadTotal),
+		field("keys.count"), reply.MakeIntReply(s.keys),
+		field("keys.bytes-per-key"), reply.MakeIntReply(bytesPerKey),
+		field("dataset.bytes"), reply.MakeIntReply(s.dataset),
+		field("dataset.percentage"), reply.MakeDoubleReply(percentage(float64(s.dataset), float64(s.total)-float64(s.startup))),
+		field("peak.percentage"), reply.MakeDoubleReply(percentage(float64(s.total), float64(s.peak))),
+		field("fragmentation"), reply.MakeDoubleReply(float64(s.rss)/float64(s.total)),
+	)
+	return reply.MakeMapReply(pairs)
+}
+
+// memoryDoctor reports possible memory issues like MEMORY DOCTOR of redis
+func (mdb *StandaloneDatabase) memoryDoctor() string {
+	s := mdb.getMemoryStats()
+	if s.total < 5*1024*1024 {
+		return "Hi Sam, this instance is empty or is using very little memory, my issues detector can't be used in these conditions. " +
+			"Please, leave for your mission on Earth and fill it with some data. " +
+			"The new Sam and I will be back to our programming as soon as I finished rebooting."
+	}
+	var hints []string
+	if float64(s.peak) > float64(s.total)*1.5 {
+		hints = append(hints, " * Peak memory: In the past this instance used more than 150% the memory that is currently using. "+
+			"The allocator is normally not able to release memory after a peak, so you can expect to see a big fragmentation ratio, "+
+			"however this is actually harmless and is only due to the memory peak. "+
+			"Go runtime returns memory to the OS gradually, MEMORY PURGE returns it immediately.")
+	}
+	if fragmentation := float64(s.rss) / float64(s.total); fragmentation > 1.4 {
+		hints = append(hints, " * High total RSS: This instance has a memory fragmentation and RSS overhead greater than 1.4 "+
+			"(this means that the Resident Set Size of the process is much larger than the heap in use). "+
+			"It may be garbage waiting for collection, consider lowering GOGC or running MEMORY PURGE.")
+	}
+	if clients := connection.CountClients(); clients > 0 && s.clients > int64(s.total)/2 {
+		hints = append(hints, " * Big client buffers: The "+strconv.Itoa(clients)+" connected clients use more than half of memory, "+
+			"consider lowering maxclients or closing idle clients with timeout.")
+	}
+	if maxMemory := int64(config.Properties().MaxMemory); maxMemory > 0 && mdb.getUsedMemory() > maxMemory*9/10 {
+		hints = append(hints, " * Near maxmemory: The dataset uses more than 90% of maxmemory, keys may be evicted soon "+
+			"according to maxmemory-policy "+getEvictionPolicy()+".")
+	}
+	if len(hints) == 0 {
+		return "Hi Sam, I can't find any memory issue in your instance. I can only account for what occurs on this base."
+	}
+	return "Sam, I detected a few issues in this goRedis instance memory implants:\n\n" +
+		strings.Join(hints, "\n\n") +
+		"\n\nI'm here to keep you safe, Sam. I want to help you."
+}
+
+func init() {
+	// cluster relays MEMORY USAGE to the node holding the key
+	registerSpecialCommand("Memory", -2, flagReadOnly).
+		attachDocs("server", "A container for memory diagnostics commands.", "4.0.0")
+}
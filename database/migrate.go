@@ -0,0 +1,317 @@
+package database
+
+import (
+	"context"
+	"errors"
+	pool "github.com/jolestar/go-commons-pool/v2"
+	"goRedis/interface/resp"
+	"goRedis/lib/rdb"
+	"goRedis/lib/utils"
+	"goRedis/resp/client"
+	"goRedis/resp/reply"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMigrateTimeout = time.Second
+	// idle connections to migration targets are closed after migrateConnIdleTime like redis
+	migrateConnIdleTime  = 10 * time.Second
+	migratePoolMaxActive = 16
+	migratePoolMaxIdle   = 2
+)
+
+// migratePools caches connections to migration targets, host:port -> *pool.ObjectPool
+var (
+	migratePools   = make(map[string]*pool.ObjectPool)
+	migratePoolsMu sync.Mutex
+)
+
+type migrateConnFactory struct {
+	addr string
+}
+
+// MakeObject dials target, the dial timeout is the deadline of ctx which comes from timeout of MIGRATE
+func (f *migrateConnFactory) MakeObject(ctx context.Context) (*pool.PooledObject, error) {
+	dialTimeout := defaultMigrateTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		dialTimeout = time.Until(deadline)
+	}
+	c, err := client.MakeClientWithTimeout(f.addr, dialTimeout, 0)
+	if err != nil {
+		return nil, err
+	}
+	c.Start()
+	return pool.NewPooledObject(c), nil
+}
+
+func (f *migrateConnFactory) DestroyObject(ctx context.Context, object *pool.PooledObject) error {
+	c, ok := object.Object.(*client.Client)
+	if !ok {
+		return errors.New("type mismatch")
+	}
+	c.Close()
+	return nil
+}
+
+func (f *migrateConnFactory) ValidateObject(ctx context.Context, object *pool.PooledObject) bool {
+	return true
+}
+
+func (f *migrateConnFactory) ActivateObject(ctx context.Context, object *pool.PooledObject) error {
+	return nil
+}
+
+func (f *migrateConnFactory) PassivateObject(ctx context.Context, object *pool.PooledObject) error {
+	return nil
+}
+
+func getMigratePool(addr string) *pool.ObjectPool {
+	migratePoolsMu.Lock()
+	defer migratePoolsMu.Unlock()
+	p, ok := migratePools[addr]
+	if !ok {
+		poolConfig := pool.NewDefaultPoolConfig()
+		poolConfig.MaxTotal = migratePoolMaxActive
+		poolConfig.MaxIdle = migratePoolMaxIdle
+		poolConfig.MinEvictableIdleTime = migrateConnIdleTime
+		poolConfig.TimeBetweenEvictionRuns = migrateConnIdleTime
+		p = pool.NewObjectPool(context.Background(), &migrateConnFactory{addr: addr}, poolConfig)
+		migratePools[addr] = p
+	}
+	return p
+}
+
+// closeMigratePools closes cached connections to migration targets
+func closeMigratePools() {
+	migratePoolsMu.Lock()
+	defer migratePoolsMu.Unlock()
+	for addr, p := range migratePools {
+		p.Close(context.Background())
+		delete(migratePools, addr)
+	}
+}
+
+// migrateOptions are parsed from MIGRATE host port key|"" destination-db timeout [COPY] [REPLACE]
+// [AUTH password | AUTH2 username password] [KEYS key [key ...]]
+type migrateOptions struct {
+	addr     string
+	dbIndex  int
+	timeout  time.Duration
+	copy     bool
+	replace  bool
+	authArgs [][]byte // arguments of AUTH sent to target, nil means no authentication
+	keys     []string
+}
+
+// migrateKeys returns keys of MIGRATE, which are either the key argument or the keys after KEYS option
+func migrateKeys(args [][]byte) []string {
+	if len(args) < 5 {
+		return nil
+	}
+	for i := 5; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "auth":
+			i++
+		case "auth2":
+			i += 2
+		case "keys":
+			if len(args[2]) > 0 {
+				return nil
+			}
+			keys := make([]string, 0, len(args)-i-1)
+			for _, key := range args[i+1:] {
+				keys = append(keys, string(key))
+			}
+			return keys
+		}
+	}
+	return []string{string(args[2])}
+}
+
+func prepareMigrate(args [][]byte) ([]string, []string) {
+	return migrateKeys(args), nil
+}
+
+func rollbackMigrate(db *DB, args [][]byte) []CmdLine {
+	return rollbackGivenKeys(db, migrateKeys(args)...)
+}
+
+func parseMigrateOptions(args [][]byte) (*migrateOptions, resp.Reply) {
+	opts := &migrateOptions{
+		addr: net.JoinHostPort(string(args[0]), string(args[1])),
+	}
+	dbIndex, err := strconv.Atoi(string(args[3]))
+	if err != nil {
+		return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	opts.dbIndex = dbIndex
+	timeout, err := strconv.ParseInt(string(args[4]), 10, 64)
+	if err != nil {
+		return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	opts.timeout = time.Duration(timeout) * time.Millisecond
+	if timeout <= 0 {
+		opts.timeout = defaultMigrateTimeout
+	}
+	for i := 5; i < len(args); i++ {
+		remaining := len(args) - i - 1
+		switch strings.ToLower(string(args[i])) {
+		case "copy":
+			opts.copy = true
+		case "replace":
+			opts.replace = true
+		case "auth":
+			if remaining < 1 {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			opts.authArgs = [][]byte{args[i+1]}
+			i++
+		case "auth2":
+			if remaining < 2 {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			opts.authArgs = [][]byte{args[i+1], args[i+2]}
+			i += 2
+		case "keys":
+			if len(args[2]) > 0 {
+				return nil, reply.MakeErrReply("ERR When using MIGRATE KEYS option, the key argument must be set to the empty string")
+			}
+			opts.keys = migrateKeys(args)
+			return opts, nil
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+	}
+	opts.keys = []string{string(args[2])}
+	return opts, nil
+}
+
+// execMigrate restores keys on target server by payloads of DUMP, and removes them locally unless COPY is given.
+// connections to target are pooled, restore commands are pipelined. Keys are kept if the connection failed,
+// since whether they have been restored is unknown
+func execMigrate(db *DB, args [][]byte) resp.Reply {
+	opts, errReply := parseMigrateOptions(args)
+	if errReply != nil {
+		return errReply
+	}
+	keys := make([]string, 0, len(opts.keys))
+	payloads := make([][]byte, 0, len(opts.keys))
+	for _, key := range opts.keys {
+		entity, exists := db.GetEntity(key)
+		if !exists {
+			continue
+		}
+		payload, err := rdb.MakeDumpPayload(entity.Data)
+		if err != nil {
+			return reply.MakeErrReply("ERR " + err.Error())
+		}
+		keys = append(keys, key)
+		payloads = append(payloads, payload)
+	}
+	if len(keys) == 0 {
+		return reply.MakeStatusReply("NOKEY")
+	}
+
+	connPool := getMigratePool(opts.addr)
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	raw, err := connPool.BorrowObject(ctx)
+	if err != nil {
+		return reply.MakeErrReply("IOERR error or timeout connecting to the client")
+	}
+	conn := raw.(*client.Client)
+
+	results, errReply := sendMigrateCommands(conn, opts, keys, payloads)
+	if errReply != nil {
+		// replies of a timed out connection may be out of order
+		_ = connPool.InvalidateObject(context.Background(), conn)
+		return errReply
+	}
+	_ = connPool.ReturnObject(context.Background(), conn)
+
+	var targetErr resp.Reply
+	for i, result := range results {
+		if reply.IsErrorReply(result) {
+			if targetErr == nil {
+				targetErr = makeTargetErrReply(result)
+			}
+			continue
+		}
+		if !opts.copy {
+			db.Remove(keys[i])
+			db.addAof(utils.ToCmdLine("del", keys[i]))
+			db.notify(notifyGeneric, "del", keys[i])
+		}
+	}
+	if targetErr != nil {
+		return targetErr
+	}
+	return reply.MakeOkReply()
+}
+
+// sendMigrateCommands authenticates, selects db and restores keys on target, returns replies of restore commands.
+// it returns error reply if the connection should be discarded
+func sendMigrateCommands(conn *client.Client, opts *migrateOptions, keys []string, payloads [][]byte) ([]resp.Reply, resp.Reply) {
+	send := func(cmdLine [][]byte) (resp.Reply, resp.Reply) {
+		result := conn.SendWithTimeout(cmdLine, opts.timeout)
+		if _, ok := result.(*client.NetErrReply); ok {
+			return nil, reply.MakeErrReply("IOERR error or timeout reading to target instance")
+		}
+		return result, nil
+	}
+	if opts.authArgs != nil {
+		result, errReply := send(utils.ToCmdLine3("AUTH", opts.authArgs...))
+		if errReply != nil {
+			return nil, errReply
+		}
+		if reply.IsErrorReply(result) {
+			return nil, makeTargetErrReply(result)
+		}
+	}
+	result, errReply := send(utils.ToCmdLine("SELECT", strconv.Itoa(opts.dbIndex)))
+	if errReply != nil {
+		return nil, errReply
+	}
+	if reply.IsErrorReply(result) {
+		return nil, makeTargetErrReply(result)
+	}
+
+	results := make([]resp.Reply, len(keys))
+	errReplies := make([]resp.Reply, len(keys))
+	var wg sync.WaitGroup
+	for i := range keys {
+		cmdLine := utils.ToCmdLine3("RESTORE", []byte(keys[i]), []byte("0"), payloads[i])
+		if opts.replace {
+			cmdLine = append(cmdLine, []byte("REPLACE"))
+		}
+		wg.Add(1)
+		go func(i int, cmdLine [][]byte) {
+			defer wg.Done()
+			results[i], errReplies[i] = send(cmdLine)
+		}(i, cmdLine)
+	}
+	wg.Wait()
+	for _, errReply := range errReplies {
+		if errReply != nil {
+			return nil, errReply
+		}
+	}
+	return results, nil
+}
+
+// makeTargetErrReply wraps error replied by target server
+func makeTargetErrReply(result resp.Reply) resp.Reply {
+	msg := strings.TrimSuffix(strings.TrimPrefix(string(result.ToBytes()), "-"), reply.CRLF)
+	return reply.MakeErrReply("ERR Target instance replied with error: " + msg)
+}
+
+func init() {
+	RegisterCommand("Migrate", execMigrate, prepareMigrate, rollbackMigrate, -6, flagWrite|flagMovable).
+		attachKeys(3, 3, 1).
+		attachCategories(aclKeyspace, aclDangerous).
+		attachDocs("generic", "Atomically transfers a key from one Redis instance to another.", "2.6.0")
+}
@@ -0,0 +1,173 @@
+package database
+
+import (
+	"goRedis/interface/resp"
+	"goRedis/lib/logger"
+	"goRedis/resp/connection"
+	"goRedis/resp/reply"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// monitorBufferSize is the number of lines buffered for a monitor, a monitor which can't keep up is closed
+// like redis closes clients exceeding client-output-buffer-limit
+const monitorBufferSize = 1024
+
+var (
+	monitors     sync.Map // id -> *monitorFeed
+	monitorCount int64
+)
+
+// monitorFeed sends lines to a monitor in its own goroutine, so that a slow monitor doesn't block other clients
+type monitorFeed struct {
+	conn  *connection.Connection
+	lines chan []byte
+	done  chan struct{}
+}
+
+func (f *monitorFeed) run() {
+	for {
+		select {
+		case line := <-f.lines:
+			if err := f.conn.Write(line); err != nil {
+				logger.Warn("feed monitor failed: " + err.Error())
+				return
+			}
+		case <-f.done:
+			return
+		}
+	}
+}
+
+// feed never blocks, the monitor is killed if its buffer is full
+func (f *monitorFeed) feed(line []byte) {
+	select {
+	case f.lines <- line:
+	default:
+		logger.Warn("close monitor " + f.conn.RemoteAddr().String() + " since it can't keep up")
+		f.conn.Kill()
+	}
+}
+
+// redactedCommands contain passwords, their arguments are not shown to monitors
+var redactedCommands = map[string]bool{"auth": true, "hello": true, "migrate": true}
+
+// execMonitor makes the connection receive every command processed by server
+func execMonitor(c resp.Connection) resp.Reply {
+	conn, ok := c.(*connection.Connection)
+	if !ok {
+		return reply.MakeErrReply("ERR MONITOR isn't allowed for internal connections")
+	}
+	if conn.InMultiState() {
+		return reply.MakeErrReply("ERR MONITOR isn't allowed in transaction")
+	}
+	if conn.IsMonitor() {
+		return reply.MakeOkReply()
+	}
+	conn.SetMonitor(true)
+	feed := &monitorFeed{
+		conn:  conn,
+		lines: make(chan []byte, monitorBufferSize),
+		done:  make(chan struct{}),
+	}
+	go feed.run()
+	monitors.Store(conn.GetID(), feed)
+	atomic.AddInt64(&monitorCount, 1)
+	return reply.MakeOkReply()
+}
+
+// removeMonitor is invoked after connection closed
+func removeMonitor(c resp.Connection) {
+	if feed, ok := monitors.LoadAndDelete(c.GetID()); ok {
+		close(feed.(*monitorFeed).done)
+		atomic.AddInt64(&monitorCount, -1)
+	}
+}
+
+// FeedMonitors sends command to monitors after it is executed, such as
+// `+1339518083.107412 [0 127.0.0.1:60866] "keys" "*"`. Administrative commands are not sent like redis,
+// neither are commands rejected by authentication or ACL
+func FeedMonitors(c *connection.Connection, cmdLine [][]byte, result resp.Reply) {
+	if atomic.LoadInt64(&monitorCount) == 0 || len(cmdLine) == 0 || isRejectedReply(result) {
+		return
+	}
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok || cmd.flags&flagAdmin > 0 {
+		return
+	}
+
+	now := time.Now()
+	var b strings.Builder
+	b.WriteByte('+')
+	b.WriteString(strconv.FormatInt(now.Unix(), 10))
+	b.WriteByte('.')
+	micros := strconv.Itoa(now.Nanosecond() / 1000)
+	b.WriteString(strings.Repeat("0", 6-len(micros)) + micros)
+	b.WriteString(" [" + strconv.Itoa(c.GetDBIndex()) + " " + c.RemoteAddr().String() + "]")
+	for i, arg := range cmdLine {
+		b.WriteByte(' ')
+		if i > 0 && redactedCommands[cmdName] {
+			b.WriteString(`"(redacted)"`)
+			continue
+		}
+		writeQuoted(&b, arg)
+	}
+	b.WriteString("\r\n")
+	line := []byte(b.String())
+
+	monitors.Range(func(key, value interface{}) bool {
+		value.(*monitorFeed).feed(line)
+		return true
+	})
+}
+
+// isRejectedReply returns whether the command is rejected by CheckAuth or CheckPermission
+func isRejectedReply(result resp.Reply) bool {
+	errReply, ok := result.(reply.ErrorReply)
+	if !ok {
+		return false
+	}
+	msg := errReply.Error()
+	return strings.HasPrefix(msg, "NOAUTH") || strings.HasPrefix(msg, "NOPERM")
+}
+
+// writeQuoted writes argument in double quotes, non-printable characters are escaped like redis
+func writeQuoted(b *strings.Builder, arg []byte) {
+	b.WriteByte('"')
+	for _, ch := range arg {
+		switch ch {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\a':
+			b.WriteString(`\a`)
+		case '\b':
+			b.WriteString(`\b`)
+		default:
+			if ch >= 0x20 && ch < 0x7f {
+				b.WriteByte(ch)
+			} else {
+				b.WriteString(`\x`)
+				b.WriteString(strconv.FormatUint(uint64(ch)>>4, 16))
+				b.WriteString(strconv.FormatUint(uint64(ch)&0xf, 16))
+			}
+		}
+	}
+	b.WriteByte('"')
+}
+
+func init() {
+	registerSpecialCommand("Monitor", 1, flagAdmin|flagNoScript).
+		attachCategories(aclDangerous).
+		attachDocs("server", "Listens for all requests received by the server in real-time.", "1.0.0")
+}
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"errors"
+	"goRedis/lib/logger"
+	"goRedis/pubsub"
+	"strconv"
+	"sync/atomic"
+)
+
+// classes of keyspace events, see https://redis.io/docs/manual/keyspace-notifications/
+const (
+	notifyKeyspace = 1 << iota // K, published to __keyspace@<db>__:<key>
+	notifyKeyevent             // E, published to __keyevent@<db>__:<event>
+	notifyGeneric              // g, generic commands such as del, rename
+	notifyString               // $
+	notifyList                 // l
+	notifySet                  // s
+	notifyHash                 // h
+	notifyZSet                 // z
+	notifyExpired              // x
+	notifyEvicted              // e
+	notifyStream               // t
+	notifyKeyMiss              // m
+	notifyModule               // d
+	notifyNew                  // n, new keys, not included by A
+
+	notifyAll = notifyGeneric | notifyString | notifyList | notifySet | notifyHash |
+		notifyZSet | notifyExpired | notifyEvicted | notifyStream | notifyModule
+)
+
+var errInvalidNotifyFlags = errors.New("Invalid event class character. Use 'Ag$lshzxeKEtmdn'.")
+
+// notifyFlags is parsed from notify-keyspace-events, it could be changed by CONFIG SET
+var notifyFlags int32
+
+// parseNotifyFlags parses class characters of notify-keyspace-events
+func parseNotifyFlags(s string) (int32, error) {
+	var flags int32
+	for _, ch := range s {
+		switch ch {
+		case 'A':
+			flags |= notifyAll
+		case 'g':
+			flags |= notifyGeneric
+		case '$':
+			flags |= notifyString
+		case 'l':
+			flags |= notifyList
+		case 's':
+			flags |= notifySet
+		case 'h':
+			flags |= notifyHash
+		case 'z':
+			flags |= notifyZSet
+		case 'x':
+			flags |= notifyExpired
+		case 'e':
+			flags |= notifyEvicted
+		case 'K':
+			flags |= notifyKeyspace
+		case 'E':
+			flags |= notifyKeyevent
+		case 't':
+			flags |= notifyStream
+		case 'm':
+			flags |= notifyKeyMiss
+		case 'd':
+			flags |= notifyModule
+		case 'n':
+			flags |= notifyNew
+		default:
+			return 0, errInvalidNotifyFlags
+		}
+	}
+	return flags, nil
+}
+
+func setNotifyFlags(s string) error {
+	flags, err := parseNotifyFlags(s)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&notifyFlags, flags)
+	return nil
+}
+
+const (
+	keyspacePrefix = "__keyspace@"
+	keyeventPrefix = "__keyevent@"
+)
+
+// keyspaceEventQueueSize is the capacity of pending keyspace events. Executors hold key locks while notifying,
+// so events are published by a dedicated goroutine. They are dropped when the queue is full,
+// since notifications are fire and forget like pub/sub of redis
+const keyspaceEventQueueSize = 64 * 1024
+
+// droppedKeyspaceEvents counts events dropped because the queue is full
+var droppedKeyspaceEvents int64
+
+type keyspaceEvent struct {
+	channel string
+	message string
+}
+
+// notifyKeyspaceEvent queues event of key for subscribers if the class of event is enabled, it never blocks
+func (mdb *StandaloneDatabase) notifyKeyspaceEvent(class int32, event string, key string, dbIndex int) {
+	flags := atomic.LoadInt32(&notifyFlags)
+	if flags&class == 0 {
+		return
+	}
+	db := strconv.Itoa(dbIndex)
+	if flags&notifyKeyspace > 0 {
+		mdb.queueKeyspaceEvent(keyspacePrefix+db+"__:"+key, event)
+	}
+	if flags&notifyKeyevent > 0 {
+		mdb.queueKeyspaceEvent(keyeventPrefix+db+"__:"+event, key)
+	}
+}
+
+func (mdb *StandaloneDatabase) queueKeyspaceEvent(channel string, message string) {
+	select {
+	case mdb.keyspaceEvents <- keyspaceEvent{channel: channel, message: message}:
+	default:
+		// log at exponentially growing intervals to avoid flooding
+		if n := atomic.AddInt64(&droppedKeyspaceEvents, 1); n&(n-1) == 0 {
+			logger.Warn("keyspace events are dropped since subscribers can't keep up, dropped: " + strconv.FormatInt(n, 10))
+		}
+	}
+}
+
+// publishKeyspaceEvents publishes queued keyspace events in order until the database is closed
+func (mdb *StandaloneDatabase) publishKeyspaceEvents() {
+	for {
+		select {
+		case e := <-mdb.keyspaceEvents:
+			pubsub.Publish(mdb.hub, [][]byte{[]byte(e.channel), []byte(e.message)})
+		case <-mdb.closed:
+			return
+		}
+	}
+}
@@ -17,5 +17,7 @@ func Ping(db *DB, args [][]byte) resp.Reply {
 }
 
 func init() {
-	RegisterCommand("ping", Ping, -1)
+	RegisterCommand("ping", Ping, noPrepare, nil, -1, flagFast).
+		attachCategories(aclConnection).
+		attachDocs("connection", "Returns the server's liveliness response.", "1.0.0")
 }
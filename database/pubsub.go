@@ -0,0 +1,90 @@
+package database
+
+import (
+	"goRedis/interface/resp"
+	"goRedis/pubsub"
+	"goRedis/resp/reply"
+)
+
+// commandsInSubscribe could be executed by RESP2 connections which have subscribed channels
+var commandsInSubscribe = map[string]bool{
+	"subscribe":    true,
+	"unsubscribe":  true,
+	"psubscribe":   true,
+	"punsubscribe": true,
+	"ping":         true,
+	"quit":         true,
+}
+
+// isPubSubCommand returns whether the command is executed by pub/sub hub
+func isPubSubCommand(cmdName string) bool {
+	switch cmdName {
+	case "subscribe", "unsubscribe", "psubscribe", "punsubscribe", "publish", "pubsub":
+		return true
+	}
+	return false
+}
+
+// CheckSubscribeContext returns error if a RESP2 connection in subscribed state executes commands other than pub/sub
+// RESP3 connections could execute any command because messages are sent as push frames
+func CheckSubscribeContext(c resp.Connection, cmdName string) resp.Reply {
+	if c == nil || c.GetProtocol() != 2 || c.SubsCount() == 0 || commandsInSubscribe[cmdName] {
+		return nil
+	}
+	return reply.MakeErrReply("ERR Can't execute '" + cmdName + "': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context")
+}
+
+// execPubSub executes pub/sub commands, channels are checked against acl of user
+func (mdb *StandaloneDatabase) execPubSub(c resp.Connection, cmdName string, cmdLine [][]byte) resp.Reply {
+	cmd := cmdTable[cmdName]
+	if !validateArity(cmd.arity, cmdLine) {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	args := cmdLine[1:]
+	switch cmdName {
+	case "subscribe", "psubscribe":
+		if errReply := CheckChannelPermission(c, toStrings(args)); errReply != nil {
+			return errReply
+		}
+	case "publish":
+		if errReply := CheckChannelPermission(c, toStrings(args[:1])); errReply != nil {
+			return errReply
+		}
+	}
+	switch cmdName {
+	case "subscribe":
+		return pubsub.Subscribe(mdb.hub, c, args)
+	case "unsubscribe":
+		return pubsub.UnSubscribe(mdb.hub, c, args)
+	case "psubscribe":
+		return pubsub.PSubscribe(mdb.hub, c, args)
+	case "punsubscribe":
+		return pubsub.PUnSubscribe(mdb.hub, c, args)
+	case "publish":
+		return pubsub.Publish(mdb.hub, args)
+	}
+	return pubsub.PubSubCommand(mdb.hub, args)
+}
+
+func toStrings(args [][]byte) []string {
+	result := make([]string, len(args))
+	for i, arg := range args {
+		result[i] = string(arg)
+	}
+	return result
+}
+
+func init() {
+	registerSpecialCommand("Subscribe", -2, flagPubSub|flagNoScript).
+		attachDocs("pubsub", "Listens for messages published to channels.", "2.0.0")
+	registerSpecialCommand("Unsubscribe", -1, flagPubSub|flagNoScript).
+		attachDocs("pubsub", "Stops listening to messages posted to channels.", "2.0.0")
+	registerSpecialCommand("PSubscribe", -2, flagPubSub|flagNoScript).
+		attachDocs("pubsub", "Listens for messages published to channels that match one or more patterns.", "2.0.0")
+	registerSpecialCommand("PUnsubscribe", -1, flagPubSub|flagNoScript).
+		attachDocs("pubsub", "Stops listening to messages published to channels that match one or more patterns.", "2.0.0")
+	registerSpecialCommand("Publish", 3, flagPubSub|flagFast).
+		attachDocs("pubsub", "Posts a message to a channel.", "2.0.0")
+	registerSpecialCommand("PubSub", -2, flagPubSub).
+		attachDocs("pubsub", "A container for Pub/Sub commands.", "2.8.0")
+}
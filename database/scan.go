@@ -0,0 +1,102 @@
+package database
+
+import (
+	"goRedis/interface/database"
+	"goRedis/interface/resp"
+	"goRedis/lib/wildcard"
+	"goRedis/resp/reply"
+	"strconv"
+	"strings"
+)
+
+const defaultScanCount = 10
+
+var invalidCursorReply = reply.MakeErrReply("ERR invalid cursor")
+
+// scanOptions are options of SCAN family commands
+type scanOptions struct {
+	matcher *wildcard.Pattern // nil means matching all
+	count   int
+	typ     string // only for SCAN, empty means all types
+}
+
+// parseScanOptions parses [MATCH pattern] [COUNT count] [TYPE type], TYPE is allowed only if allowType is true
+func parseScanOptions(args [][]byte, allowType bool) (*scanOptions, resp.Reply) {
+	opts := &scanOptions{count: defaultScanCount}
+	for i := 0; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		value := string(args[i+1])
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			pattern := wildcard.CompilePattern(value)
+			if !pattern.IsMatchAll() {
+				opts.matcher = pattern
+			}
+		case "count":
+			count, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if count < 1 {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			opts.count = count
+		case "type":
+			if !allowType {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			opts.typ = strings.ToLower(value)
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+	}
+	return opts, nil
+}
+
+func parseScanCursor(arg []byte) (uint64, bool) {
+	cursor, err := strconv.ParseUint(string(arg), 10, 64)
+	return cursor, err == nil
+}
+
+func makeScanReply(cursor uint64, elements [][]byte) resp.Reply {
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(strconv.FormatUint(cursor, 10))),
+		reply.MakeMultiBulkReply(elements),
+	})
+}
+
+// execScan iterates keys of db incrementally, keys present for the whole iteration are returned at least once
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+func execScan(db *DB, args [][]byte) resp.Reply {
+	cursor, ok := parseScanCursor(args[0])
+	if !ok {
+		return invalidCursorReply
+	}
+	opts, errReply := parseScanOptions(args[1:], true)
+	if errReply != nil {
+		return errReply
+	}
+	keys := make([][]byte, 0, opts.count)
+	next := db.data.Scan(cursor, opts.count, func(key string, val interface{}) {
+		if opts.matcher != nil && !opts.matcher.IsMatch(key) {
+			return
+		}
+		if opts.typ != "" {
+			entity, _ := val.(*database.DataEntity)
+			if entity == nil || entityType(entity) != opts.typ {
+				return
+			}
+		}
+		keys = append(keys, []byte(key))
+	})
+	return makeScanReply(next, keys)
+}
+
+func init() {
+	// SCAN locks shards while iterating, it can't be queued within MULTI whose keys are locked by EXEC
+	RegisterCommand("Scan", execScan, nil, nil, -2, flagReadOnly).
+		attachCategories(aclKeyspace).
+		attachDocs("generic", "Iterates over the key names in the database.", "2.8.0")
+}
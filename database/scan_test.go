@@ -0,0 +1,45 @@
+package database
+
+import (
+	"goRedis/lib/utils"
+	"goRedis/resp/connection"
+	"testing"
+	"time"
+)
+
+// execWithTimeout runs cmdLine on mdb and fails the test if it doesn't return in time, which indicates a deadlock
+func execWithTimeout(t *testing.T, mdb *StandaloneDatabase, conn *connection.FakeConn, cmdLine ...string) string {
+	t.Helper()
+	done := make(chan string, 1)
+	go func() {
+		done <- string(mdb.Exec(conn, utils.ToCmdLine(cmdLine...)).ToBytes())
+	}()
+	select {
+	case result := <-done:
+		return result
+	case <-time.After(3 * time.Second):
+		t.Fatalf("%q is blocked", cmdLine)
+		return ""
+	}
+}
+
+func TestScanInMulti(t *testing.T) {
+	mdb := NewStandaloneDatabase()
+	defer mdb.Close()
+	conn := &connection.FakeConn{}
+	execWithTimeout(t, mdb, conn, "SET", "k", "v")
+	execWithTimeout(t, mdb, conn, "MULTI")
+	execWithTimeout(t, mdb, conn, "SET", "a", "1")
+	result := execWithTimeout(t, mdb, conn, "SCAN", "0", "COUNT", "2000")
+	if result != "-ERR command 'scan' cannot be used in MULTI\r\n" {
+		t.Fatalf("unexpected reply of SCAN in MULTI: %q", result)
+	}
+	result = execWithTimeout(t, mdb, conn, "EXEC")
+	if result != "-EXECABORT Transaction discarded because of previous errors.\r\n" {
+		t.Fatalf("unexpected reply of EXEC: %q", result)
+	}
+	result = execWithTimeout(t, mdb, conn, "SCAN", "0", "COUNT", "2000")
+	if result != "*2\r\n$1\r\n0\r\n*1\r\n$1\r\nk\r\n" {
+		t.Fatalf("unexpected reply of SCAN: %q", result)
+	}
+}
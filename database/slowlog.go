@@ -0,0 +1,218 @@
+package database
+
+import (
+	"goRedis/config"
+	"goRedis/interface/resp"
+	"goRedis/resp/connection"
+	"goRedis/resp/reply"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// arguments of slow commands are truncated like redis, to limit the memory of slowlog
+	slowlogMaxArgc   = 32
+	slowlogMaxArgLen = 128
+	// number of entries returned by SLOWLOG GET without count
+	slowlogDefaultGetCount = 10
+)
+
+type slowlogEntry struct {
+	id         int64
+	timestamp  time.Time
+	duration   time.Duration
+	args       [][]byte
+	clientAddr string
+	clientName string
+}
+
+// slowlogRing holds the latest slowlog-max-len slow commands
+type slowlogRing struct {
+	mu      sync.Mutex
+	entries []*slowlogEntry
+	next    int // position of the next entry
+	size    int
+	nextID  int64
+}
+
+var slowlog = &slowlogRing{}
+
+// record adds command into slowlog if it took more than slowlog-log-slower-than microseconds,
+// negative threshold disables slowlog and zero logs every command
+func (r *slowlogRing) record(c resp.Connection, cmdLine [][]byte, duration time.Duration) {
+	props := config.Properties()
+	threshold := props.SlowlogLogSlowerThan
+	if threshold < 0 || duration < time.Duration(threshold)*time.Microsecond {
+		return
+	}
+	if props.SlowlogMaxLen <= 0 {
+		// nothing could be kept, the ring is shrunk by the next read
+		return
+	}
+	entry := &slowlogEntry{
+		timestamp: time.Now(),
+		duration:  duration,
+		args:      truncateSlowlogArgs(cmdLine),
+	}
+	if conn, ok := c.(*connection.Connection); ok {
+		entry.clientAddr = conn.RemoteAddr().String()
+		entry.clientName = conn.GetName()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resize(config.Properties().SlowlogMaxLen)
+	if len(r.entries) == 0 {
+		return
+	}
+	entry.id = r.nextID
+	r.nextID++
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % len(r.entries)
+	if r.size < len(r.entries) {
+		r.size++
+	}
+}
+
+// resize changes capacity of ring if slowlog-max-len is changed by CONFIG SET, the newest entries are kept
+func (r *slowlogRing) resize(maxLen int) {
+	if maxLen < 0 {
+		maxLen = 0
+	}
+	if maxLen == len(r.entries) {
+		return
+	}
+	latest := r.latest(maxLen)
+	entries := make([]*slowlogEntry, maxLen)
+	// latest is newest first, the ring stores the oldest entry first
+	for i, entry := range latest {
+		entries[len(latest)-1-i] = entry
+	}
+	r.entries = entries
+	r.size = len(latest)
+	r.next = 0
+	if maxLen > 0 {
+		r.next = r.size % maxLen
+	}
+}
+
+// latest returns at most count entries, newest first
+func (r *slowlogRing) latest(count int) []*slowlogEntry {
+	if count < 0 || count > r.size {
+		count = r.size
+	}
+	result := make([]*slowlogEntry, count)
+	for i := 0; i < count; i++ {
+		idx := (r.next - 1 - i + len(r.entries)) % len(r.entries)
+		result[i] = r.entries[idx]
+	}
+	return result
+}
+
+func (r *slowlogRing) get(count int) []*slowlogEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resize(config.Properties().SlowlogMaxLen)
+	return r.latest(count)
+}
+
+func (r *slowlogRing) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resize(config.Properties().SlowlogMaxLen)
+	return r.size
+}
+
+func (r *slowlogRing) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.entries {
+		r.entries[i] = nil
+	}
+	r.next = 0
+	r.size = 0
+}
+
+// truncateSlowlogArgs copies arguments, the last argument is replaced by
+// `... (n more arguments)` if too many, long argument is ended with `... (n more bytes)`
+func truncateSlowlogArgs(cmdLine [][]byte) [][]byte {
+	argc := len(cmdLine)
+	if argc > slowlogMaxArgc {
+		argc = slowlogMaxArgc
+	}
+	args := make([][]byte, argc)
+	for i := 0; i < argc; i++ {
+		if i == slowlogMaxArgc-1 && len(cmdLine) > slowlogMaxArgc {
+			more := len(cmdLine) - slowlogMaxArgc + 1
+			args[i] = []byte("... (" + strconv.Itoa(more) + " more arguments)")
+			break
+		}
+		arg := cmdLine[i]
+		if len(arg) > slowlogMaxArgLen {
+			more := len(arg) - slowlogMaxArgLen
+			truncated := make([]byte, 0, slowlogMaxArgLen+32)
+			truncated = append(truncated, arg[:slowlogMaxArgLen]...)
+			truncated = append(truncated, "... ("+strconv.Itoa(more)+" more bytes)"...)
+			args[i] = truncated
+		} else {
+			args[i] = append([]byte(nil), arg...)
+		}
+	}
+	return args
+}
+
+// ExecSlowlog executes SLOWLOG subcommands, slowlog is stored in local node even in cluster mode
+func ExecSlowlog(args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("slowlog")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	args = args[1:]
+	switch subCmd {
+	case "get":
+		if len(args) > 1 {
+			return reply.MakeArgNumErrReply("slowlog|get")
+		}
+		count := slowlogDefaultGetCount
+		if len(args) == 1 {
+			n, err := strconv.Atoi(string(args[0]))
+			if err != nil || n < -1 {
+				return reply.MakeErrReply("ERR count should be greater than or equal to -1")
+			}
+			count = n
+		}
+		entries := slowlog.get(count)
+		result := make([]resp.Reply, len(entries))
+		for i, entry := range entries {
+			result[i] = reply.MakeMultiRawReply([]resp.Reply{
+				reply.MakeIntReply(entry.id),
+				reply.MakeIntReply(entry.timestamp.Unix()),
+				reply.MakeIntReply(entry.duration.Microseconds()),
+				reply.MakeMultiBulkReply(entry.args),
+				reply.MakeBulkReply([]byte(entry.clientAddr)),
+				reply.MakeBulkReply([]byte(entry.clientName)),
+			})
+		}
+		return reply.MakeMultiRawReply(result)
+	case "len":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("slowlog|len")
+		}
+		return reply.MakeIntReply(int64(slowlog.len()))
+	case "reset":
+		if len(args) != 0 {
+			return reply.MakeArgNumErrReply("slowlog|reset")
+		}
+		slowlog.reset()
+		return reply.MakeOkReply()
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try SLOWLOG HELP.")
+}
+
+func init() {
+	registerSpecialCommand("Slowlog", -2, flagAdmin).
+		attachCategories(aclDangerous).
+		attachDocs("server", "A container for slow log commands.", "2.2.12")
+}
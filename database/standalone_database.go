@@ -4,48 +4,142 @@ import (
 	"fmt"
 	"goRedis/aof"
 	"goRedis/config"
+	"goRedis/interface/database"
 	"goRedis/interface/resp"
 	"goRedis/lib/logger"
+	"goRedis/pubsub"
+	"goRedis/resp/connection"
 	"goRedis/resp/reply"
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // StandaloneDatabase is a set of multiple database set
 type StandaloneDatabase struct {
 	dbSet []*DB
-	// handle aof persistence
+	// handle aof persistence, aofMu protects aofHandler which could be replaced by CONFIG SET appendonly
+	aofMu      sync.RWMutex
 	aofHandler *aof.AofHandler
+	// handle publish/subscribe
+	hub *pubsub.Hub
+	// keyspace events waiting to be published, see notifyKeyspaceEvent
+	keyspaceEvents chan keyspaceEvent
+	closed         chan struct{}
+	// evict keys when used memory is over maxmemory
+	evictor *evictor
 }
 
 // NewStandaloneDatabase creates a resp database,
 func NewStandaloneDatabase() *StandaloneDatabase {
-	mdb := &StandaloneDatabase{}
-	if config.Properties.Databases == 0 {
-		config.Properties.Databases = 16
+	mdb := &StandaloneDatabase{
+		hub:            pubsub.MakeHub(),
+		keyspaceEvents: make(chan keyspaceEvent, keyspaceEventQueueSize),
+		closed:         make(chan struct{}),
+		evictor:        &evictor{},
 	}
-	mdb.dbSet = make([]*DB, config.Properties.Databases)
+	go mdb.publishKeyspaceEvents()
+	if err := initACL(); err != nil {
+		panic(err)
+	}
+	startStatsCron()
+	if err := setNotifyFlags(config.Properties().NotifyKeyspaceEvents); err != nil {
+		logger.Warn("notify-keyspace-events: " + err.Error())
+	}
+	mdb.dbSet = make([]*DB, config.Properties().Databases)
 	for i := range mdb.dbSet {
 		singleDB := makeDB()
 		singleDB.index = i
 		mdb.dbSet[i] = singleDB
 	}
-	if config.Properties.AppendOnly {
+	stats.recordStartupMemory()
+	if config.Properties().AppendOnly {
 		aofHandler, err := aof.NewAOFHandler(mdb)
 		if err != nil {
 			panic(err)
 		}
 		mdb.aofHandler = aofHandler
+	}
+	for _, db := range mdb.dbSet {
+		// avoid closure
+		singleDB := db
+		singleDB.addAof = func(line CmdLine) {
+			mdb.addAof(singleDB.index, line)
+		}
+		singleDB.notify = func(class int32, event string, key string) {
+			mdb.notifyKeyspaceEvent(class, event, key, singleDB.index)
+		}
+	}
+	return mdb
+}
+
+// addAof sends command to aof handler if aof is on
+func (mdb *StandaloneDatabase) addAof(dbIndex int, line CmdLine) {
+	mdb.aofMu.RLock()
+	defer mdb.aofMu.RUnlock()
+	if mdb.aofHandler != nil {
+		mdb.aofHandler.AddAof(dbIndex, line)
+	}
+}
+
+// setAppendOnly turns aof on or off at runtime.
+// Turning on rewrites aof file from the current dataset, all keys are locked until it finished
+// so that every write is either in the dataset or sent to the new aof handler
+func (mdb *StandaloneDatabase) setAppendOnly(on bool) error {
+	if on {
+		// writers call addAof while holding key locks, so keys must be locked before aofMu
 		for _, db := range mdb.dbSet {
-			// avoid closure
-			singleDB := db
-			singleDB.addAof = func(line CmdLine) {
-				mdb.aofHandler.AddAof(singleDB.index, line)
+			db.data.RLockAll()
+		}
+		defer func() {
+			for _, db := range mdb.dbSet {
+				db.data.RUnLockAll()
+			}
+		}()
+		mdb.aofMu.Lock()
+		defer mdb.aofMu.Unlock()
+		if mdb.aofHandler != nil {
+			return nil
+		}
+		handler, err := aof.NewAOFHandlerFromDataset(mdb, mdb.forEachCmdLine)
+		if err != nil {
+			return err
+		}
+		mdb.aofHandler = handler
+		_ = config.SetConfig("appendonly", "yes")
+		return nil
+	}
+	mdb.aofMu.Lock()
+	handler := mdb.aofHandler
+	mdb.aofHandler = nil
+	_ = config.SetConfig("appendonly", "no")
+	mdb.aofMu.Unlock()
+	if handler != nil {
+		handler.Close() // waits for pending commands written
+	}
+	return nil
+}
+
+// forEachCmdLine converts every key of all databases to commands, invoker should lock all keys
+func (mdb *StandaloneDatabase) forEachCmdLine(write func(dbIndex int, cmdLine CmdLine) error) error {
+	var err error
+	for _, db := range mdb.dbSet {
+		db.data.ForEachWithLock(func(key string, val interface{}) bool {
+			entity, _ := val.(*database.DataEntity)
+			cmd := aof.EntityToCmd(key, entity)
+			if cmd == nil {
+				return true
 			}
+			err = write(db.index, cmd.Args)
+			return err == nil
+		})
+		if err != nil {
+			return err
 		}
 	}
-	return mdb
+	return nil
 }
 
 // Exec executes command
@@ -57,25 +151,135 @@ func (mdb *StandaloneDatabase) Exec(c resp.Connection, cmdLine [][]byte) (result
 		}
 	}()
 
+	if _, ok := c.(*connection.FakeConn); !ok {
+		stats.incrCommands() // commands of aof loading are not counted
+		start := time.Now()
+		defer func() {
+			slowlog.record(c, cmdLine, time.Since(start))
+		}()
+	}
 	cmdName := strings.ToLower(string(cmdLine[0])) // 选取命令的第一个单词
-	if cmdName == "select" {                       // 这里是选择数据库
+	if cmdName == "auth" {
+		return Auth(c, cmdLine[1:])
+	}
+	if cmdName == "hello" {
+		return Hello(c, cmdLine[1:])
+	}
+	if errReply := CheckAuth(c, cmdName); errReply != nil {
+		return errReply
+	}
+	if errReply := CheckPermission(c, cmdLine); errReply != nil {
+		return errReply
+	}
+	if errReply := CheckSubscribeContext(c, cmdName); errReply != nil {
+		return errReply
+	}
+	if cmdName == "select" { // 这里是选择数据库
+		if c != nil && c.InMultiState() {
+			return reply.MakeErrReply("ERR cannot select database within multi")
+		}
 		if len(cmdLine) != 2 {
 			return reply.MakeArgNumErrReply("select")
 		}
 		return execSelect(c, mdb, cmdLine[1:])
 	}
+	if errReply := mdb.checkMaxMemory(c, cmdName); errReply != nil {
+		return errReply
+	}
+	// transaction commands
+	if cmdName == "multi" {
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return StartMulti(c)
+	} else if cmdName == "discard" {
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return DiscardMulti(c)
+	} else if cmdName == "exec" {
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return execMulti(mdb, c)
+	}
+	if c != nil && c.InMultiState() {
+		return EnqueueCmd(c, cmdLine)
+	}
+	if result := mdb.execAdminCommand(c, cmdName, cmdLine); result != nil {
+		return result
+	}
+	if isPubSubCommand(cmdName) {
+		return mdb.execPubSub(c, cmdName, cmdLine)
+	}
 	// normal commands
 	dbIndex := c.GetDBIndex()
 	selectedDB := mdb.dbSet[dbIndex] // 选择使用0-15哪个数据库
 	return selectedDB.Exec(c, cmdLine)
 }
 
+// execAdminCommand executes commands handled by StandaloneDatabase itself, returns nil if cmdName isn't one of them
+func (mdb *StandaloneDatabase) execAdminCommand(c resp.Connection, cmdName string, cmdLine [][]byte) resp.Reply {
+	switch cmdName {
+	case "acl":
+		return ExecACL(c, cmdLine[1:])
+	case "client":
+		return ExecClient(c, cmdLine[1:])
+	case "info":
+		return mdb.ExecInfo(cmdLine[1:])
+	case "config":
+		return mdb.ExecConfig(cmdLine[1:])
+	case "slowlog":
+		return ExecSlowlog(cmdLine[1:])
+	case "memory":
+		return mdb.ExecMemory(c, cmdLine[1:])
+	case "monitor":
+		return execMonitor(c)
+	}
+	return nil
+}
+
 // Close graceful shutdown database
 func (mdb *StandaloneDatabase) Close() {
-
+	_ = mdb.setAppendOnly(false)
+	closeMigratePools()
+	close(mdb.closed)
 }
 
+// AfterClientClose does some clean after client close connection
 func (mdb *StandaloneDatabase) AfterClientClose(c resp.Connection) {
+	pubsub.UnsubscribeAll(mdb.hub, c)
+	removeMonitor(c)
+}
+
+// ExecWithLock executes normal commands within the given db, invoker should provide locks
+func (mdb *StandaloneDatabase) ExecWithLock(dbIndex int, cmdLine [][]byte) resp.Reply {
+	return mdb.dbSet[dbIndex].execWithLock(cmdLine)
+}
+
+// ExecMulti executes multi commands transaction within the given db atomically
+func (mdb *StandaloneDatabase) ExecMulti(dbIndex int, cmdLines []CmdLine) resp.Reply {
+	return mdb.dbSet[dbIndex].ExecMulti(cmdLines)
+}
+
+// GetUndoLogs returns undo logs of the given command line, invoker should hold the locks
+func (mdb *StandaloneDatabase) GetUndoLogs(dbIndex int, cmdLine [][]byte) []CmdLine {
+	return mdb.dbSet[dbIndex].GetUndoLogs(cmdLine)
+}
+
+// GetEntity returns the entity bind to key in the given db, invoker should hold the lock of key
+func (mdb *StandaloneDatabase) GetEntity(dbIndex int, key string) (*database.DataEntity, bool) {
+	return mdb.dbSet[dbIndex].GetEntity(key)
+}
+
+// RWLocks lock keys for writing and reading in the given db
+func (mdb *StandaloneDatabase) RWLocks(dbIndex int, writeKeys []string, readKeys []string) {
+	mdb.dbSet[dbIndex].RWLocks(writeKeys, readKeys)
+}
+
+// RWUnLocks unlock keys for writing and reading in the given db
+func (mdb *StandaloneDatabase) RWUnLocks(dbIndex int, writeKeys []string, readKeys []string) {
+	mdb.dbSet[dbIndex].RWUnLocks(writeKeys, readKeys)
 }
 
 func execSelect(c resp.Connection, mdb *StandaloneDatabase, args [][]byte) resp.Reply {
@@ -89,3 +293,9 @@ func execSelect(c resp.Connection, mdb *StandaloneDatabase, args [][]byte) resp.
 	c.SelectDB(dbIndex)
 	return reply.MakeOkReply()
 }
+
+func init() {
+	registerSpecialCommand("Select", 2, flagFast).
+		attachCategories(aclConnection).
+		attachDocs("connection", "Changes the selected database.", "1.0.0")
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	statsCronInterval = 100 * time.Millisecond
+	// instantaneous_ops_per_sec is the average of recent samples, the same as redis
+	opsSampleCount = 16
+	// memory is sampled less frequently, because runtime.ReadMemStats stops the world
+	memSampleTicks = 10
+)
+
+// serverStats holds statistics shown by INFO
+type serverStats struct {
+	totalCommands int64
+	// clients waiting for CLIENT UNPAUSE
+	blockedClients int64
+	// keys evicted because of maxmemory
+	evictedKeys int64
+
+	mu           sync.Mutex
+	opsSamples   [opsSampleCount]int64
+	opsSampleIdx int
+	lastCommands int64
+	lastSampleAt time.Time
+	peakMemory   uint64
+	// memory allocated when server started, shown by MEMORY STATS
+	startupMemory uint64
+}
+
+var stats = &serverStats{}
+
+var startStatsOnce sync.Once
+
+// startStatsCron samples statistics periodically like serverCron of redis, it runs until process exit
+func startStatsCron() {
+	startStatsOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(statsCronInterval)
+			defer ticker.Stop()
+			for tick := 0; ; tick++ {
+				<-ticker.C
+				stats.sampleOps()
+				if tick%memSampleTicks == 0 {
+					var m runtime.MemStats
+					runtime.ReadMemStats(&m)
+					stats.updatePeakMemory(m.Alloc)
+				}
+			}
+		}()
+	})
+}
+
+func (s *serverStats) incrCommands() {
+	atomic.AddInt64(&s.totalCommands, 1)
+}
+
+func (s *serverStats) getTotalCommands() int64 {
+	return atomic.LoadInt64(&s.totalCommands)
+}
+
+func (s *serverStats) sampleOps() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	total := s.getTotalCommands()
+	if !s.lastSampleAt.IsZero() {
+		elapsed := now.Sub(s.lastSampleAt)
+		if elapsed > 0 {
+			s.opsSamples[s.opsSampleIdx] = (total - s.lastCommands) * int64(time.Second) / int64(elapsed)
+			s.opsSampleIdx = (s.opsSampleIdx + 1) % opsSampleCount
+		}
+	}
+	s.lastCommands = total
+	s.lastSampleAt = now
+}
+
+// getInstantaneousOps returns commands processed per second recently
+func (s *serverStats) getInstantaneousOps() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sum int64
+	for _, sample := range s.opsSamples {
+		sum += sample
+	}
+	return sum / opsSampleCount
+}
+
+// recordStartupMemory records memory allocated after databases created, before loading data
+func (s *serverStats) recordStartupMemory() {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.startupMemory = m.Alloc
+}
+
+func (s *serverStats) getStartupMemory() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.startupMemory
+}
+
+// updatePeakMemory records used memory and returns the peak
+func (s *serverStats) updatePeakMemory(used uint64) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if used > s.peakMemory {
+		s.peakMemory = used
+	}
+	return s.peakMemory
+}
+
+// reset clears statistics, invoked by CONFIG RESETSTAT
+func (s *serverStats) reset() {
+	atomic.StoreInt64(&s.totalCommands, 0)
+	atomic.StoreInt64(&s.evictedKeys, 0)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opsSamples = [opsSampleCount]int64{}
+	s.opsSampleIdx = 0
+	s.lastCommands = 0
+	s.lastSampleAt = time.Time{}
+	s.peakMemory = 0
+}
@@ -41,6 +41,7 @@ func execSet(db *DB, args [][]byte) resp.Reply {
 	}
 	db.PutEntity(key, entity)
 	db.addAof(utils.ToCmdLine3("set", args...))
+	db.notify(notifyString, "set", key)
 	return &reply.OkReply{}
 }
 
@@ -53,6 +54,9 @@ func execSetNX(db *DB, args [][]byte) resp.Reply {
 	}
 	result := db.PutIfAbsent(key, entity)
 	db.addAof(utils.ToCmdLine3("setnx", args...))
+	if result > 0 {
+		db.notify(notifyString, "set", key)
+	}
 	return reply.MakeIntReply(int64(result))
 }
 
@@ -64,6 +68,7 @@ func execGetSet(db *DB, args [][]byte) resp.Reply {
 	entity, exists := db.GetEntity(key)
 	db.PutEntity(key, &database.DataEntity{Data: value})
 	db.addAof(utils.ToCmdLine3("getset", args...))
+	db.notify(notifyString, "set", key)
 	if !exists {
 		return reply.MakeNullBulkReply()
 	}
@@ -82,10 +87,133 @@ func execStrLen(db *DB, args [][]byte) resp.Reply {
 	return reply.MakeIntReply(int64(len(old)))
 }
 
+// execMSet sets multi key-value in database
+func execMSet(db *DB, args [][]byte) resp.Reply {
+	if len(args)%2 != 0 {
+		return reply.MakeSyntaxErrReply()
+	}
+
+	size := len(args) / 2
+	keys := make([]string, size)
+	values := make([][]byte, size)
+	for i := 0; i < size; i++ {
+		keys[i] = string(args[2*i])
+		values[i] = args[2*i+1]
+	}
+
+	for i, key := range keys {
+		value := values[i]
+		db.PutEntity(key, &database.DataEntity{Data: value})
+	}
+	db.addAof(utils.ToCmdLine3("mset", args...))
+	for _, key := range keys {
+		db.notify(notifyString, "set", key)
+	}
+	return &reply.OkReply{}
+}
+
+// execMGet get multi key-value from database
+func execMGet(db *DB, args [][]byte) resp.Reply {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+
+	result := make([][]byte, len(args))
+	for i, key := range keys {
+		bytes, err := db.getAsString(key)
+		if err != nil {
+			_, isWrongType := err.(*reply.WrongTypeErrReply)
+			if isWrongType {
+				result[i] = nil
+				continue
+			} else {
+				return err
+			}
+		}
+		result[i] = bytes // nil or []byte
+	}
+
+	return reply.MakeMultiBulkReply(result)
+}
+
+// execMSetNX sets multi key-value in database, only if none of the given keys exist
+func execMSetNX(db *DB, args [][]byte) resp.Reply {
+	// parse args
+	if len(args)%2 != 0 {
+		return reply.MakeSyntaxErrReply()
+	}
+	size := len(args) / 2
+	values := make([][]byte, size)
+	keys := make([]string, size)
+	for i := 0; i < size; i++ {
+		keys[i] = string(args[2*i])
+		values[i] = args[2*i+1]
+	}
+
+	for _, key := range keys {
+		_, exists := db.GetEntity(key)
+		if exists {
+			return reply.MakeIntReply(0)
+		}
+	}
+
+	for i, key := range keys {
+		value := values[i]
+		db.PutEntity(key, &database.DataEntity{Data: value})
+	}
+	db.addAof(utils.ToCmdLine3("msetnx", args...))
+	for _, key := range keys {
+		db.notify(notifyString, "set", key)
+	}
+	return reply.MakeIntReply(1)
+}
+
+func prepareMSet(args [][]byte) ([]string, []string) {
+	size := len(args) / 2
+	keys := make([]string, size)
+	for i := 0; i < size; i++ {
+		keys[i] = string(args[2*i])
+	}
+	return keys, nil
+}
+
+func undoMSet(db *DB, args [][]byte) []CmdLine {
+	writeKeys, _ := prepareMSet(args)
+	return rollbackGivenKeys(db, writeKeys...)
+}
+
 func init() {
-	RegisterCommand("Get", execGet, 2)
-	RegisterCommand("Set", execSet, -3)
-	RegisterCommand("SetNx", execSetNX, 3)
-	RegisterCommand("GetSet", execGetSet, 3)
-	RegisterCommand("StrLen", execStrLen, 2)
+	RegisterCommand("Get", execGet, readFirstKey, nil, 2, flagReadOnly|flagFast).
+		attachKeys(1, 1, 1).
+		attachCategories(aclString).
+		attachDocs("string", "Returns the string value of a key.", "1.0.0")
+	RegisterCommand("Set", execSet, writeFirstKey, rollbackFirstKey, -3, flagWrite|flagDenyOOM).
+		attachKeys(1, 1, 1).
+		attachCategories(aclString).
+		attachDocs("string", "Sets the string value of a key, ignoring its type.", "1.0.0")
+	RegisterCommand("SetNx", execSetNX, writeFirstKey, rollbackFirstKey, 3, flagWrite|flagDenyOOM|flagFast).
+		attachKeys(1, 1, 1).
+		attachCategories(aclString).
+		attachDocs("string", "Set the string value of a key only when the key doesn't exist.", "1.0.0")
+	RegisterCommand("GetSet", execGetSet, writeFirstKey, rollbackFirstKey, 3, flagWrite|flagDenyOOM|flagFast).
+		attachKeys(1, 1, 1).
+		attachCategories(aclString).
+		attachDocs("string", "Returns the previous string value of a key after setting it to a new value.", "1.0.0")
+	RegisterCommand("StrLen", execStrLen, readFirstKey, nil, 2, flagReadOnly|flagFast).
+		attachKeys(1, 1, 1).
+		attachCategories(aclString).
+		attachDocs("string", "Returns the length of a string value.", "2.2.0")
+	RegisterCommand("MSet", execMSet, prepareMSet, undoMSet, -3, flagWrite|flagDenyOOM).
+		attachKeys(1, -1, 2).
+		attachCategories(aclString).
+		attachDocs("string", "Atomically creates or modifies the string values of one or more keys.", "1.0.1")
+	RegisterCommand("MSetNX", execMSetNX, prepareMSet, undoMSet, -3, flagWrite|flagDenyOOM).
+		attachKeys(1, -1, 2).
+		attachCategories(aclString).
+		attachDocs("string", "Atomically modifies the string values of one or more keys only when all keys don't exist.", "1.0.1")
+	RegisterCommand("MGet", execMGet, readAllKeys, nil, -2, flagReadOnly|flagFast).
+		attachKeys(1, -1, 1).
+		attachCategories(aclString).
+		attachDocs("string", "Atomically returns the string values of one or more keys.", "1.0.0")
 }
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"goRedis/interface/resp"
+	"goRedis/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// StartMulti starts multi-command-transaction
+func StartMulti(conn resp.Connection) resp.Reply {
+	if conn.InMultiState() {
+		return reply.MakeErrReply("ERR MULTI calls can not be nested")
+	}
+	conn.SetMultiState(true)
+	return reply.MakeOkReply()
+}
+
+// EnqueueCmd puts command line into `multi` pending queue.
+// commands without prepare can't be queued, including admin commands which can't be undone
+func EnqueueCmd(conn resp.Connection, cmdLine [][]byte) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		err := reply.MakeErrReply("ERR unknown command '" + cmdName + "'")
+		conn.AddTxError(err)
+		return err
+	}
+	if cmd.prepare == nil {
+		err := reply.MakeErrReply("ERR command '" + cmdName + "' cannot be used in MULTI")
+		conn.AddTxError(err)
+		return err
+	}
+	if !validateArity(cmd.arity, cmdLine) {
+		err := reply.MakeArgNumErrReply(cmdName)
+		conn.AddTxError(err)
+		return err
+	}
+	conn.EnqueueCmd(cmdLine)
+	return reply.MakeQueuedReply()
+}
+
+// DiscardMulti drops MULTI pending commands
+func DiscardMulti(conn resp.Connection) resp.Reply {
+	if !conn.InMultiState() {
+		return reply.MakeErrReply("ERR DISCARD without MULTI")
+	}
+	conn.ClearQueuedCmds()
+	conn.SetMultiState(false)
+	return reply.MakeOkReply()
+}
+
+// execMulti executes queued commands of the connection within its selected db
+func execMulti(mdb *StandaloneDatabase, conn resp.Connection) resp.Reply {
+	if !conn.InMultiState() {
+		return reply.MakeErrReply("ERR EXEC without MULTI")
+	}
+	defer conn.SetMultiState(false)
+	if len(conn.GetTxErrors()) > 0 {
+		return reply.MakeErrReply("EXECABORT Transaction discarded because of previous errors.")
+	}
+	return mdb.dbSet[conn.GetDBIndex()].ExecMulti(conn.GetQueuedCmdLine())
+}
+
+// ExecMulti executes multi commands transaction Atomically and Isolated
+// all related keys are locked during execution, and executed commands are undone if any of them failed
+func (db *DB) ExecMulti(cmdLines []CmdLine) resp.Reply {
+	// prepare
+	writeKeys := make([]string, 0) // may contains duplicate
+	readKeys := make([]string, 0)
+	for _, cmdLine := range cmdLines {
+		write, read := GetRelatedKeys(cmdLine)
+		writeKeys = append(writeKeys, write...)
+		readKeys = append(readKeys, read...)
+	}
+	// lock
+	db.RWLocks(writeKeys, readKeys)
+	defer db.RWUnLocks(writeKeys, readKeys)
+
+	// execute
+	results := make([]resp.Reply, 0, len(cmdLines))
+	undoCmdLines := make([][]CmdLine, 0, len(cmdLines))
+	for i, cmdLine := range cmdLines {
+		undoCmdLines = append(undoCmdLines, db.GetUndoLogs(cmdLine))
+		result := db.execWithLock(cmdLine)
+		if reply.IsErrorReply(result) {
+			// don't rollback failed commands, undo others executed before it
+			db.undo(undoCmdLines[:i])
+			return makeExecAbortReply(i, cmdLine, result)
+		}
+		results = append(results, result)
+	}
+	return reply.MakeMultiRawReply(results)
+}
+
+// makeExecAbortReply tells which command of transaction failed at runtime and why, commands are numbered from 1
+func makeExecAbortReply(index int, cmdLine CmdLine, result resp.Reply) resp.Reply {
+	msg := strings.TrimSuffix(strings.TrimPrefix(string(result.ToBytes()), "-"), reply.CRLF)
+	return reply.MakeErrReply("EXECABORT Transaction rolled back because command " + strconv.Itoa(index+1) +
+		" ('" + strings.ToLower(string(cmdLine[0])) + "') failed: " + msg)
+}
+
+// undo executes undo logs from tail to head, invoker should hold the locks
+func (db *DB) undo(undoCmdLines [][]CmdLine) {
+	size := len(undoCmdLines)
+	for i := size - 1; i >= 0; i-- {
+		curCmdLines := undoCmdLines[i]
+		if len(curCmdLines) == 0 {
+			continue
+		}
+		for _, cmdLine := range curCmdLines {
+			db.execWithLock(cmdLine)
+		}
+	}
+}
+
+// GetUndoLogs return rollback commands
+// invoker should hold the locks of related keys
+func (db *DB) GetUndoLogs(cmdLine [][]byte) []CmdLine {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := lookupCommand(cmdName)
+	if !ok {
+		return nil
+	}
+	undo := cmd.undo
+	if undo == nil {
+		return nil
+	}
+	return undo(db, cmdLine[1:])
+}
+
+// GetRelatedKeys analysis related keys
+func GetRelatedKeys(cmdLine [][]byte) ([]string, []string) {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := lookupCommand(cmdName)
+	if !ok {
+		return nil, nil
+	}
+	prepare := cmd.prepare
+	if prepare == nil {
+		return nil, nil
+	}
+	return prepare(cmdLine[1:])
+}
+
+func init() {
+	registerSpecialCommand("Multi", 1, flagNoScript|flagFast).
+		attachCategories(aclTransaction).
+		attachDocs("transactions", "Starts a transaction.", "1.2.0")
+	registerSpecialCommand("Exec", 1, flagNoScript).
+		attachCategories(aclTransaction).
+		attachDocs("transactions", "Executes all commands in a transaction.", "1.2.0")
+	registerSpecialCommand("Discard", 1, flagNoScript|flagFast).
+		attachCategories(aclTransaction).
+		attachDocs("transactions", "Discards a transaction.", "2.0.0")
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"goRedis/config"
+	"goRedis/resp/connection"
+	"testing"
+)
+
+func TestAdminCommandInMulti(t *testing.T) {
+	mdb := NewStandaloneDatabase()
+	defer mdb.Close()
+	conn := &connection.FakeConn{}
+	policy := config.Properties().MaxMemoryPolicy
+	execWithTimeout(t, mdb, conn, "MULTI")
+	result := execWithTimeout(t, mdb, conn, "CONFIG", "SET", "maxmemory-policy", "allkeys-lfu")
+	if result != "-ERR command 'config' cannot be used in MULTI\r\n" {
+		t.Fatalf("unexpected reply of CONFIG SET in MULTI: %q", result)
+	}
+	execWithTimeout(t, mdb, conn, "SET", "k", "v")
+	result = execWithTimeout(t, mdb, conn, "EXEC")
+	if result != "-EXECABORT Transaction discarded because of previous errors.\r\n" {
+		t.Fatalf("unexpected reply of EXEC: %q", result)
+	}
+	if config.Properties().MaxMemoryPolicy != policy {
+		t.Fatal("config is changed by discarded transaction")
+	}
+}
+
+func TestExecRuntimeError(t *testing.T) {
+	mdb := NewStandaloneDatabase()
+	defer mdb.Close()
+	conn := &connection.FakeConn{}
+	execWithTimeout(t, mdb, conn, "SET", "a", "1")
+	execWithTimeout(t, mdb, conn, "MULTI")
+	execWithTimeout(t, mdb, conn, "SET", "a", "2")
+	execWithTimeout(t, mdb, conn, "RENAME", "missing", "b")
+	result := execWithTimeout(t, mdb, conn, "EXEC")
+	if result != "-EXECABORT Transaction rolled back because command 2 ('rename') failed: no such key\r\n" {
+		t.Fatalf("unexpected reply of EXEC: %q", result)
+	}
+	if result = execWithTimeout(t, mdb, conn, "GET", "a"); result != "$1\r\n1\r\n" {
+		t.Fatalf("transaction isn't rolled back, got %q", result)
+	}
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"goRedis/aof"
+	"goRedis/lib/utils"
+)
+
+/* ---- prepare functions, return related write keys and read keys ---- */
+
+func readFirstKey(args [][]byte) ([]string, []string) {
+	// assert len(args) > 0
+	key := string(args[0])
+	return nil, []string{key}
+}
+
+func writeFirstKey(args [][]byte) ([]string, []string) {
+	key := string(args[0])
+	return []string{key}, nil
+}
+
+func writeAllKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	return keys, nil
+}
+
+func readAllKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	return nil, keys
+}
+
+func noPrepare(args [][]byte) ([]string, []string) {
+	return nil, nil
+}
+
+/* ---- undo functions, return command lines which restore the given keys ---- */
+
+// rollbackGivenKeys generates commands which restore the given keys to their current state
+func rollbackGivenKeys(db *DB, keys ...string) []CmdLine {
+	var undoCmdLines [][][]byte
+	for _, key := range keys {
+		entity, ok := db.GetEntity(key)
+		if !ok {
+			undoCmdLines = append(undoCmdLines,
+				utils.ToCmdLine("DEL", key),
+			)
+		} else {
+			undoCmdLines = append(undoCmdLines,
+				utils.ToCmdLine("DEL", key), // clean existed first
+				aof.EntityToCmd(key, entity).Args,
+			)
+		}
+	}
+	return undoCmdLines
+}
+
+func rollbackFirstKey(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	return rollbackGivenKeys(db, key)
+}
+
+func rollbackAllKeys(db *DB, args [][]byte) []CmdLine {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	return rollbackGivenKeys(db, keys...)
+}
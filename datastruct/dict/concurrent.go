@@ -2,6 +2,7 @@ package dict
 
 import (
 	"math"
+	"math/bits"
 	"math/rand"
 	"sort"
 	"sync"
@@ -9,18 +10,48 @@ import (
 	"time"
 )
 
-// ConcurrentDict is thread safe map using sharding lock
+const (
+	// maxLoadFactor is the average number of entries per bucket which triggers growing
+	maxLoadFactor = 4
+	// the table shrinks if the average number of entries per bucket is below 1/minLoadFactor
+	minLoadFactor = 8
+	// rehashEmptyVisits limits empty buckets visited by one rehash step like redis
+	rehashEmptyVisits = 10
+)
+
+// ConcurrentDict is thread safe map using sharding lock.
+// Entries are stored in buckets of a hash table whose size scales with the number of entries,
+// the table is resized by incremental rehashing like redis: a new table is allocated,
+// and buckets are migrated one by one by later operations, so no operation copies the whole dict.
+// A bucket is guarded by the shard lock at bucket index & (shard count - 1), tables are never smaller
+// than the shard count, so buckets migrated between tables stay in the same shard.
 type ConcurrentDict struct {
-	table      []*shard
+	shards     []*shard
 	count      int32
 	shardCount int
+	tables     atomic.Value // *tables, replaced when rehashing starts or finishes
+
+	// rehashMu guards rehashIdx and resizing, it only try-locks shards to avoid deadlock
+	rehashMu  sync.Mutex
+	rehashIdx int // next bucket of main table to migrate
 }
 
 type shard struct {
-	m     map[string]interface{}
 	mutex sync.RWMutex // 读写锁
 }
 
+// table is a hash table, each bucket is a small map
+type table struct {
+	buckets []map[string]interface{}
+}
+
+// tables holds the main table and the table being rehashed to, the latter is nil if not rehashing.
+// new entries are put into rehash table during rehashing, so migrated buckets of main table stay empty
+type tables struct {
+	main   *table
+	rehash *table
+}
+
 // computeCapacity 计算大于param的最小的 2 的幂次方
 func computeCapacity(param int) (size int) {
 	if param <= 16 {
@@ -38,23 +69,27 @@ func computeCapacity(param int) (size int) {
 	return n + 1
 }
 
-// MakeConcurrent creates ConcurrentDict with the given shard count
+// MakeConcurrent creates ConcurrentDict with the given shard count, which is also the minimum size of table
 func MakeConcurrent(shardCount int) *ConcurrentDict {
-	shardCount = computeCapacity(shardCount) // 计算需要多少个map
-	table := make([]*shard, shardCount)
+	shardCount = computeCapacity(shardCount) // 计算需要多少个锁
+	shards := make([]*shard, shardCount)
 	for i := 0; i < shardCount; i++ {
-		table[i] = &shard{
-			m: make(map[string]interface{}), // 初始化每一个map
-		}
+		shards[i] = &shard{}
 	}
 	d := &ConcurrentDict{
 		count:      0,
-		table:      table,
+		shards:     shards,
 		shardCount: shardCount,
 	}
+	d.tables.Store(&tables{main: makeTable(shardCount)})
 	return d
 }
 
+// makeTable creates table of the given size, buckets are allocated on first put
+func makeTable(size int) *table {
+	return &table{buckets: make([]map[string]interface{}, size)}
+}
+
 const prime32 = uint32(16777619) // 设定好的一个哈希质数，可以减少哈希冲突
 
 // 哈希算法: FNV-1a哈希算法
@@ -67,22 +102,65 @@ func fnv32(key string) uint32 {
 	return hash
 }
 
-// 计算哈希值对应在哪个位置
+// 计算哈希值对应在哪个锁
 func (dict *ConcurrentDict) spread(hashCode uint32) uint32 {
 	if dict == nil {
 		panic("dict is nil")
 	}
-	tableSize := uint32(len(dict.table))
+	shardCount := uint32(len(dict.shards))
 	// 减1的目的是为了不超出索引范围
-	return (tableSize - 1) & hashCode // 长度和哈希值按位与，和go的map用的一样。
+	return (shardCount - 1) & hashCode // 长度和哈希值按位与，和go的map用的一样。
 }
 
-// getShard 得到指定的map片
+// getShard 得到指定的锁片
 func (dict *ConcurrentDict) getShard(index uint32) *shard {
 	if dict == nil {
 		panic("dict is nil")
 	}
-	return dict.table[index]
+	return dict.shards[index]
+}
+
+func (dict *ConcurrentDict) loadTables() *tables {
+	return dict.tables.Load().(*tables)
+}
+
+// list returns tables to look up, in the order of main and rehash
+func (ts *tables) list() []*table {
+	if ts.rehash == nil {
+		return []*table{ts.main}
+	}
+	return []*table{ts.main, ts.rehash}
+}
+
+// writable returns the table which new entries are put into
+func (ts *tables) writable() *table {
+	if ts.rehash != nil {
+		return ts.rehash
+	}
+	return ts.main
+}
+
+func (t *table) bucketIndex(hashCode uint32) uint32 {
+	return hashCode & uint32(len(t.buckets)-1)
+}
+
+func (t *table) put(hashCode uint32, key string, val interface{}) {
+	index := t.bucketIndex(hashCode)
+	if t.buckets[index] == nil {
+		t.buckets[index] = make(map[string]interface{})
+	}
+	t.buckets[index][key] = val
+}
+
+// find returns the bucket holding key, invoker should hold lock of the shard
+func (dict *ConcurrentDict) find(key string, hashCode uint32) (bucket map[string]interface{}, val interface{}, exists bool) {
+	for _, t := range dict.loadTables().list() {
+		bucket = t.buckets[t.bucketIndex(hashCode)]
+		if val, exists = bucket[key]; exists {
+			return bucket, val, true
+		}
+	}
+	return nil, nil, false
 }
 
 // Get returns the binding value and whether the key is exist
@@ -91,11 +169,12 @@ func (dict *ConcurrentDict) Get(key string) (val interface{}, exists bool) {
 		panic("dict is nil")
 	}
 	hashCode := fnv32(key)         // 计算哈希值
-	index := dict.spread(hashCode) // 计算哈希值对应的map
-	s := dict.getShard(index)      // 得到对应的map
-	s.mutex.RLock()                // 上读锁  源码里用的写锁，博客里用的读锁
-	defer s.mutex.RUnlock()
-	val, exists = s.m[key]
+	index := dict.spread(hashCode) // 计算哈希值对应的锁
+	s := dict.getShard(index)      // 得到对应的锁
+	s.mutex.RLock()                // 上读锁
+	_, val, exists = dict.find(key, hashCode)
+	s.mutex.RUnlock()
+	dict.rehashStep()
 	return
 }
 
@@ -104,10 +183,7 @@ func (dict *ConcurrentDict) GetWithLock(key string) (val interface{}, exists boo
 	if dict == nil {
 		panic("dict is nil")
 	}
-	hashCode := fnv32(key)
-	index := dict.spread(hashCode)
-	s := dict.getShard(index)
-	val, exists = s.m[key]
+	_, val, exists = dict.find(key, fnv32(key))
 	return
 }
 
@@ -120,40 +196,44 @@ func (dict *ConcurrentDict) Len() int {
 	return int(atomic.LoadInt32(&dict.count))
 }
 
+// putWithLock puts key value into dict, updates existing value only if absent is false, inserts new key only if present is false
+func (dict *ConcurrentDict) putWithLock(key string, val interface{}, absent bool, present bool) (updated int, inserted int) {
+	hashCode := fnv32(key)
+	if bucket, _, exists := dict.find(key, hashCode); exists {
+		if absent {
+			return 0, 0
+		}
+		bucket[key] = val // 如果已经存在
+		return 1, 0
+	}
+	if present {
+		return 0, 0
+	}
+	dict.loadTables().writable().put(hashCode, key, val)
+	dict.addCount() // 字典中key-value 数量+1
+	return 0, 1
+}
+
 // Put puts key value into dict and returns the number of new inserted key-value
 func (dict *ConcurrentDict) Put(key string, val interface{}) (result int) {
 	if dict == nil {
 		panic("dict is nil")
 	}
-	hashCode := fnv32(key)         // 计算哈希值
-	index := dict.spread(hashCode) // 计算对应的map
-	s := dict.getShard(index)      // 得到对应的map
-	s.mutex.Lock()                 // 写入要用写锁
-	defer s.mutex.Unlock()
-
-	if _, ok := s.m[key]; ok {
-		s.m[key] = val // 如果已经存在
-		return 0
-	}
-	dict.addCount() // 字典中key-value 数量+1
-	s.m[key] = val  //
-	return 1
+	s := dict.getShard(dict.spread(fnv32(key)))
+	s.mutex.Lock() // 写入要用写锁
+	_, result = dict.putWithLock(key, val, false, false)
+	s.mutex.Unlock()
+	dict.afterWrite()
+	return
 }
 
 func (dict *ConcurrentDict) PutWithLock(key string, val interface{}) (result int) {
 	if dict == nil {
 		panic("dict is nil")
 	}
-	hashCode := fnv32(key)
-	index := dict.spread(hashCode)
-	s := dict.getShard(index)
-	if _, ok := s.m[key]; ok {
-		s.m[key] = val
-		return 0
-	}
-	dict.addCount()
-	s.m[key] = val
-	return 1
+	_, result = dict.putWithLock(key, val, false, false)
+	dict.afterWrite()
+	return
 }
 
 // PutIfAbsent puts value if the key is not exists and returns the number of updated key-value
@@ -161,34 +241,21 @@ func (dict *ConcurrentDict) PutIfAbsent(key string, val interface{}) (result int
 	if dict == nil {
 		panic("dict is nil")
 	}
-	hashCode := fnv32(key)
-	index := dict.spread(hashCode)
-	s := dict.getShard(index)
+	s := dict.getShard(dict.spread(fnv32(key)))
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	if _, ok := s.m[key]; ok {
-		return 0
-	}
-	s.m[key] = val
-	dict.addCount()
-	return 1
+	_, result = dict.putWithLock(key, val, true, false)
+	s.mutex.Unlock()
+	dict.afterWrite()
+	return
 }
 
 func (dict *ConcurrentDict) PutIfAbsentWithLock(key string, val interface{}) (result int) {
 	if dict == nil {
 		panic("dict is nil")
 	}
-	hashCode := fnv32(key)
-	index := dict.spread(hashCode)
-	s := dict.getShard(index)
-
-	if _, ok := s.m[key]; ok {
-		return 0
-	}
-	s.m[key] = val
-	dict.addCount()
-	return 1
+	_, result = dict.putWithLock(key, val, true, false)
+	dict.afterWrite()
+	return
 }
 
 // PutIfExists puts value if the key is exist and returns the number of inserted key-value
@@ -196,32 +263,21 @@ func (dict *ConcurrentDict) PutIfExists(key string, val interface{}) (result int
 	if dict == nil {
 		panic("dict is nil")
 	}
-	hashCode := fnv32(key)
-	index := dict.spread(hashCode)
-	s := dict.getShard(index)
+	s := dict.getShard(dict.spread(fnv32(key)))
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	if _, ok := s.m[key]; ok {
-		s.m[key] = val
-		return 1
-	}
-	return 0
+	result, _ = dict.putWithLock(key, val, false, true)
+	s.mutex.Unlock()
+	dict.rehashStep()
+	return
 }
 
 func (dict *ConcurrentDict) PutIfExistsWithLock(key string, val interface{}) (result int) {
 	if dict == nil {
 		panic("dict is nil")
 	}
-	hashCode := fnv32(key)
-	index := dict.spread(hashCode)
-	s := dict.getShard(index)
-
-	if _, ok := s.m[key]; ok {
-		s.m[key] = val
-		return 1
-	}
-	return 0
+	result, _ = dict.putWithLock(key, val, false, true)
+	dict.rehashStep()
+	return
 }
 
 // Remove removes the key and return the number of deleted key-value
@@ -229,34 +285,31 @@ func (dict *ConcurrentDict) Remove(key string) (result int) {
 	if dict == nil {
 		panic("dict is nil")
 	}
-	hashCode := fnv32(key)
-	index := dict.spread(hashCode)
-	s := dict.getShard(index)
+	s := dict.getShard(dict.spread(fnv32(key)))
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	if _, ok := s.m[key]; ok {
-		delete(s.m, key)
-		dict.decreaseCount()
-		return 1
-	}
-	return 0
+	_, result = dict.removeWithLock(key)
+	s.mutex.Unlock()
+	dict.afterWrite()
+	return
 }
 
 func (dict *ConcurrentDict) RemoveWithLock(key string) (val interface{}, result int) {
 	if dict == nil {
 		panic("dict is nil")
 	}
-	hashCode := fnv32(key)
-	index := dict.spread(hashCode)
-	s := dict.getShard(index)
+	val, result = dict.removeWithLock(key)
+	dict.afterWrite()
+	return
+}
 
-	if val, ok := s.m[key]; ok {
-		delete(s.m, key)
-		dict.decreaseCount()
-		return val, 1
+func (dict *ConcurrentDict) removeWithLock(key string) (val interface{}, result int) {
+	bucket, val, exists := dict.find(key, fnv32(key))
+	if !exists {
+		return nil, 0
 	}
-	return val, 0
+	delete(bucket, key)
+	dict.decreaseCount()
+	return val, 1
 }
 
 func (dict *ConcurrentDict) addCount() int32 {
@@ -267,6 +320,94 @@ func (dict *ConcurrentDict) decreaseCount() int32 {
 	return atomic.AddInt32(&dict.count, -1)
 }
 
+/* ---- incremental rehashing ---- */
+
+// afterWrite resizes table if the load factor is out of range, and migrates a bucket if rehashing
+func (dict *ConcurrentDict) afterWrite() {
+	ts := dict.loadTables()
+	if ts.rehash != nil {
+		dict.rehashStep()
+		return
+	}
+	size := len(ts.main.buckets)
+	count := dict.Len()
+	if count >= size*maxLoadFactor {
+		dict.resize(size * 2)
+	} else if size > dict.shardCount && count*minLoadFactor < size {
+		// shrink to half of max load factor, so that it won't grow again soon
+		newSize := computeCapacity(count * 2 / maxLoadFactor)
+		if newSize < dict.shardCount {
+			newSize = dict.shardCount
+		}
+		dict.resize(newSize)
+	}
+}
+
+// resize starts rehashing to a table of the given size, it does nothing if other goroutine is resizing
+func (dict *ConcurrentDict) resize(size int) {
+	if !dict.rehashMu.TryLock() {
+		return
+	}
+	defer dict.rehashMu.Unlock()
+	ts := dict.loadTables()
+	if ts.rehash != nil || size == len(ts.main.buckets) {
+		return
+	}
+	dict.rehashIdx = 0
+	dict.tables.Store(&tables{main: ts.main, rehash: makeTable(size)})
+}
+
+// rehashStep migrates a non-empty bucket of main table to rehash table, visiting at most rehashEmptyVisits empty buckets.
+// it gives up if the shard of bucket is locked, so it can be invoked while holding any shard locks
+func (dict *ConcurrentDict) rehashStep() {
+	if dict.loadTables().rehash == nil || !dict.rehashMu.TryLock() {
+		return
+	}
+	defer dict.rehashMu.Unlock()
+	ts := dict.loadTables()
+	if ts.rehash == nil {
+		return
+	}
+	for emptyVisits := rehashEmptyVisits; dict.rehashIdx < len(ts.main.buckets); {
+		s := dict.shards[dict.rehashIdx&(len(dict.shards)-1)]
+		if !s.mutex.TryLock() {
+			return
+		}
+		bucket := ts.main.buckets[dict.rehashIdx]
+		for key, val := range bucket {
+			ts.rehash.put(fnv32(key), key, val)
+		}
+		ts.main.buckets[dict.rehashIdx] = nil
+		s.mutex.Unlock()
+		dict.rehashIdx++
+		if len(bucket) > 0 {
+			break
+		}
+		emptyVisits--
+		if emptyVisits == 0 {
+			break
+		}
+	}
+	if dict.rehashIdx == len(ts.main.buckets) {
+		// all buckets are migrated, lookups holding old tables still find entries in rehash table
+		dict.tables.Store(&tables{main: ts.rehash})
+	}
+}
+
+/* ---- traversal ---- */
+
+// forEachBucket visits buckets of all tables guarded by the shard, invoker should hold lock of the shard
+func (dict *ConcurrentDict) forEachBucket(ts *tables, shardIndex int, fn func(bucket map[string]interface{}) bool) bool {
+	for _, t := range ts.list() {
+		for i := shardIndex; i < len(t.buckets); i += len(dict.shards) {
+			if len(t.buckets[i]) > 0 && !fn(t.buckets[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // ForEach traversal the dict
 // it may not visits new entry inserted during traversal
 func (dict *ConcurrentDict) ForEach(consumer Consumer) {
@@ -274,24 +415,86 @@ func (dict *ConcurrentDict) ForEach(consumer Consumer) {
 		panic("dict is nil")
 	}
 
-	for _, s := range dict.table {
+	for i, s := range dict.shards {
 		s.mutex.RLock()
-		f := func() bool {
-			defer s.mutex.RUnlock()
-			for key, value := range s.m {
-				continues := consumer(key, value)
-				if !continues {
+		continues := dict.forEachBucket(dict.loadTables(), i, func(bucket map[string]interface{}) bool {
+			for key, value := range bucket {
+				if !consumer(key, value) {
 					return false
 				}
 			}
-			return false
-		}
-		if !f() {
+			return true
+		})
+		s.mutex.RUnlock()
+		if !continues {
 			break
 		}
 	}
 }
 
+// Scan visits buckets from cursor until count entries are visited, and returns the cursor of the next call, 0 means finished.
+// Cursor increases in reverse binary order like redis, so that a key present for the whole scan is visited
+// at least once even if the table is resized between calls. During rehashing, a bucket of the smaller table
+// is visited with all buckets of the larger table it expands to. All entries of a bucket are visited at once
+func (dict *ConcurrentDict) Scan(cursor uint64, count int, consumer ScanConsumer) uint64 {
+	if dict == nil {
+		panic("dict is nil")
+	}
+	if count < 1 {
+		count = 1
+	}
+	visited := 0
+	emptyVisits := count * 10 // don't block for a long time on sparse dict
+	visit := func(bucket map[string]interface{}) {
+		if len(bucket) == 0 {
+			emptyVisits--
+		}
+		for key, value := range bucket {
+			consumer(key, value)
+			visited++
+		}
+	}
+	for {
+		// tables are never smaller than shard count, so all buckets visited in one round are guarded by the same shard
+		s := dict.shards[cursor&uint64(len(dict.shards)-1)]
+		s.mutex.RLock()
+		ts := dict.loadTables()
+		small, large := ts.main, ts.rehash
+		if large != nil && len(large.buckets) < len(small.buckets) {
+			small, large = large, small
+		}
+		smallMask := uint64(len(small.buckets) - 1)
+		visit(small.buckets[cursor&smallMask])
+		if large == nil {
+			cursor = nextCursor(cursor, smallMask)
+		} else {
+			largeMask := uint64(len(large.buckets) - 1)
+			for {
+				visit(large.buckets[cursor&largeMask])
+				// increase the reversed cursor in bits only the large table has,
+				// it carries into bits of small table after all expanded buckets are visited
+				cursor = nextCursor(cursor, largeMask)
+				if cursor&(smallMask^largeMask) == 0 {
+					break
+				}
+			}
+		}
+		s.mutex.RUnlock()
+
+		if cursor == 0 || visited >= count || emptyVisits <= 0 {
+			return cursor
+		}
+	}
+}
+
+// nextCursor increases the reversed cursor masked by mask
+func nextCursor(cursor uint64, mask uint64) uint64 {
+	cursor |= ^mask
+	cursor = bits.Reverse64(cursor)
+	cursor++
+	return bits.Reverse64(cursor)
+}
+
 func (dict *ConcurrentDict) keys() []string {
 	keys := make([]string, dict.Len())
 	i := 0
@@ -307,16 +510,18 @@ func (dict *ConcurrentDict) keys() []string {
 	return keys
 }
 
-// RandomKey returns a key randomly
-func (shard *shard) RandomKey() string {
-	if shard == nil {
-		panic("shard is nil")
-	}
-	shard.mutex.RLock()
-	defer shard.mutex.RUnlock()
-
-	for key := range shard.m {
-		return key
+// randomKey returns a key of a random bucket, returns empty string if the bucket is empty
+func (dict *ConcurrentDict) randomKey(nR *rand.Rand) string {
+	index := nR.Intn(len(dict.shards))
+	s := dict.shards[index]
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, t := range dict.loadTables().list() {
+		// pick one of buckets guarded by the shard
+		bucket := t.buckets[index+nR.Intn(len(t.buckets)/len(dict.shards))*len(dict.shards)]
+		for key := range bucket {
+			return key
+		}
 	}
 	return ""
 }
@@ -327,15 +532,10 @@ func (dict *ConcurrentDict) RandomKeys(limit int) []string {
 	if limit >= size {
 		return dict.keys() // 超过dict的大小，直接返回所有的key
 	}
-	shardCount := len(dict.table)
 	result := make([]string, limit)
 	nR := rand.New(rand.NewSource(time.Now().UnixNano()))
 	for i := 0; i < limit; {
-		s := dict.getShard(uint32(nR.Intn(shardCount))) // 随机映射一个map
-		if s == nil {
-			continue
-		}
-		key := s.RandomKey() // 从当前map中获取一个key
+		key := dict.randomKey(nR) // 随机映射一个桶，从中获取一个key
 		if key != "" {
 			result[i] = key
 			i++
@@ -350,20 +550,12 @@ func (dict *ConcurrentDict) RandomDistinctKeys(limit int) []string {
 	if limit >= size {
 		return dict.keys()
 	}
-	shardCount := len(dict.table)
 	result := make(map[string]struct{})
 	nR := rand.New(rand.NewSource(time.Now().UnixNano()))
 	for len(result) < limit {
-		shardIndex := uint32(nR.Intn(shardCount))
-		s := dict.getShard(shardIndex)
-		if s == nil {
-			continue
-		}
-		key := s.RandomKey()
-		for key != "" {
-			if _, exists := result[key]; !exists {
-				result[key] = struct{}{}
-			}
+		key := dict.randomKey(nR)
+		if key != "" {
+			result[key] = struct{}{}
 		}
 	}
 	arr := make([]string, limit)
@@ -375,9 +567,70 @@ func (dict *ConcurrentDict) RandomDistinctKeys(limit int) []string {
 	return arr
 }
 
-// Clear removes all keys in dict
+// TrySample visits at most limit random entries, one entry per bucket. Shards locked for writing are skipped
+// instead of waited for, so that sampling for eviction isn't blocked by keys locked by transactions.
+// It visits fewer entries if the dict is small or sparse
+func (dict *ConcurrentDict) TrySample(limit int, consumer ScanConsumer) {
+	if dict == nil {
+		panic("dict is nil")
+	}
+	nR := rand.New(rand.NewSource(time.Now().UnixNano()))
+	shardCount := len(dict.shards)
+	start := nR.Intn(shardCount)
+	sampled := 0
+	emptyVisits := limit * 10 // don't walk a sparse dict for a long time
+	for i := 0; i < shardCount && sampled < limit && emptyVisits > 0; i++ {
+		index := (start + i) & (shardCount - 1)
+		s := dict.shards[index]
+		if !s.mutex.TryRLock() {
+			continue
+		}
+		for _, t := range dict.loadTables().list() {
+			// buckets guarded by the shard are index, index + shardCount, index + 2*shardCount ...
+			n := len(t.buckets) / shardCount
+			offset := nR.Intn(n)
+			for j := 0; j < n && sampled < limit && emptyVisits > 0; j++ {
+				bucket := t.buckets[index+(offset+j)%n*shardCount]
+				if len(bucket) == 0 {
+					emptyVisits--
+					continue
+				}
+				for key, val := range bucket {
+					consumer(key, val)
+					break
+				}
+				sampled++
+			}
+		}
+		s.mutex.RUnlock()
+	}
+}
+
+// TryLockKey locks the shard of key for writing without blocking, returns false if the shard is locked
+func (dict *ConcurrentDict) TryLockKey(key string) bool {
+	return dict.shards[dict.spread(fnv32(key))].mutex.TryLock()
+}
+
+// UnLockKey unlocks the shard locked by TryLockKey
+func (dict *ConcurrentDict) UnLockKey(key string) {
+	dict.shards[dict.spread(fnv32(key))].mutex.Unlock()
+}
+
+// Clear removes all keys in dict, it waits for writers holding shard locks
 func (dict *ConcurrentDict) Clear() {
-	*dict = *MakeConcurrent(dict.shardCount)
+	dict.LockAll()
+	defer dict.UnLockAll()
+	dict.ClearWithLock()
+}
+
+// ClearWithLock removes all keys in dict without locking, invoker should hold write locks of all shards
+// so that no writer puts keys into the old table or changes count
+func (dict *ConcurrentDict) ClearWithLock() {
+	dict.rehashMu.Lock()
+	defer dict.rehashMu.Unlock()
+	dict.rehashIdx = 0
+	dict.tables.Store(&tables{main: makeTable(dict.shardCount)})
+	atomic.StoreInt32(&dict.count, 0)
 }
 
 func (dict *ConcurrentDict) toLockIndices(keys []string, reverse bool) []uint32 {
@@ -410,7 +663,7 @@ func (dict *ConcurrentDict) RWLocks(writeKeys []string, readKeys []string) {
 	}
 	for _, index := range indices {
 		_, w := writeIndexSet[index]
-		mu := &dict.table[index].mutex
+		mu := &dict.shards[index].mutex
 		if w {
 			mu.Lock() // 写的加写锁
 		} else {
@@ -430,7 +683,7 @@ func (dict *ConcurrentDict) RWUnLocks(writeKeys []string, readKeys []string) {
 	}
 	for _, index := range indices {
 		_, w := writeIndexSet[index]
-		mu := &dict.table[index].mutex
+		mu := &dict.shards[index].mutex
 		if w {
 			mu.Unlock()
 		} else {
@@ -438,3 +691,49 @@ func (dict *ConcurrentDict) RWUnLocks(writeKeys []string, readKeys []string) {
 		}
 	}
 }
+
+// LockAll locks all shards for writing in the same order as RWLocks
+func (dict *ConcurrentDict) LockAll() {
+	for _, s := range dict.shards {
+		s.mutex.Lock()
+	}
+}
+
+// UnLockAll unlocks all shards locked by LockAll
+func (dict *ConcurrentDict) UnLockAll() {
+	for i := len(dict.shards) - 1; i >= 0; i-- {
+		dict.shards[i].mutex.Unlock()
+	}
+}
+
+// RLockAll locks all shards for reading, writers are blocked until RUnLockAll
+func (dict *ConcurrentDict) RLockAll() {
+	for _, s := range dict.shards {
+		s.mutex.RLock()
+	}
+}
+
+// RUnLockAll unlocks all shards locked by RLockAll
+func (dict *ConcurrentDict) RUnLockAll() {
+	for i := len(dict.shards) - 1; i >= 0; i-- {
+		dict.shards[i].mutex.RUnlock()
+	}
+}
+
+// ForEachWithLock traversal the dict without locking, invoker should hold locks of all shards
+func (dict *ConcurrentDict) ForEachWithLock(consumer Consumer) {
+	ts := dict.loadTables()
+	for i := range dict.shards {
+		continues := dict.forEachBucket(ts, i, func(bucket map[string]interface{}) bool {
+			for key, value := range bucket {
+				if !consumer(key, value) {
+					return false
+				}
+			}
+			return true
+		})
+		if !continues {
+			return
+		}
+	}
+}
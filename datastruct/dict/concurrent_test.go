@@ -0,0 +1,229 @@
+package dict
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentPutRemove(t *testing.T) {
+	d := MakeConcurrent(16)
+	const n = 10000
+	for i := 0; i < n; i++ {
+		if d.Put(strconv.Itoa(i), i) != 1 {
+			t.Fatalf("%d should be inserted", i)
+		}
+	}
+	if d.Len() != n || len(d.loadTables().main.buckets)+tableSize(d.loadTables().rehash) <= 16 {
+		t.Fatal("dict should grow")
+	}
+	for i := 0; i < n; i++ {
+		val, ok := d.Get(strconv.Itoa(i))
+		if !ok || val.(int) != i {
+			t.Fatalf("wrong value of %d", i)
+		}
+	}
+	for i := 10; i < n; i++ {
+		if d.Remove(strconv.Itoa(i)) != 1 {
+			t.Fatalf("%d should be removed", i)
+		}
+	}
+	// table is resized and rehashed by later writes
+	for i := 0; i < n; i++ {
+		d.Put("tmp", i)
+		d.Remove("tmp")
+	}
+	if size := len(d.loadTables().main.buckets); d.Len() != 10 || size != 16 {
+		t.Fatalf("dict should shrink, len %d, size %d", d.Len(), size)
+	}
+	for i := 0; i < 10; i++ {
+		if _, ok := d.Get(strconv.Itoa(i)); !ok {
+			t.Fatalf("%d is lost after shrinking", i)
+		}
+	}
+}
+
+func tableSize(t *table) int {
+	if t == nil {
+		return 0
+	}
+	return len(t.buckets)
+}
+
+// scanAll visits all keys by Scan, keys may be duplicated
+func scanAll(d *ConcurrentDict, count int) map[string]struct{} {
+	keys := make(map[string]struct{})
+	cursor := uint64(0)
+	for {
+		cursor = d.Scan(cursor, count, func(key string, val interface{}) {
+			keys[key] = struct{}{}
+		})
+		if cursor == 0 {
+			return keys
+		}
+	}
+}
+
+// TestConcurrentScan checks that keys present for the whole scan are visited while other keys are put and removed,
+// which grows and shrinks the table. Run with -race to check synchronization of rehashing
+func TestConcurrentScan(t *testing.T) {
+	d := MakeConcurrent(16)
+	const stableCount = 1000
+	for i := 0; i < stableCount; i++ {
+		d.Put("stable:"+strconv.Itoa(i), i)
+	}
+	const writers = 4
+	const rounds = 3
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			prefix := "churn:" + strconv.Itoa(w) + ":"
+			for r := 0; r < rounds; r++ {
+				for i := 0; i < 2000; i++ {
+					d.Put(prefix+strconv.Itoa(i), i)
+				}
+				for i := 0; i < 2000; i++ {
+					d.Remove(prefix + strconv.Itoa(i))
+				}
+			}
+		}(w)
+	}
+	scanErrs := make([]string, 2)
+	var scanWg sync.WaitGroup
+	for s := range scanErrs {
+		scanWg.Add(1)
+		go func(s int, count int) {
+			defer scanWg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				keys := scanAll(d, count)
+				for i := 0; i < stableCount; i++ {
+					if _, ok := keys["stable:"+strconv.Itoa(i)]; !ok {
+						scanErrs[s] = "stable:" + strconv.Itoa(i) + " is not visited"
+						return
+					}
+				}
+			}
+		}(s, 10+s*100)
+	}
+	wg.Wait()
+	close(stop)
+	scanWg.Wait()
+	for _, scanErr := range scanErrs {
+		if scanErr != "" {
+			t.Fatal(scanErr)
+		}
+	}
+	if d.Len() != stableCount {
+		t.Fatalf("expected %d keys, got %d", stableCount, d.Len())
+	}
+	keys := scanAll(d, 100)
+	if len(keys) != stableCount {
+		t.Fatalf("expected %d keys by scan, got %d", stableCount, len(keys))
+	}
+}
+
+// TestConcurrentClear clears the dict like FLUSHDB while keys are put and removed like SET and DEL,
+// count should always equal to the number of keys
+func TestConcurrentClear(t *testing.T) {
+	d := MakeConcurrent(16)
+	cleared := make(chan struct{})
+	go func() {
+		defer close(cleared)
+		for i := 0; i < 100000; i++ {
+			d.Clear()
+		}
+	}()
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			prefix := strconv.Itoa(w) + ":"
+			// keep writing for a while after the last Clear, so that a drifted count is not reset
+			remaining := 1000
+			for i := 0; remaining > 0; i++ {
+				select {
+				case <-cleared:
+					remaining--
+				default:
+				}
+				key := prefix + strconv.Itoa(i%100)
+				if i%3 == 0 {
+					d.Remove(key)
+				} else {
+					d.Put(key, i)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	count := 0
+	d.ForEach(func(key string, val interface{}) bool {
+		count++
+		return true
+	})
+	if count != d.Len() {
+		t.Fatalf("count is %d, but there are %d keys", d.Len(), count)
+	}
+	if keys := d.RandomKeys(count + 1); len(keys) != count {
+		t.Fatalf("expected %d keys, got %d", count, len(keys))
+	}
+}
+
+func TestTrySample(t *testing.T) {
+	d := MakeConcurrent(16)
+	for i := 0; i < 1000; i++ {
+		d.Put(strconv.Itoa(i), i)
+	}
+	sampled := make(map[string]struct{})
+	d.TrySample(10, func(key string, val interface{}) {
+		sampled[key] = struct{}{}
+	})
+	if len(sampled) != 10 {
+		t.Fatalf("expected 10 keys, got %d", len(sampled))
+	}
+	// locked shards are skipped instead of waited for
+	d.LockAll()
+	d.TrySample(10, func(key string, val interface{}) {
+		t.Fatalf("%s is sampled from locked shard", key)
+	})
+	d.UnLockAll()
+	if !d.TryLockKey("0") {
+		t.Fatal("failed to lock key")
+	}
+	if d.TryLockKey("0") {
+		t.Fatal("key is locked twice")
+	}
+	d.UnLockKey("0")
+}
+
+// BenchmarkConcurrentPutGrowth puts new keys into a growing dict, and reports the p99 latency of Put.
+// Since rehashing is incremental, it stays flat while the table is resized many times
+func BenchmarkConcurrentPutGrowth(b *testing.B) {
+	d := MakeConcurrent(16)
+	latencies := make([]time.Duration, b.N)
+	keys := make([]string, b.N)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		begin := time.Now()
+		d.Put(keys[i], i)
+		latencies[i] = time.Since(begin)
+	}
+	b.StopTimer()
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns")
+}
@@ -3,6 +3,9 @@ package dict
 // Consumer is used to traversal dict,if it returns false the traversal will be break
 type Consumer func(key string, val interface{}) bool
 
+// ScanConsumer receives entries visited by Scan, an entry may be visited more than once during a full scan
+type ScanConsumer func(key string, val interface{})
+
 type Dict interface {
 	Get(key string) (val interface{}, exists bool)
 	Len() int
@@ -11,6 +14,7 @@ type Dict interface {
 	PutIfExists(key string, val interface{}) (result int)
 	Remove(key string) (result int)
 	ForEach(consumer Consumer)
+	Scan(cursor uint64, count int, consumer ScanConsumer) uint64
 	keys() []string
 	RandomKeys(limit int) []string
 	RandomDistinctKeys(limit int) []string
@@ -75,6 +75,14 @@ func (dict *SimpleDict) ForEach(consumer Consumer) {
 	}
 }
 
+// Scan visits all entries at once and returns cursor 0, like SCAN of small collections in redis
+func (dict *SimpleDict) Scan(cursor uint64, count int, consumer ScanConsumer) uint64 {
+	for k, v := range dict.m {
+		consumer(k, v)
+	}
+	return 0
+}
+
 // Keys returns all keys in dict
 func (dict *SimpleDict) keys() []string {
 	result := make([]string, len(dict.m))
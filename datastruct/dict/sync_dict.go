@@ -75,6 +75,15 @@ func (dict *SyncDict) ForEach(consumer Consumer) {
 	})
 }
 
+// Scan visits all entries at once and returns cursor 0, sync.Map can't be iterated incrementally
+func (dict *SyncDict) Scan(cursor uint64, count int, consumer ScanConsumer) uint64 {
+	dict.m.Range(func(key, value interface{}) bool {
+		consumer(key.(string), value)
+		return true
+	})
+	return 0
+}
+
 // Keys returns all keys in dict
 func (dict *SyncDict) keys() []string {
 	result := make([]string, dict.Len())
@@ -15,4 +15,7 @@ type Database interface {
 
 type DataEntity struct {
 	Data interface{}
+	// Clock is used by eviction, it is the last access time for LRU policies,
+	// or the access frequency for LFU policies. It is accessed atomically
+	Clock uint32
 }
@@ -5,4 +5,35 @@ type Connection interface {
 	Write([]byte) error
 	GetDBIndex() int
 	SelectDB(int)
+
+	// used by CLIENT, id is unique among connections
+	GetID() uint64
+	SetName(string)
+	GetName() string
+
+	// used for authentication, user is empty before AUTH
+	SetUser(string)
+	GetUser() string
+
+	// RESP version negotiated by HELLO, 2 or 3
+	SetProtocol(int)
+	GetProtocol() int
+
+	// used for pub/sub
+	Subscribe(channel string)
+	UnSubscribe(channel string)
+	PSubscribe(pattern string)
+	PUnSubscribe(pattern string)
+	SubsCount() int
+	GetChannels() []string
+	GetPatterns() []string
+
+	// used for `Multi` command
+	InMultiState() bool
+	SetMultiState(bool)
+	GetQueuedCmdLine() [][][]byte
+	EnqueueCmd([][]byte)
+	ClearQueuedCmds()
+	AddTxError(err error)
+	GetTxErrors() []error
 }
@@ -0,0 +1,14 @@
+package rdb
+
+import "hash/crc64"
+
+// jonesPoly is the reflected form of crc-64-jones polynomial 0xad93d23594c935a9 used by redis
+const jonesPoly = 0x95ac9329ac4bc9b5
+
+var jonesTable = crc64.MakeTable(jonesPoly)
+
+// CRC64 returns checksum of data the same as crc64 of redis, whose initial value and final xor are 0
+func CRC64(data []byte) uint64 {
+	// crc64.Update inverts crc before and after updating
+	return ^crc64.Update(^uint64(0), jonesTable, data)
+}
@@ -0,0 +1,260 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+)
+
+// Version is the rdb version of redis 7.0, payloads of newer versions are rejected like redis
+const Version = 10
+
+// object types of rdb
+const (
+	typeString = 0
+)
+
+// length encodings, the type is in the high 2 bits of the first byte
+const (
+	len6Bit  = 0
+	len14Bit = 1
+	len32Bit = 0x80
+	len64Bit = 0x81
+	lenEnc   = 3 // the rest 6 bits are one of special string encodings
+)
+
+// special string encodings
+const (
+	encInt8  = 0
+	encInt16 = 1
+	encInt32 = 2
+	encLZF   = 3
+)
+
+// footerSize is the size of rdb version (2 bytes) and crc64 (8 bytes) at the end of payload
+const footerSize = 10
+
+var (
+	// ErrVersionOrChecksum means the payload is created by newer redis or corrupted
+	ErrVersionOrChecksum = errors.New("DUMP payload version or checksum are wrong")
+	// ErrBadDataFormat means the payload can't be decoded
+	ErrBadDataFormat = errors.New("Bad data format")
+	// ErrUnsupportedType means the value or the object type of payload is not supported by goRedis
+	ErrUnsupportedType = errors.New("unsupported object type")
+)
+
+// MakeDumpPayload serializes value to the format of DUMP: object type, object, rdb version and crc64 in little endian
+func MakeDumpPayload(value interface{}) ([]byte, error) {
+	var buf []byte
+	switch val := value.(type) {
+	case []byte:
+		buf = append(buf, typeString)
+		buf = appendString(buf, val)
+	default:
+		return nil, ErrUnsupportedType
+	}
+	buf = appendUint16(buf, Version, binary.LittleEndian)
+	return appendUint64(buf, CRC64(buf), binary.LittleEndian), nil
+}
+
+// ParseDumpPayload verifies rdb version and checksum of payload, and decodes the value
+func ParseDumpPayload(payload []byte) (interface{}, error) {
+	if len(payload) < footerSize {
+		return nil, ErrVersionOrChecksum
+	}
+	footer := payload[len(payload)-footerSize:]
+	if binary.LittleEndian.Uint16(footer) > Version {
+		return nil, ErrVersionOrChecksum
+	}
+	if binary.LittleEndian.Uint64(footer[2:]) != CRC64(payload[:len(payload)-8]) {
+		return nil, ErrVersionOrChecksum
+	}
+	r := &reader{buf: payload[:len(payload)-footerSize]}
+	objType, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	switch objType {
+	case typeString:
+		value, err = r.readString()
+	default:
+		return nil, ErrUnsupportedType
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.pos != len(r.buf) {
+		return nil, ErrBadDataFormat
+	}
+	return value, nil
+}
+
+// appendString encodes string like rdbSaveRawString of redis without compression,
+// integers no longer than 11 characters are encoded as int8, int16 or int32
+func appendString(buf []byte, s []byte) []byte {
+	if len(s) <= 11 {
+		if v, err := strconv.ParseInt(string(s), 10, 32); err == nil && strconv.FormatInt(v, 10) == string(s) {
+			switch {
+			case v >= math.MinInt8 && v <= math.MaxInt8:
+				return append(buf, lenEnc<<6|encInt8, byte(v))
+			case v >= math.MinInt16 && v <= math.MaxInt16:
+				buf = append(buf, lenEnc<<6|encInt16)
+				return appendUint16(buf, uint16(v), binary.LittleEndian)
+			default:
+				buf = append(buf, lenEnc<<6|encInt32)
+				return appendUint32(buf, uint32(v), binary.LittleEndian)
+			}
+		}
+	}
+	buf = appendLength(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// appendLength encodes length in 1, 2, 5 or 9 bytes, multi-byte lengths are big endian
+func appendLength(buf []byte, length uint64) []byte {
+	switch {
+	case length < 1<<6:
+		return append(buf, byte(length))
+	case length < 1<<14:
+		return append(buf, byte(len14Bit<<6|length>>8), byte(length))
+	case length <= math.MaxUint32:
+		buf = append(buf, len32Bit)
+		return appendUint32(buf, uint32(length), binary.BigEndian)
+	default:
+		buf = append(buf, len64Bit)
+		return appendUint64(buf, length, binary.BigEndian)
+	}
+}
+
+func appendUint16(buf []byte, v uint16, order binary.ByteOrder) []byte {
+	buf = append(buf, 0, 0)
+	order.PutUint16(buf[len(buf)-2:], v)
+	return buf
+}
+
+func appendUint32(buf []byte, v uint32, order binary.ByteOrder) []byte {
+	buf = append(buf, 0, 0, 0, 0)
+	order.PutUint32(buf[len(buf)-4:], v)
+	return buf
+}
+
+func appendUint64(buf []byte, v uint64, order binary.ByteOrder) []byte {
+	buf = append(buf, 0, 0, 0, 0, 0, 0, 0, 0)
+	order.PutUint64(buf[len(buf)-8:], v)
+	return buf
+}
+
+// reader decodes objects of payload, any read beyond the buffer returns ErrBadDataFormat
+type reader struct {
+	buf []byte
+	pos int
+}
+
+func (r *reader) readByte() (byte, error) {
+	if r.pos >= len(r.buf) {
+		return 0, ErrBadDataFormat
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *reader) readBytes(n uint64) ([]byte, error) {
+	if n > uint64(len(r.buf)-r.pos) {
+		return nil, ErrBadDataFormat
+	}
+	b := r.buf[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+// readLength returns the length, or the special string encoding if encoded is true
+func (r *reader) readLength() (length uint64, encoded bool, err error) {
+	first, err := r.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch first >> 6 {
+	case len6Bit:
+		return uint64(first & 0x3f), false, nil
+	case len14Bit:
+		next, err := r.readByte()
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(first&0x3f)<<8 | uint64(next), false, nil
+	case lenEnc:
+		return uint64(first & 0x3f), true, nil
+	}
+	switch first {
+	case len32Bit:
+		b, err := r.readBytes(4)
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(binary.BigEndian.Uint32(b)), false, nil
+	case len64Bit:
+		b, err := r.readBytes(8)
+		if err != nil {
+			return 0, false, err
+		}
+		return binary.BigEndian.Uint64(b), false, nil
+	}
+	return 0, false, ErrBadDataFormat
+}
+
+func (r *reader) readString() ([]byte, error) {
+	length, encoded, err := r.readLength()
+	if err != nil {
+		return nil, err
+	}
+	if !encoded {
+		b, err := r.readBytes(length)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	}
+	switch length {
+	case encInt8:
+		b, err := r.readBytes(1)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.FormatInt(int64(int8(b[0])), 10)), nil
+	case encInt16:
+		b, err := r.readBytes(2)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.FormatInt(int64(int16(binary.LittleEndian.Uint16(b))), 10)), nil
+	case encInt32:
+		b, err := r.readBytes(4)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(b))), 10)), nil
+	case encLZF:
+		compressedLen, _, err := r.readLength()
+		if err != nil {
+			return nil, err
+		}
+		rawLen, _, err := r.readLength()
+		if err != nil {
+			return nil, err
+		}
+		compressed, err := r.readBytes(compressedLen)
+		// reject the length before allocating, it can't be larger than what the compressed data expands to
+		if err != nil || rawLen > compressedLen*lzfMaxExpansion {
+			return nil, ErrBadDataFormat
+		}
+		raw, err := lzfDecompress(compressed, int(rawLen))
+		if err != nil {
+			return nil, ErrBadDataFormat
+		}
+		return raw, nil
+	}
+	return nil, ErrBadDataFormat
+}
@@ -0,0 +1,152 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"runtime"
+	"testing"
+)
+
+// makePayload appends version and crc64 to body like DUMP
+func makePayload(body []byte, version uint16) []byte {
+	buf := appendUint16(append([]byte(nil), body...), version, binary.LittleEndian)
+	return appendUint64(buf, CRC64(buf), binary.LittleEndian)
+}
+
+func TestCRC64(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected uint64
+	}{
+		{"", 0},
+		{"123456789", 0xe9c6d914c4b8d9ca},
+	}
+	for _, tt := range tests {
+		if got := CRC64([]byte(tt.data)); got != tt.expected {
+			t.Errorf("crc64 of %q: expected %x, got %x", tt.data, tt.expected, got)
+		}
+	}
+}
+
+// TestParseRedisPayload parses the payload of DUMP in redis docs, which is created by redis 6.0 in rdb version 9
+func TestParseRedisPayload(t *testing.T) {
+	value, err := ParseDumpPayload([]byte("\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value.([]byte)) != "10" {
+		t.Fatalf("expected 10, got %q", value)
+	}
+}
+
+func TestStringEncoding(t *testing.T) {
+	tests := []struct {
+		value string
+		body  string // object type and encoded string
+	}{
+		{"10", "\x00\xc0\x0a"},
+		{"-128", "\x00\xc0\x80"},
+		{"128", "\x00\xc1\x80\x00"},
+		{"-32768", "\x00\xc1\x00\x80"},
+		{"32768", "\x00\xc2\x00\x80\x00\x00"},
+		{"2147483647", "\x00\xc2\xff\xff\xff\x7f"},
+		{"2147483648", "\x00\x0a2147483648"},
+		{"010", "\x00\x03010"},
+		{"+1", "\x00\x02+1"},
+		{"", "\x00\x00"},
+		{"hello", "\x00\x05hello"},
+		{string(bytes.Repeat([]byte("a"), 64)), "\x00\x40\x40" + string(bytes.Repeat([]byte("a"), 64))},
+		{string(bytes.Repeat([]byte("a"), 1<<14)), "\x00\x80\x00\x00\x40\x00" + string(bytes.Repeat([]byte("a"), 1<<14))},
+	}
+	for _, tt := range tests {
+		payload, err := MakeDumpPayload([]byte(tt.value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := makePayload([]byte(tt.body), Version)
+		if !bytes.Equal(payload, expected) {
+			t.Errorf("payload of %q: expected %q, got %q", tt.value, expected, payload)
+			continue
+		}
+		value, err := ParseDumpPayload(payload)
+		if err != nil {
+			t.Errorf("parse payload of %q: %v", tt.value, err)
+			continue
+		}
+		if string(value.([]byte)) != tt.value {
+			t.Errorf("expected %q, got %q", tt.value, value)
+		}
+	}
+}
+
+func TestParseLZF(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{"literal", "\x00\xc3\x04\x03\x02abc", "abc"},
+		{"back reference", "\x00\xc3\x05\x0a\x00a\xe0\x00\x00", "aaaaaaaaaa"},
+		{"short back reference", "\x00\xc3\x05\x05\x01ab\x20\x01", "ababa"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := ParseDumpPayload(makePayload([]byte(tt.body), Version))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(value.([]byte)) != tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, value)
+			}
+		})
+	}
+}
+
+func TestParseCorruptPayload(t *testing.T) {
+	valid, _ := MakeDumpPayload([]byte("hello"))
+	badChecksum := append([]byte(nil), valid...)
+	badChecksum[len(badChecksum)-1] ^= 1
+	tests := []struct {
+		name     string
+		payload  []byte
+		expected error
+	}{
+		{"empty", nil, ErrVersionOrChecksum},
+		{"too short", valid[:footerSize-1], ErrVersionOrChecksum},
+		{"checksum", badChecksum, ErrVersionOrChecksum},
+		{"newer version", makePayload([]byte("\x00\x05hello"), Version+1), ErrVersionOrChecksum},
+		{"no object", makePayload(nil, Version), ErrBadDataFormat},
+		{"unsupported type", makePayload([]byte("\x02\x00"), Version), ErrUnsupportedType},
+		{"truncated string", makePayload([]byte("\x00\x06hello"), Version), ErrBadDataFormat},
+		{"trailing bytes", makePayload([]byte("\x00\x04hello"), Version), ErrBadDataFormat},
+		{"truncated length", makePayload([]byte("\x00\x80\x00"), Version), ErrBadDataFormat},
+		{"invalid length", makePayload([]byte("\x00\x82"), Version), ErrBadDataFormat},
+		{"truncated int", makePayload([]byte("\x00\xc1\x01"), Version), ErrBadDataFormat},
+		{"invalid encoding", makePayload([]byte("\x00\xc4"), Version), ErrBadDataFormat},
+		{"lzf raw length", makePayload([]byte("\x00\xc3\x04\x04\x02abc"), Version), ErrBadDataFormat},
+		{"lzf reference", makePayload([]byte("\x00\xc3\x05\x0a\x00a\xe0\x00\x01"), Version), ErrBadDataFormat},
+		{"lzf truncated", makePayload([]byte("\x00\xc3\x04\x03\x03abc"), Version), ErrBadDataFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseDumpPayload(tt.payload); err != tt.expected {
+				t.Fatalf("expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+// TestParseHugeLZFLength checks that a small payload claiming a huge uncompressed length is rejected without allocation
+func TestParseHugeLZFLength(t *testing.T) {
+	payload := makePayload([]byte("\x00\xc3\x05\x80\x7f\xff\xff\xff\x00a\xe0\x00\x00"), Version)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := ParseDumpPayload(payload)
+	runtime.ReadMemStats(&after)
+	if err != ErrBadDataFormat {
+		t.Fatalf("expected %v, got %v", ErrBadDataFormat, err)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Fatalf("%d bytes are allocated", allocated)
+	}
+}
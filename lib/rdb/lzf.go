@@ -0,0 +1,54 @@
+package rdb
+
+import "errors"
+
+var errLzfCorrupted = errors.New("lzf: corrupted data")
+
+// lzfMaxExpansion is the max ratio of uncompressed to compressed length,
+// reached by back references of 3 bytes which copy 264 bytes each
+const lzfMaxExpansion = 264 / 3
+
+// lzfDecompress decompresses data compressed by lzf of redis, outLen is the length of uncompressed data
+func lzfDecompress(in []byte, outLen int) ([]byte, error) {
+	out := make([]byte, 0, outLen)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 1<<5 {
+			// literal run of ctrl+1 bytes
+			n := ctrl + 1
+			if i+n > len(in) || len(out)+n > outLen {
+				return nil, errLzfCorrupted
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+		// back reference, length is in the high 3 bits, 7 means an extra length byte follows
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, errLzfCorrupted
+			}
+			n += int(in[i])
+			i++
+		}
+		n += 2
+		if i >= len(in) {
+			return nil, errLzfCorrupted
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		if ref < 0 || len(out)+n > outLen {
+			return nil, errLzfCorrupted
+		}
+		// the reference may overlap with bytes being copied
+		for j := 0; j < n; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != outLen {
+		return nil, errLzfCorrupted
+	}
+	return out, nil
+}
@@ -0,0 +1,138 @@
+package wildcard
+
+const (
+	normal       = iota
+	all          // *
+	anyChar      // ?
+	setSymbol    // [a-z], [abc]
+	negSetSymbol // [^a-z]
+)
+
+type item struct {
+	character byte
+	set       *[256]bool
+	typ       int
+}
+
+func (i *item) match(c byte) bool {
+	switch i.typ {
+	case anyChar:
+		return true
+	case normal:
+		return i.character == c
+	case setSymbol:
+		return i.set[c]
+	case negSetSymbol:
+		return !i.set[c]
+	}
+	return false
+}
+
+// Pattern represents a wildcard pattern, the same as glob-style pattern of redis:
+//   - `*` matches any sequence of characters, including empty
+//   - `?` matches exactly one character
+//   - `[abc]`, `[a-z]` match one character in the set, `[^a]` matches one character not in the set
+//   - `\` escapes the next character
+type Pattern struct {
+	items []*item
+}
+
+// CompilePattern convert wildcard string to Pattern
+// like redis, an unclosed `[` takes the rest of pattern as its set and a trailing `\` matches itself
+func CompilePattern(src string) *Pattern {
+	items := make([]*item, 0, len(src))
+	for i := 0; i < len(src); i++ {
+		ch := src[i]
+		switch ch {
+		case '*':
+			// consecutive stars are equal to one
+			if len(items) > 0 && items[len(items)-1].typ == all {
+				continue
+			}
+			items = append(items, &item{typ: all})
+		case '?':
+			items = append(items, &item{typ: anyChar})
+		case '\\':
+			if i+1 < len(src) {
+				i++
+			}
+			items = append(items, &item{typ: normal, character: src[i]})
+		case '[':
+			var setItem *item
+			setItem, i = compileSet(src, i+1)
+			items = append(items, setItem)
+		default:
+			items = append(items, &item{typ: normal, character: ch})
+		}
+	}
+	return &Pattern{items: items}
+}
+
+// compileSet parses the set begins at src[start] (after `[`), returns the set item and position of `]`
+func compileSet(src string, start int) (*item, int) {
+	setItem := &item{typ: setSymbol, set: new([256]bool)}
+	i := start
+	if i < len(src) && src[i] == '^' {
+		setItem.typ = negSetSymbol
+		i++
+	}
+	for ; i < len(src) && src[i] != ']'; i++ {
+		ch := src[i]
+		if ch == '\\' && i+1 < len(src) {
+			i++
+			setItem.set[src[i]] = true
+			continue
+		}
+		if i+2 < len(src) && src[i+1] == '-' && src[i+2] != ']' {
+			begin, end := ch, src[i+2]
+			if begin > end {
+				begin, end = end, begin
+			}
+			for c := int(begin); c <= int(end); c++ {
+				setItem.set[c] = true
+			}
+			i += 2
+			continue
+		}
+		setItem.set[ch] = true
+	}
+	return setItem, i
+}
+
+// IsMatch returns whether the given string matches pattern
+func (p *Pattern) IsMatch(s string) bool {
+	items := p.items
+	i, j := 0, 0
+	// position of the last star in pattern and the position in s it began to match from
+	starItem, starPos := -1, 0
+	for j < len(s) {
+		if i < len(items) {
+			if items[i].typ == all {
+				starItem, starPos = i, j
+				i++
+				continue
+			}
+			if items[i].match(s[j]) {
+				i++
+				j++
+				continue
+			}
+		}
+		// mismatch, let the last star consume one more character
+		if starItem < 0 {
+			return false
+		}
+		i = starItem + 1
+		starPos++
+		j = starPos
+	}
+	for i < len(items) && items[i].typ == all {
+		i++
+	}
+	return i == len(items)
+}
+
+// IsMatchAll returns whether the pattern matches any string, such as `*`
+func (p *Pattern) IsMatchAll() bool {
+	return len(p.items) == 1 && p.items[0].typ == all
+}
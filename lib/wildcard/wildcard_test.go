@@ -0,0 +1,47 @@
+package wildcard
+
+import "testing"
+
+func TestPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		matched bool
+	}{
+		{"*", "", true},
+		{"*", "abc", true},
+		{"a*", "abc", true},
+		{"a*", "bac", false},
+		{"a**c", "abbc", true},
+		{"*b*", "abc", true},
+		{"*b", "abc", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[b-a]llo", "hallo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"[\\]]", "]", true},
+		{"a\\", "a\\", true},
+		{"a[bc", "ab", true},
+		{"a[bc", "a[", false},
+	}
+	for _, tt := range tests {
+		if got := CompilePattern(tt.pattern).IsMatch(tt.s); got != tt.matched {
+			t.Errorf("%q matching %q: expected %v, got %v", tt.pattern, tt.s, tt.matched, got)
+		}
+	}
+}
+
+func TestIsMatchAll(t *testing.T) {
+	for pattern, expected := range map[string]bool{"*": true, "**": true, "*a": false, "?": false, "": false} {
+		if got := CompilePattern(pattern).IsMatchAll(); got != expected {
+			t.Errorf("%q: expected %v, got %v", pattern, expected, got)
+		}
+	}
+}
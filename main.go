@@ -8,6 +8,7 @@ import (
 	"goRedis/resp/server"
 	"goRedis/tcp"
 	"os"
+	"time"
 )
 
 var banner = `goRedis prepare to start`
@@ -18,7 +19,17 @@ var defaultProperties = &config.ServerProperties{
 	AppendOnly:     true,
 	AppendFilename: "appendonly.aof",
 	MaxClients:     1000,
+	TCPKeepAlive:   300,
+	Databases:      16,
 	RunID:          utils.RandString(40),
+
+	SlowlogLogSlowerThan: 10000,
+	SlowlogMaxLen:        128,
+
+	MaxMemoryPolicy:  "noeviction",
+	MaxMemorySamples: 5,
+	LfuLogFactor:     10,
+	LfuDecayTime:     1,
 }
 
 const configFile string = "redis.conf"
@@ -41,11 +52,13 @@ func main() {
 	if fileExists(configFile) {
 		config.SetupConfig(configFile)
 	} else {
-		config.Properties = defaultProperties
+		config.SetProperties(defaultProperties)
 	}
 	// 开启监听
 	err := tcp.ListenAndServeWithSignal(&tcp.Config{
-		Address: fmt.Sprintf("%s:%d", config.Properties.Bind, config.Properties.Port),
+		Address:    fmt.Sprintf("%s:%d", config.Properties().Bind, config.Properties().Port),
+		MaxConnect: uint32(config.Properties().MaxClients),
+		KeepAlive:  time.Duration(config.Properties().TCPKeepAlive) * time.Second,
 	}, server.MakeHandler())
 	if err != nil {
 		logger.Error(err)
@@ -0,0 +1,184 @@
+package pubsub
+
+import (
+	"goRedis/interface/resp"
+	"goRedis/lib/logger"
+	"goRedis/lib/sync/atomic"
+	"goRedis/lib/wildcard"
+	"sync"
+	syncAtomic "sync/atomic"
+)
+
+const (
+	// subscriberBufferLimit is the max size of frames buffered for a subscriber, a subscriber which can't keep up
+	// is disconnected like redis closes clients exceeding the hard limit of client-output-buffer-limit pubsub
+	subscriberBufferLimit = 32 * 1024 * 1024
+	// subscriberBufferSize is the max number of frames buffered for a subscriber
+	subscriberBufferSize = 64 * 1024
+)
+
+// Hub stores all subscribers of channels and patterns
+type Hub struct {
+	mu sync.RWMutex
+	// channel -> subscribers
+	channels map[string]map[resp.Connection]struct{}
+	// pattern -> subscribers
+	patterns map[string]*patternSubscribers
+	// subscriber -> feed, a connection has a feed from its first subscription until it's closed,
+	// so that frames of the connection are always written by one goroutine in order
+	feeds map[resp.Connection]*subscriberFeed
+}
+
+type patternSubscribers struct {
+	matcher *wildcard.Pattern
+	conns   map[resp.Connection]struct{}
+}
+
+// MakeHub creates new hub
+func MakeHub() *Hub {
+	return &Hub{
+		channels: make(map[string]map[resp.Connection]struct{}),
+		patterns: make(map[string]*patternSubscribers),
+		feeds:    make(map[resp.Connection]*subscriberFeed),
+	}
+}
+
+// subscriberFeed writes frames to a subscriber in its own goroutine, so that a slow subscriber doesn't block publishers
+type subscriberFeed struct {
+	pending int64 // size of buffered frames, the first field to be aligned for atomic operations
+	conn    resp.Connection
+	frames  chan []byte // closed by hub when the connection is closed
+	killed  atomic.Boolean
+}
+
+func (f *subscriberFeed) run() {
+	for frame := range f.frames {
+		if err := f.conn.Write(frame); err != nil {
+			return
+		}
+		syncAtomic.AddInt64(&f.pending, -int64(len(frame)))
+	}
+}
+
+// feed never blocks, the subscriber is disconnected if its buffer is full. invoker should hold hub.mu
+func (f *subscriberFeed) feed(frame []byte) {
+	if syncAtomic.AddInt64(&f.pending, int64(len(frame))) <= subscriberBufferLimit {
+		select {
+		case f.frames <- frame:
+			return
+		default:
+		}
+	}
+	killer, ok := f.conn.(interface{ Kill() })
+	if ok && !f.killed.Get() {
+		f.killed.Set(true)
+		logger.Warn("close subscriber since it can't keep up with published messages")
+		killer.Kill()
+	}
+}
+
+// addFeed starts feed of the connection if it has no feed, invoker should hold hub.mu for writing
+func (hub *Hub) addFeed(c resp.Connection) {
+	if _, ok := hub.feeds[c]; ok {
+		return
+	}
+	f := &subscriberFeed{
+		conn:   c,
+		frames: make(chan []byte, subscriberBufferSize),
+	}
+	hub.feeds[c] = f
+	go f.run()
+}
+
+// removeFeed stops feed of the connection, invoked when the connection is closed
+func (hub *Hub) removeFeed(c resp.Connection) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if f, ok := hub.feeds[c]; ok {
+		delete(hub.feeds, c)
+		close(f.frames)
+	}
+}
+
+// push sends frame to the connection after frames queued in its feed, or writes it directly if there is no feed
+func (hub *Hub) push(c resp.Connection, frame []byte) {
+	hub.mu.RLock()
+	f, ok := hub.feeds[c]
+	if ok {
+		f.feed(frame)
+	}
+	hub.mu.RUnlock()
+	if !ok {
+		_ = c.Write(frame)
+	}
+}
+
+// subscribe returns false if the connection has subscribed the channel
+func (hub *Hub) subscribe(channel string, c resp.Connection) bool {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	subscribers, ok := hub.channels[channel]
+	if !ok {
+		subscribers = make(map[resp.Connection]struct{})
+		hub.channels[channel] = subscribers
+	}
+	if _, ok := subscribers[c]; ok {
+		return false
+	}
+	subscribers[c] = struct{}{}
+	hub.addFeed(c)
+	return true
+}
+
+func (hub *Hub) unsubscribe(channel string, c resp.Connection) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	subscribers, ok := hub.channels[channel]
+	if !ok {
+		return
+	}
+	delete(subscribers, c)
+	if len(subscribers) == 0 {
+		delete(hub.channels, channel)
+	}
+}
+
+// psubscribe returns false if the connection has subscribed the pattern
+func (hub *Hub) psubscribe(pattern string, c resp.Connection) bool {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	subscribers, ok := hub.patterns[pattern]
+	if !ok {
+		subscribers = &patternSubscribers{
+			matcher: wildcard.CompilePattern(pattern),
+			conns:   make(map[resp.Connection]struct{}),
+		}
+		hub.patterns[pattern] = subscribers
+	}
+	if _, ok := subscribers.conns[c]; ok {
+		return false
+	}
+	subscribers.conns[c] = struct{}{}
+	hub.addFeed(c)
+	return true
+}
+
+func (hub *Hub) punsubscribe(pattern string, c resp.Connection) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	subscribers, ok := hub.patterns[pattern]
+	if !ok {
+		return
+	}
+	delete(subscribers.conns, c)
+	if len(subscribers.conns) == 0 {
+		delete(hub.patterns, pattern)
+	}
+}
+
+// Count returns the number of channels and patterns which have subscribers
+func (hub *Hub) Count() (channels int, patterns int) {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	return len(hub.channels), len(hub.patterns)
+}
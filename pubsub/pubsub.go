@@ -0,0 +1,229 @@
+package pubsub
+
+import (
+	"goRedis/interface/resp"
+	"goRedis/lib/wildcard"
+	"goRedis/resp/reply"
+	"sort"
+	"strings"
+)
+
+var (
+	subscribeBytes    = []byte("subscribe")
+	unsubscribeBytes  = []byte("unsubscribe")
+	psubscribeBytes   = []byte("psubscribe")
+	punsubscribeBytes = []byte("punsubscribe")
+	messageBytes      = []byte("message")
+	pmessageBytes     = []byte("pmessage")
+)
+
+// writePush sends push frame to connection after published messages queued for it,
+// the frame is an array for RESP2 connections
+func writePush(hub *Hub, c resp.Connection, elements ...resp.Reply) {
+	var r resp.Reply = reply.MakePushReply(elements)
+	if c.GetProtocol() == 2 {
+		r = reply.ConvertToResp2(r)
+	}
+	hub.push(c, r.ToBytes())
+}
+
+func makeFrame(kind []byte, channel string, count int) []resp.Reply {
+	var channelReply resp.Reply = reply.MakeBulkReply([]byte(channel))
+	if channel == "" {
+		channelReply = reply.MakeNullBulkReply()
+	}
+	return []resp.Reply{reply.MakeBulkReply(kind), channelReply, reply.MakeIntReply(int64(count))}
+}
+
+// Subscribe puts the given connection into the given channel
+// SUBSCRIBE channel [channel ...]
+func Subscribe(hub *Hub, c resp.Connection, args [][]byte) resp.Reply {
+	for _, arg := range args {
+		channel := string(arg)
+		if hub.subscribe(channel, c) {
+			c.Subscribe(channel)
+		}
+		writePush(hub, c, makeFrame(subscribeBytes, channel, c.SubsCount())...)
+	}
+	return &reply.NoReply{}
+}
+
+// UnSubscribe removes the given connection from the given channels, or all channels if no channel given
+// UNSUBSCRIBE [channel [channel ...]]
+func UnSubscribe(hub *Hub, c resp.Connection, args [][]byte) resp.Reply {
+	var channels []string
+	if len(args) > 0 {
+		channels = make([]string, len(args))
+		for i, arg := range args {
+			channels[i] = string(arg)
+		}
+	} else {
+		channels = c.GetChannels()
+	}
+	if len(channels) == 0 {
+		writePush(hub, c, makeFrame(unsubscribeBytes, "", c.SubsCount())...)
+		return &reply.NoReply{}
+	}
+	for _, channel := range channels {
+		hub.unsubscribe(channel, c)
+		c.UnSubscribe(channel)
+		writePush(hub, c, makeFrame(unsubscribeBytes, channel, c.SubsCount())...)
+	}
+	return &reply.NoReply{}
+}
+
+// PSubscribe puts the given connection into the given patterns
+// PSUBSCRIBE pattern [pattern ...]
+func PSubscribe(hub *Hub, c resp.Connection, args [][]byte) resp.Reply {
+	for _, arg := range args {
+		pattern := string(arg)
+		if hub.psubscribe(pattern, c) {
+			c.PSubscribe(pattern)
+		}
+		writePush(hub, c, makeFrame(psubscribeBytes, pattern, c.SubsCount())...)
+	}
+	return &reply.NoReply{}
+}
+
+// PUnSubscribe removes the given connection from the given patterns, or all patterns if no pattern given
+// PUNSUBSCRIBE [pattern [pattern ...]]
+func PUnSubscribe(hub *Hub, c resp.Connection, args [][]byte) resp.Reply {
+	var patterns []string
+	if len(args) > 0 {
+		patterns = make([]string, len(args))
+		for i, arg := range args {
+			patterns[i] = string(arg)
+		}
+	} else {
+		patterns = c.GetPatterns()
+	}
+	if len(patterns) == 0 {
+		writePush(hub, c, makeFrame(punsubscribeBytes, "", c.SubsCount())...)
+		return &reply.NoReply{}
+	}
+	for _, pattern := range patterns {
+		hub.punsubscribe(pattern, c)
+		c.PUnSubscribe(pattern)
+		writePush(hub, c, makeFrame(punsubscribeBytes, pattern, c.SubsCount())...)
+	}
+	return &reply.NoReply{}
+}
+
+// UnsubscribeAll removes the given connection from all channels and patterns, invoked when connection closed
+func UnsubscribeAll(hub *Hub, c resp.Connection) {
+	for _, channel := range c.GetChannels() {
+		hub.unsubscribe(channel, c)
+	}
+	for _, pattern := range c.GetPatterns() {
+		hub.punsubscribe(pattern, c)
+	}
+	hub.removeFeed(c)
+}
+
+// frames holds a message encoded in RESP2 and RESP3, so that it is encoded once for all subscribers
+type frames struct {
+	resp2 []byte
+	resp3 []byte
+}
+
+func makeFrames(elements ...resp.Reply) *frames {
+	push := reply.MakePushReply(elements)
+	return &frames{
+		resp2: reply.ConvertToResp2(push).ToBytes(),
+		resp3: push.ToBytes(),
+	}
+}
+
+// feedTo queues the frame for subscriber, invoker should hold hub.mu
+func (f *frames) feedTo(hub *Hub, c resp.Connection) {
+	feed, ok := hub.feeds[c]
+	if !ok {
+		return
+	}
+	if c.GetProtocol() == 2 {
+		feed.feed(f.resp2)
+	} else {
+		feed.feed(f.resp3)
+	}
+}
+
+// Publish sends message to subscribers of the channel and the patterns matching the channel
+// returns the number of receivers
+// PUBLISH channel message
+func Publish(hub *Hub, args [][]byte) resp.Reply {
+	if len(args) != 2 {
+		return reply.MakeArgNumErrReply("publish")
+	}
+	channel := string(args[0])
+	message := args[1]
+
+	// messages are queued in feeds of subscribers which never block,
+	// so that a slow subscriber doesn't block publishers or SUBSCRIBE and UNSUBSCRIBE of other clients
+	count := 0
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if subscribers, ok := hub.channels[channel]; ok {
+		f := makeFrames(reply.MakeBulkReply(messageBytes), reply.MakeBulkReply(args[0]), reply.MakeBulkReply(message))
+		for c := range subscribers {
+			f.feedTo(hub, c)
+			count++
+		}
+	}
+	for pattern, subscribers := range hub.patterns {
+		if !subscribers.matcher.IsMatch(channel) {
+			continue
+		}
+		f := makeFrames(reply.MakeBulkReply(pmessageBytes), reply.MakeBulkReply([]byte(pattern)),
+			reply.MakeBulkReply(args[0]), reply.MakeBulkReply(message))
+		for c := range subscribers.conns {
+			f.feedTo(hub, c)
+			count++
+		}
+	}
+	return reply.MakeIntReply(int64(count))
+}
+
+// PubSubCommand introspects the state of pub/sub
+// PUBSUB CHANNELS [pattern] | NUMSUB [channel [channel ...]] | NUMPAT
+func PubSubCommand(hub *Hub, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("pubsub")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	switch subCmd {
+	case "channels":
+		if len(args) > 2 {
+			return reply.MakeArgNumErrReply("pubsub|channels")
+		}
+		var matcher *wildcard.Pattern
+		if len(args) == 2 {
+			matcher = wildcard.CompilePattern(string(args[1]))
+		}
+		channels := make([]string, 0, len(hub.channels))
+		for channel := range hub.channels {
+			if matcher == nil || matcher.IsMatch(channel) {
+				channels = append(channels, channel)
+			}
+		}
+		sort.Strings(channels)
+		result := make([][]byte, len(channels))
+		for i, channel := range channels {
+			result[i] = []byte(channel)
+		}
+		return reply.MakeMultiBulkReply(result)
+	case "numsub":
+		result := make([]resp.Reply, 0, 2*(len(args)-1))
+		for _, arg := range args[1:] {
+			result = append(result, reply.MakeBulkReply(arg), reply.MakeIntReply(int64(len(hub.channels[string(arg)]))))
+		}
+		return reply.MakeMapReply(result)
+	case "numpat":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("pubsub|numpat")
+		}
+		return reply.MakeIntReply(int64(len(hub.patterns)))
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try PUBSUB HELP.")
+}
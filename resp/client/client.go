@@ -1,6 +1,7 @@
 package client
 
 import (
+	"errors"
 	"goRedis/interface/resp"
 	"goRedis/lib/logger"
 	"goRedis/lib/sync/wait"
@@ -19,6 +20,10 @@ type Client struct {
 	waitingReqs chan *request // waiting response
 	ticker      *time.Ticker
 	addr        string
+	dialTimeout time.Duration // 0 means no timeout
+	timeout     time.Duration // max time to wait for a reply
+	user        string        // sent by AUTH after reconnected, empty means the legacy AUTH password
+	password    string        // sent by AUTH after reconnected, empty means no authentication
 
 	working *sync.WaitGroup // its counter presents unfinished requests(pending and waiting)
 }
@@ -38,21 +43,64 @@ const (
 	maxWait  = 3 * time.Second
 )
 
+// NetErrReply represents a request failed because of network or timeout, rather than an error replied by server
+type NetErrReply struct {
+	Msg string
+}
+
+// ToBytes marshals resp.Reply
+func (r *NetErrReply) ToBytes() []byte {
+	return []byte("-" + r.Msg + reply.CRLF)
+}
+
+func (r *NetErrReply) Error() string {
+	return r.Msg
+}
+
 // MakeClient creates a new client
 func MakeClient(addr string) (*Client, error) {
-	conn, err := net.Dial("tcp", addr)
+	return MakeClientWithTimeout(addr, 0, maxWait)
+}
+
+// MakeClientWithTimeout creates a new client with the given dial timeout and request timeout
+func MakeClientWithTimeout(addr string, dialTimeout time.Duration, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
 	if err != nil {
 		return nil, err
 	}
+	if timeout <= 0 {
+		timeout = maxWait
+	}
 	return &Client{
 		addr:        addr,
 		conn:        conn,
+		dialTimeout: dialTimeout,
+		timeout:     timeout,
 		pendingReqs: make(chan *request, chanSize),
 		waitingReqs: make(chan *request, chanSize),
 		working:     &sync.WaitGroup{},
 	}, nil
 }
 
+// Auth authenticates the connection, user and password are remembered and sent again after reconnected
+// user could be empty to use the legacy `AUTH password`, invoker should call it after Start
+func (client *Client) Auth(user string, password string) error {
+	client.user = user
+	client.password = password
+	result := client.Send(client.authCmdLine())
+	if !reply.IsOKReply(result) {
+		return errors.New("auth failed: " + string(result.ToBytes()))
+	}
+	return nil
+}
+
+func (client *Client) authCmdLine() [][]byte {
+	if client.user == "" {
+		return [][]byte{[]byte("AUTH"), []byte(client.password)}
+	}
+	return [][]byte{[]byte("AUTH"), []byte(client.user), []byte(client.password)}
+}
+
 // Start starts asynchronous goroutines
 func (client *Client) Start() {
 	client.ticker = time.NewTicker(10 * time.Second)
@@ -91,7 +139,7 @@ func (client *Client) handleConnectionError(err error) error {
 			return err1
 		}
 	}
-	conn, err1 := net.Dial("tcp", client.addr)
+	conn, err1 := net.DialTimeout("tcp", client.addr, client.dialTimeout)
 	if err1 != nil {
 		logger.Error(err1)
 		return err1
@@ -100,9 +148,28 @@ func (client *Client) handleConnectionError(err error) error {
 	go func() {
 		_ = client.handleRead()
 	}()
+	if client.password != "" {
+		client.reAuth()
+	}
 	return nil
 }
 
+// reAuth sends AUTH on a new connection within the writing goroutine, so it is answered before pending requests
+func (client *Client) reAuth() {
+	req := &request{
+		args:      client.authCmdLine(),
+		heartbeat: true,
+		waiting:   &wait.Wait{},
+	}
+	req.waiting.Add(1)
+	_, err := client.conn.Write(reply.MakeMultiBulkReply(req.args).ToBytes())
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	client.waitingReqs <- req
+}
+
 func (client *Client) heartbeat() {
 	for range client.ticker.C {
 		client.doHeartbeat()
@@ -117,6 +184,11 @@ func (client *Client) handleWrite() {
 
 // Send sends a request to redis server
 func (client *Client) Send(args [][]byte) resp.Reply {
+	return client.SendWithTimeout(args, client.timeout)
+}
+
+// SendWithTimeout sends a request to redis server and waits for its reply at most timeout
+func (client *Client) SendWithTimeout(args [][]byte, timeout time.Duration) resp.Reply {
 	request := &request{
 		args:      args,
 		heartbeat: false,
@@ -126,12 +198,11 @@ func (client *Client) Send(args [][]byte) resp.Reply {
 	client.working.Add(1)
 	defer client.working.Done()
 	client.pendingReqs <- request
-	timeout := request.waiting.WaitWithTimeout(maxWait)
-	if timeout {
-		return reply.MakeErrReply("server time out")
+	if request.waiting.WaitWithTimeout(timeout) {
+		return &NetErrReply{Msg: "server time out"}
 	}
 	if request.err != nil {
-		return reply.MakeErrReply("request failed")
+		return &NetErrReply{Msg: "request failed"}
 	}
 	return request.reply
 }
@@ -146,7 +217,7 @@ func (client *Client) doHeartbeat() {
 	client.working.Add(1)
 	defer client.working.Done()
 	client.pendingReqs <- request
-	request.waiting.WaitWithTimeout(maxWait)
+	request.waiting.WaitWithTimeout(client.timeout)
 }
 
 func (client *Client) doRequest(req *request) {
@@ -190,13 +261,18 @@ func (client *Client) finishRequest(reply resp.Reply) {
 }
 
 func (client *Client) handleRead() error {
-	ch := parser.ParseStream(client.conn)
-	for payload := range ch {
-		if payload.Err != nil {
-			client.finishRequest(reply.MakeErrReply(payload.Err.Error()))
-			continue
+	p := parser.NewParser(client.conn)
+	defer p.Release()
+	for {
+		result, err := p.Next()
+		if err != nil {
+			client.finishRequest(reply.MakeErrReply(err.Error()))
+			if parser.IsProtocolError(err) {
+				continue
+			}
+			// connection is broken, stop reading
+			return nil
 		}
-		client.finishRequest(payload.Data)
+		client.finishRequest(result)
 	}
-	return nil
 }
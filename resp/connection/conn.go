@@ -2,34 +2,85 @@ package connection
 
 import (
 	"bytes"
+	"goRedis/lib/sync/atomic"
 	"goRedis/lib/sync/wait"
 	"net"
 	"sync"
+	syncAtomic "sync/atomic"
 	"time"
 )
 
+// maxPendingSize is the max size of buffered replies, buffer is flushed when exceeded
+const maxPendingSize = 64 * 1024
+
 type Connection struct {
 	conn         net.Conn
 	waitingReply wait.Wait
 	mu           sync.Mutex
-	selectedDB   int
+	selectedDB   int32
+
+	// client information shown by CLIENT LIST, fields may be read by other connections
+	id              uint64
+	name            syncAtomic.Value // string
+	createdAt       time.Time
+	lastCmd         syncAtomic.Value // string
+	lastInteraction int64            // unix nano
+	noEvict         atomic.Boolean
+	closeAfterReply atomic.Boolean
+	monitor         atomic.Boolean
+	paused          atomic.Boolean // blocked by CLIENT PAUSE
+
+	// replies buffered by WriteBuffered and not flushed yet, guarded by mu
+	pending []byte
+
+	// name of authenticated user, empty means not authenticated
+	user syncAtomic.Value // string
+
+	// RESP version, 0 means the default RESP2
+	protocol int32
+
+	// subscribed channels and patterns, guarded by subMu instead of mu which is held while writing,
+	// so that CLIENT LIST of other connections isn't blocked by a slow client
+	subMu sync.Mutex
+	subs  map[string]bool
+	psubs map[string]bool
+
+	// queued commands for `multi`, the queue is guarded by txMu since CLIENT LIST reads its length.
+	// txMu is never held while writing, so that a slow client doesn't block others
+	multiState atomic.Boolean
+	txMu       sync.Mutex
+	queue      [][][]byte
+	txErrors   []error
 }
 
+// nextID is used to generate unique id of connections
+var nextID uint64
+
 func NewConn(conn net.Conn) *Connection {
+	now := time.Now()
 	return &Connection{
-		conn: conn,
+		conn:            conn,
+		id:              syncAtomic.AddUint64(&nextID, 1),
+		createdAt:       now,
+		lastInteraction: now.UnixNano(),
 	}
 }
 func (c *Connection) RemoteAddr() net.Addr {
 	return c.conn.RemoteAddr()
 }
 
+// LocalAddr returns the address of server which client connected to
+func (c *Connection) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
 func (c *Connection) Close() error {
 	c.waitingReply.WaitWithTimeout(10 * time.Second)
 	_ = c.conn.Close()
 	return nil
 }
 
+// Write sends data to client immediately, buffered replies are sent before it to keep the order
 func (c *Connection) Write(bytes []byte) error {
 	if len(bytes) == 0 {
 		return nil
@@ -40,19 +91,296 @@ func (c *Connection) Write(bytes []byte) error {
 		c.waitingReply.Done()
 		c.mu.Unlock()
 	}()
+	if len(c.pending) > 0 {
+		c.pending = append(c.pending, bytes...)
+		return c.flushLocked()
+	}
 	_, err := c.conn.Write(bytes)
 	return err
 }
 
+// WriteBuffered appends data to the write buffer, it is sent by Flush or the next Write.
+// used by handler to send replies of pipelined commands with one syscall
+func (c *Connection) WriteBuffered(bytes []byte) error {
+	if len(bytes) == 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending = append(c.pending, bytes...)
+	if len(c.pending) >= maxPendingSize {
+		c.waitingReply.Add(1)
+		defer c.waitingReply.Done()
+		return c.flushLocked()
+	}
+	return nil
+}
+
+// Flush sends buffered data to client
+func (c *Connection) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.pending) == 0 {
+		return nil
+	}
+	c.waitingReply.Add(1)
+	defer c.waitingReply.Done()
+	return c.flushLocked()
+}
+
+func (c *Connection) flushLocked() error {
+	_, err := c.conn.Write(c.pending)
+	if cap(c.pending) > maxPendingSize {
+		c.pending = nil // don't hold the memory of a huge reply
+	} else {
+		c.pending = c.pending[:0]
+	}
+	return err
+}
+
+// Kill closes the connection at once without waiting replies, used by CLIENT KILL.
+// the handler finds the connection closed when reading the next request and cleans up
+func (c *Connection) Kill() {
+	_ = c.conn.Close()
+}
+
+// SetCloseAfterReply marks the connection to be closed after the reply of current command is sent
+func (c *Connection) SetCloseAfterReply() {
+	c.closeAfterReply.Set(true)
+}
+
+// IsCloseAfterReply returns whether the connection should be closed after current reply
+func (c *Connection) IsCloseAfterReply() bool {
+	return c.closeAfterReply.Get()
+}
+
+// GetID returns the unique id of connection, 0 for fake connections
+func (c *Connection) GetID() uint64 {
+	return c.id
+}
+
+// SetName sets the name set by CLIENT SETNAME, empty string removes the name
+func (c *Connection) SetName(name string) {
+	c.name.Store(name)
+}
+
+// GetName returns the name of connection, empty string if not set
+func (c *Connection) GetName() string {
+	name, _ := c.name.Load().(string)
+	return name
+}
+
+// RecordCommand updates the last command and the time of last interaction
+func (c *Connection) RecordCommand(cmdName string) {
+	c.lastCmd.Store(cmdName)
+	syncAtomic.StoreInt64(&c.lastInteraction, time.Now().UnixNano())
+}
+
+// GetLastCommand returns the name of the last command
+func (c *Connection) GetLastCommand() string {
+	cmd, _ := c.lastCmd.Load().(string)
+	return cmd
+}
+
+// GetAge returns how long the connection has been established
+func (c *Connection) GetAge() time.Duration {
+	return time.Since(c.createdAt)
+}
+
+// GetIdleTime returns the time since the last command
+func (c *Connection) GetIdleTime() time.Duration {
+	return time.Duration(time.Now().UnixNano() - syncAtomic.LoadInt64(&c.lastInteraction))
+}
+
+// SetNoEvict sets the flag set by CLIENT NO-EVICT
+func (c *Connection) SetNoEvict(noEvict bool) {
+	c.noEvict.Set(noEvict)
+}
+
+// IsNoEvict returns whether the connection is excluded from client eviction
+func (c *Connection) IsNoEvict() bool {
+	return c.noEvict.Get()
+}
+
+// SetMonitor marks the connection receives commands of all clients after MONITOR
+func (c *Connection) SetMonitor(monitor bool) {
+	c.monitor.Set(monitor)
+}
+
+// IsMonitor returns whether the connection is a monitor
+func (c *Connection) IsMonitor() bool {
+	return c.monitor.Get()
+}
+
+// SetPaused marks the connection is waiting for CLIENT UNPAUSE,
+// the idle time restarts when resumed so that the client isn't closed before executing its command
+func (c *Connection) SetPaused(paused bool) {
+	if !paused {
+		syncAtomic.StoreInt64(&c.lastInteraction, time.Now().UnixNano())
+	}
+	c.paused.Set(paused)
+}
+
+// IsPaused returns whether the connection is blocked by CLIENT PAUSE
+func (c *Connection) IsPaused() bool {
+	return c.paused.Get()
+}
+
 func (c *Connection) GetDBIndex() int {
-	return c.selectedDB
+	return int(syncAtomic.LoadInt32(&c.selectedDB))
 }
 
 func (c *Connection) SelectDB(dbNum int) {
-	c.selectedDB = dbNum
+	syncAtomic.StoreInt32(&c.selectedDB, int32(dbNum))
+}
+
+// SetUser records the user authenticated by AUTH
+func (c *Connection) SetUser(user string) {
+	c.user.Store(user)
+}
+
+// GetUser returns the authenticated user, returns empty string if not authenticated
+func (c *Connection) GetUser() string {
+	user, _ := c.user.Load().(string)
+	return user
+}
+
+// SetProtocol sets RESP version of connection
+func (c *Connection) SetProtocol(protocol int) {
+	syncAtomic.StoreInt32(&c.protocol, int32(protocol))
+}
+
+// GetProtocol returns RESP version of connection, 2 or 3
+func (c *Connection) GetProtocol() int {
+	protocol := syncAtomic.LoadInt32(&c.protocol)
+	if protocol == 0 {
+		return 2
+	}
+	return int(protocol)
+}
+
+// Subscribe adds current connection into subscribers of the given channel
+func (c *Connection) Subscribe(channel string) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	if c.subs == nil {
+		c.subs = make(map[string]bool)
+	}
+	c.subs[channel] = true
+}
+
+// UnSubscribe removes current connection from subscribers of the given channel
+func (c *Connection) UnSubscribe(channel string) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	delete(c.subs, channel)
+}
+
+// PSubscribe adds current connection into subscribers of the given pattern
+func (c *Connection) PSubscribe(pattern string) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	if c.psubs == nil {
+		c.psubs = make(map[string]bool)
+	}
+	c.psubs[pattern] = true
+}
+
+// PUnSubscribe removes current connection from subscribers of the given pattern
+func (c *Connection) PUnSubscribe(pattern string) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	delete(c.psubs, pattern)
+}
+
+// SubsCount returns the number of subscribed channels and patterns
+func (c *Connection) SubsCount() int {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	return len(c.subs) + len(c.psubs)
+}
+
+// GetChannels returns all subscribed channels
+func (c *Connection) GetChannels() []string {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	channels := make([]string, 0, len(c.subs))
+	for channel := range c.subs {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// GetPatterns returns all subscribed patterns
+func (c *Connection) GetPatterns() []string {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	patterns := make([]string, 0, len(c.psubs))
+	for pattern := range c.psubs {
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+// InMultiState tells is connection in an uncommitted transaction
+func (c *Connection) InMultiState() bool {
+	return c.multiState.Get()
+}
+
+// SetMultiState sets transaction flag
+func (c *Connection) SetMultiState(state bool) {
+	if !state { // reset data when cancel multi
+		c.txMu.Lock()
+		c.queue = nil
+		c.txErrors = nil
+		c.txMu.Unlock()
+	}
+	c.multiState.Set(state)
+}
+
+// GetQueuedCmdLine returns queued commands of current transaction
+func (c *Connection) GetQueuedCmdLine() [][][]byte {
+	c.txMu.Lock()
+	defer c.txMu.Unlock()
+	return c.queue
+}
+
+// QueuedCmdCount returns the number of queued commands, used by CLIENT LIST of other connections
+func (c *Connection) QueuedCmdCount() int {
+	c.txMu.Lock()
+	defer c.txMu.Unlock()
+	return len(c.queue)
+}
+
+// EnqueueCmd  enqueues command of current transaction
+func (c *Connection) EnqueueCmd(cmdLine [][]byte) {
+	c.txMu.Lock()
+	defer c.txMu.Unlock()
+	c.queue = append(c.queue, cmdLine)
+}
+
+// ClearQueuedCmds clears queued commands of current transaction
+func (c *Connection) ClearQueuedCmds() {
+	c.txMu.Lock()
+	defer c.txMu.Unlock()
+	c.queue = nil
+}
+
+// AddTxError stores syntax error within transaction
+func (c *Connection) AddTxError(err error) {
+	c.txMu.Lock()
+	defer c.txMu.Unlock()
+	c.txErrors = append(c.txErrors, err)
+}
+
+// GetTxErrors returns syntax error within transaction
+func (c *Connection) GetTxErrors() []error {
+	c.txMu.Lock()
+	defer c.txMu.Unlock()
+	return c.txErrors
 }
 
-// FakeConn implements redis.Connection for test
+// FakeConn implements redis.Connection for aof loading and test, it is trusted and never requires authentication
 type FakeConn struct {
 	Connection
 	buf bytes.Buffer
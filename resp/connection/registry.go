@@ -0,0 +1,67 @@
+package connection
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// clients holds connections of all clients, used by CLIENT LIST and CLIENT KILL
+var clients sync.Map // id -> *Connection
+
+var (
+	clientCount int64
+	// totalConnections is the number of clients registered since start, shown by INFO
+	totalConnections int64
+)
+
+// Register adds connection into registry, invoked when a client connected
+func Register(c *Connection) {
+	clients.Store(c.id, c)
+	atomic.AddInt64(&clientCount, 1)
+	atomic.AddInt64(&totalConnections, 1)
+}
+
+// Unregister removes connection from registry, invoked when a client closed
+func Unregister(c *Connection) {
+	if _, ok := clients.LoadAndDelete(c.id); ok {
+		atomic.AddInt64(&clientCount, -1)
+	}
+}
+
+// CountClients returns the number of connected clients
+func CountClients() int {
+	return int(atomic.LoadInt64(&clientCount))
+}
+
+// GetTotalConnections returns the number of clients connected since start
+func GetTotalConnections() int64 {
+	return atomic.LoadInt64(&totalConnections)
+}
+
+// GetClient returns the connection of the given id, returns nil if not found
+func GetClient(id uint64) *Connection {
+	raw, ok := clients.Load(id)
+	if !ok {
+		return nil
+	}
+	return raw.(*Connection)
+}
+
+// ListClients returns all connections ordered by id
+func ListClients() []*Connection {
+	var result []*Connection
+	clients.Range(func(key, value interface{}) bool {
+		result = append(result, value.(*Connection))
+		return true
+	})
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].id < result[j].id
+	})
+	return result
+}
+
+// ResetStats resets statistics of connections, invoked by CONFIG RESETSTAT
+func ResetStats() {
+	atomic.StoreInt64(&totalConnections, 0)
+}
@@ -0,0 +1,158 @@
+package parser
+
+import (
+	"bufio"
+	"errors"
+	"goRedis/interface/resp"
+	"goRedis/resp/reply"
+	"strconv"
+)
+
+// maxInlineSize is the max length of an inline command, the same as PROTO_INLINE_MAX_SIZE of redis
+const maxInlineSize = 64 * 1024
+
+// errInlineTooBig is fatal, parser stops reading because the rest of stream can't be trusted
+var errInlineTooBig = errors.New("ERR Protocol error: too big inline request")
+
+// startsWithArray returns whether the next request is a RESP array, otherwise it is an inline command
+func (p *Parser) startsWithArray() bool {
+	b, err := p.reader.Peek(1)
+	// let parseReply handle io errors
+	return err != nil || b[0] == '*'
+}
+
+// parseInline reads an inline command, returns nil if the line is empty
+func (p *Parser) parseInline() (resp.Reply, error) {
+	line, err := p.readInlineLine()
+	if err != nil {
+		return nil, err
+	}
+	args, err := splitArgs(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, nil
+	}
+	return reply.MakeMultiBulkReply(args), nil
+}
+
+// readInlineLine reads a line ends with \n or \r\n, returns the line without line separator
+// the line may refer to the buffer of reader, it is only valid until the next read
+func (p *Parser) readInlineLine() ([]byte, error) {
+	line, err := p.reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		line = append([]byte(nil), line...)
+		for err == bufio.ErrBufferFull {
+			var fragment []byte
+			fragment, err = p.reader.ReadSlice('\n')
+			if len(line)+len(fragment) > maxInlineSize {
+				return nil, errInlineTooBig
+			}
+			line = append(line, fragment...)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// splitArgs splits line into arguments like sdssplitargs of redis:
+// arguments are separated by spaces, double quoted argument supports escapes like \n and \x41,
+// single quoted argument only supports \'. A closing quote must be followed by a space or the end of line
+func splitArgs(line []byte) ([][]byte, error) {
+	var args [][]byte
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i >= len(line) {
+			return args, nil
+		}
+		var arg []byte
+		inDoubleQuotes, inSingleQuotes := false, false
+		for done := false; !done; {
+			if i >= len(line) {
+				if inDoubleQuotes || inSingleQuotes {
+					return nil, &protocolError{msg: "unbalanced quotes in request"}
+				}
+				break
+			}
+			c := line[i]
+			switch {
+			case inDoubleQuotes:
+				if c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]) {
+					b, _ := strconv.ParseUint(string(line[i+2:i+4]), 16, 8)
+					arg = append(arg, byte(b))
+					i += 3
+				} else if c == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						arg = append(arg, '\n')
+					case 'r':
+						arg = append(arg, '\r')
+					case 't':
+						arg = append(arg, '\t')
+					case 'b':
+						arg = append(arg, '\b')
+					case 'a':
+						arg = append(arg, '\a')
+					default:
+						arg = append(arg, line[i])
+					}
+				} else if c == '"' {
+					// closing quote must be followed by a space or nothing at all
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, &protocolError{msg: "unbalanced quotes in request"}
+					}
+					done = true
+				} else {
+					arg = append(arg, c)
+				}
+			case inSingleQuotes:
+				if c == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					arg = append(arg, '\'')
+				} else if c == '\'' {
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, &protocolError{msg: "unbalanced quotes in request"}
+					}
+					done = true
+				} else {
+					arg = append(arg, c)
+				}
+			default:
+				switch c {
+				case ' ', '\n', '\r', '\t', '\v', '\f':
+					done = true
+				case '"':
+					inDoubleQuotes = true
+				case '\'':
+					inSingleQuotes = true
+				default:
+					arg = append(arg, c)
+				}
+			}
+			i++
+		}
+		if arg == nil {
+			arg = []byte{}
+		}
+		args = append(args, arg)
+	}
+}
@@ -2,254 +2,422 @@ package parser
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
-	"fmt"
 	"goRedis/interface/resp"
-	"goRedis/lib/logger"
 	"goRedis/resp/reply"
 	"io"
-	"runtime/debug"
+	"math/big"
 	"strconv"
-	"strings"
+	"sync"
 )
 
-/* 把客服端发来的消息进行解析*/
+/* 把客服端发来的消息进行解析，也用于解析服务端的回复，支持 RESP2 和 RESP3 */
 
-// Payload stores resp.Reply or error
-type Payload struct {
-	Data resp.Reply // 客户端发送的消息和服务端回复的是一样的，所以公用reply
-	Err  error
+const (
+	readerBufSize = 16 * 1024
+	// bulk strings longer than bulkChunkSize are read chunk by chunk,
+	// so that a forged length can't make the parser allocate huge memory before data arrives
+	bulkChunkSize = 64 * 1024
+	// DefaultMaxBulkLen is the default value of proto-max-bulk-len
+	DefaultMaxBulkLen = 512 * 1024 * 1024
+	// maxMultiBulkLen is the max number of arguments in a request, the same as redis
+	maxMultiBulkLen = 1024 * 1024
+)
+
+// protocolError represents malformed data, parser skips the malformed line and continues
+// other errors are fatal, the connection should be closed after them
+type protocolError struct {
+	msg string
+}
+
+func (e *protocolError) Error() string {
+	return "ERR Protocol error: " + e.msg
 }
 
-// readState stores parser status
-type readState struct {
-	readingMultiLine  bool     //parser one or multi data
-	expectedArgsCount int      // 期望的参数个数
-	msgType           byte     // 信息类型
-	args              [][]byte // 传过来的数据
-	bulkLen           int64    // 字符串长度
+func makeProtocolError(line []byte) error {
+	return &protocolError{msg: strconv.Quote(string(line))}
 }
 
-// ParseStream reads data form io.Reader and send payloads through channel
+// IsProtocolError returns whether err is caused by malformed data, parser can continue after it
+func IsProtocolError(err error) bool {
+	_, ok := err.(*protocolError)
+	return ok
+}
+
+var (
+	errInvalidBulkLen      = errors.New("ERR Protocol error: invalid bulk length")
+	errInvalidMultiBulkLen = errors.New("ERR Protocol error: invalid multibulk length")
+	// lines of requests longer than maxInlineSize are fatal like redis, the rest of stream can't be trusted
+	errBulkLenTooBig      = errors.New("ERR Protocol error: too big bulk count string")
+	errMultiBulkLenTooBig = errors.New("ERR Protocol error: too big mbulk count string")
+)
+
+// readerPool reuses read buffers of closed connections
+var readerPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewReaderSize(nil, readerBufSize)
+	},
+}
+
+// Parser reads replies from io.Reader synchronously, it is not safe for concurrent use
+type Parser struct {
+	reader *bufio.Reader
+	// request mode accepts inline commands and limits the size of requests
+	allowInline bool
+	maxBulkLen  int64
+	maxArrayLen int64
+}
+
+// NewParser creates a parser for replies sent by server, such as replies of peers and aof file
 // net.Conn 类型实现了 io.Reader 接口，这意味着可以使用 net.Conn 类型的对象作为 io.Reader 类型的参数
-func ParseStream(reader io.Reader) <-chan *Payload {
-	ch := make(chan *Payload)
-	go parse0(reader, ch) // 为了异步的做协议的解析
-	return ch
+func NewParser(reader io.Reader) *Parser {
+	bufReader := readerPool.Get().(*bufio.Reader)
+	bufReader.Reset(reader)
+	return &Parser{
+		reader: bufReader,
+	}
 }
 
-func (s *readState) finished() bool {
-	return s.expectedArgsCount > 0 && len(s.args) == s.expectedArgsCount
+// NewRequestParser creates a parser for requests sent by clients,
+// besides RESP arrays, it accepts inline commands such as `SET key "hello world"` typed in telnet.
+// bulk strings longer than maxBulkLen (DefaultMaxBulkLen if not positive) and arrays longer than 1M are rejected
+func NewRequestParser(reader io.Reader, maxBulkLen int64) *Parser {
+	p := NewParser(reader)
+	p.allowInline = true
+	if maxBulkLen <= 0 {
+		maxBulkLen = DefaultMaxBulkLen
+	}
+	p.maxBulkLen = maxBulkLen
+	p.maxArrayLen = maxMultiBulkLen
+	return p
 }
 
-func parse0(reader io.Reader, ch chan<- *Payload) {
-	defer func() {
-		if err := recover(); err != nil {
-			logger.Error(string(debug.Stack()))
+// Next blocks until a complete reply is read, returns io.EOF if the stream ends.
+// parser can continue after errors that IsProtocolError returns true, other errors are fatal
+func (p *Parser) Next() (resp.Reply, error) {
+	if !p.allowInline {
+		return p.parseReply()
+	}
+	for !p.startsWithArray() {
+		result, err := p.parseInline()
+		if err != nil || result != nil {
+			return result, err
 		}
-	}()
-	bufReader := bufio.NewReader(reader)
-	var state readState
-	var err error
-	var msg []byte
+		// skip empty line
+	}
+	return p.parseReply()
+}
+
+// Buffered returns the number of bytes that have been received but not parsed yet
+func (p *Parser) Buffered() int {
+	return p.reader.Buffered()
+}
+
+// Release puts the buffer back to pool, parser can't be used after released
+func (p *Parser) Release() {
+	p.reader.Reset(nil)
+	readerPool.Put(p.reader)
+	p.reader = nil
+}
+
+// ParseBytes reads data from []byte and return all replies
+func ParseBytes(data []byte) ([]resp.Reply, error) {
+	p := NewParser(bytes.NewReader(data))
+	defer p.Release()
+	var results []resp.Reply
 	for {
-		// read line
-		var ioErr bool
-		msg, ioErr, err = readLine(bufReader, &state) // 以\r\n为结尾的一个个读出来
-		fmt.Printf("msg is %s\n", msg)
+		result, err := p.Next()
+		if err == io.EOF {
+			return results, nil
+		}
 		if err != nil {
-			if ioErr { // encounter io err, stop read
-				ch <- &Payload{
-					Err: err,
-				}
-				close(ch)
-				return
-			}
-			// reply err, reset read state
-			ch <- &Payload{
-				Err: err,
-			}
-			state = readState{}
-			continue
-		}
-
-		// parse line
-		if !state.readingMultiLine {
-			// receive new response
-			if msg[0] == '*' {
-				// multi bulk reply
-				err = parseMultiBulkHeader(msg, &state)
-				if err != nil {
-					ch <- &Payload{
-						Err: errors.New("reply error: " + string(msg)),
-					}
-					state = readState{} // reset state
-					continue
-				}
-				if state.expectedArgsCount == 0 {
-					ch <- &Payload{
-						Data: &reply.EmptyMultiBulkReply{},
-					}
-					state = readState{} // reset state
-					continue
-				}
-			} else if msg[0] == '$' { // bulk reply
-				err = parseBulkHeader(msg, &state)
-				if err != nil {
-					ch <- &Payload{
-						Err: errors.New("reply error: " + string(msg)),
-					}
-					state = readState{} // reset state
-					continue
-				}
-				if state.bulkLen == -1 { // null bulk reply
-					ch <- &Payload{
-						Data: &reply.NullBulkReply{},
-					}
-					state = readState{} // reset state
-					continue
-				}
-			} else {
-				// single line reply
-				result, err := parseSingleLineReply(msg)
-				ch <- &Payload{
-					Data: result,
-					Err:  err,
+			return nil, err
+		}
+		results = append(results, result)
+	}
+}
+
+// readLine reads a line ends with \r\n, returns the line without \r\n.
+// the line refers to the buffer of reader, it is only valid until the next read.
+// in request mode lines longer than maxInlineSize are rejected, since headers of arrays and bulk strings are short
+func (p *Parser) readLine() ([]byte, error) {
+	line, err := p.reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		// line longer than buffer is rare, copy it out
+		line = append([]byte(nil), line...)
+		for err == bufio.ErrBufferFull {
+			var fragment []byte
+			fragment, err = p.reader.ReadSlice('\n')
+			if p.allowInline && len(line)+len(fragment) > maxInlineSize {
+				if line[0] == '*' {
+					return nil, errMultiBulkLenTooBig
 				}
-				state = readState{} // reset state
-				continue
+				return nil, errBulkLenTooBig
 			}
-		} else {
-			// receive following bulk reply
-			err = readBody(msg, &state)
-			if err != nil {
-				ch <- &Payload{
-					Err: errors.New("reply error: " + string(msg)),
-				}
-				state = readState{} // reset state
-				continue
+			line = append(line, fragment...)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, makeProtocolError(line)
+	}
+	return line[:len(line)-2], nil
+}
+
+// readBlob reads a binary safe string of the given length and the following \r\n
+func (p *Parser) readBlob(length int64) ([]byte, error) {
+	var body []byte
+	if length+2 <= bulkChunkSize {
+		body = make([]byte, length+2)
+		if _, err := io.ReadFull(p.reader, body); err != nil {
+			return nil, err
+		}
+	} else {
+		// memory grows with received data instead of the declared length
+		for remain := length + 2; remain > 0; {
+			n := remain
+			if n > bulkChunkSize {
+				n = bulkChunkSize
 			}
-			// if sending finished
-			if state.finished() {
-				var result resp.Reply
-				if state.msgType == '*' {
-					result = reply.MakeMultiBulkReply(state.args)
-				} else if state.msgType == '$' {
-					result = reply.MakeBulkReply(state.args[0])
-				}
-				ch <- &Payload{
-					Data: result,
-					Err:  err,
-				}
-				state = readState{}
+			start := len(body)
+			body = append(body, make([]byte, n)...)
+			if _, err := io.ReadFull(p.reader, body[start:]); err != nil {
+				return nil, err
 			}
+			remain -= n
 		}
 	}
+	if body[length] != '\r' || body[length+1] != '\n' {
+		return nil, &protocolError{msg: "bulk string is not terminated by CRLF"}
+	}
+	return body[:length], nil
 }
 
-func readLine(bufReader *bufio.Reader, state *readState) ([]byte, bool, error) {
-	var msg []byte
-	var err error
-	if state.bulkLen == 0 { // read normal line
-		msg, err = bufReader.ReadBytes('\n')
-		if err != nil {
-			return nil, true, err
+// parseInt parses decimal integer in line without allocation
+func parseInt(b []byte) (int64, bool) {
+	negative := len(b) > 0 && b[0] == '-'
+	if negative {
+		b = b[1:]
+	}
+	if len(b) == 0 || len(b) > 19 {
+		return 0, false
+	}
+	var n int64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
 		}
-		if len(msg) == 0 || msg[len(msg)-2] != '\r' {
-			return nil, false, errors.New("reply error: " + string(msg))
+		n = n*10 + int64(c-'0')
+		if n < 0 { // overflow
+			return 0, false
 		}
-	} else { // read bulk line (binary safe)
-		msg = make([]byte, state.bulkLen+2)
-		_, err = io.ReadFull(bufReader, msg)
+	}
+	if negative {
+		n = -n
+	}
+	return n, true
+}
+
+// parseLength parses the length after type byte, -1 means null
+func parseLength(line []byte) (int64, error) {
+	length, ok := parseInt(line[1:])
+	if !ok || length < -1 {
+		return 0, makeProtocolError(line)
+	}
+	return length, nil
+}
+
+// parseReply reads a complete reply, aggregate replies are parsed recursively
+func (p *Parser) parseReply() (resp.Reply, error) {
+	line, err := p.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, makeProtocolError(line)
+	}
+	switch line[0] {
+	case '+': // status reply
+		return reply.MakeStatusReply(string(line[1:])), nil
+	case '-': // err reply
+		return reply.MakeErrReply(string(line[1:])), nil
+	case ':': // int reply
+		val, ok := parseInt(line[1:])
+		if !ok {
+			return nil, makeProtocolError(line)
+		}
+		return reply.MakeIntReply(val), nil
+	case '$', '!', '=': // bulk string, blob error and verbatim string
+		return p.parseBlob(line)
+	case '*': // multi bulk reply
+		return p.parseArray(line)
+	case '%', '~', '>', '|': // map, set, push and attribute
+		return p.parseAggregate(line)
+	case ',': // double
+		val, err := strconv.ParseFloat(string(line[1:]), 64)
 		if err != nil {
-			return nil, true, err
+			return nil, makeProtocolError(line)
+		}
+		return reply.MakeDoubleReply(val), nil
+	case '#': // boolean
+		if len(line) != 2 || (line[1] != 't' && line[1] != 'f') {
+			return nil, makeProtocolError(line)
 		}
-		if len(msg) == 0 ||
-			msg[len(msg)-2] != '\r' ||
-			msg[len(msg)-1] != '\n' {
-			return nil, false, errors.New("reply error: " + string(msg))
+		return reply.MakeBooleanReply(line[1] == 't'), nil
+	case '_': // null
+		return reply.MakeNullReply(), nil
+	case '(': // big number
+		val, ok := new(big.Int).SetString(string(line[1:]), 10)
+		if !ok {
+			return nil, makeProtocolError(line)
 		}
-		state.bulkLen = 0
+		return reply.MakeBigNumberReply(val), nil
 	}
-	return msg, false, nil
+	return nil, makeProtocolError(line)
 }
 
-// parseMultiBulkHeader 处理多个数组输入
-func parseMultiBulkHeader(msg []byte, state *readState) error {
-	var err error
-	var expectedLine uint64
-	expectedLine, err = strconv.ParseUint(string(msg[1:len(msg)-2]), 10, 32) // 获取*后面的数字，需要输入数组的个数
+func (p *Parser) parseBlob(header []byte) (resp.Reply, error) {
+	length, err := parseLength(header)
 	if err != nil {
-		return errors.New("reply error: " + string(msg))
-	}
-	if expectedLine == 0 {
-		state.expectedArgsCount = 0
-		return nil
-	} else if expectedLine > 0 {
-		// first line of multi bulk reply
-		state.msgType = msg[0]
-		state.readingMultiLine = true
-		state.expectedArgsCount = int(expectedLine)
-		state.args = make([][]byte, 0, expectedLine)
-		return nil
-	} else {
-		return errors.New("reply error: " + string(msg))
+		return nil, err
+	}
+	if length == -1 {
+		return reply.MakeNullBulkReply(), nil
+	}
+	if p.maxBulkLen > 0 && length > p.maxBulkLen {
+		return nil, errInvalidBulkLen
+	}
+	typ := header[0] // header refers to read buffer, it is overwritten by readBlob
+	body, err := p.readBlob(length)
+	if err != nil {
+		return nil, err
+	}
+	switch typ {
+	case '!':
+		return reply.MakeErrReply(string(body)), nil
+	case '=':
+		if len(body) < 4 || body[3] != ':' {
+			return nil, makeProtocolError(body)
+		}
+		return reply.MakeVerbatimReply(string(body[:3]), body[4:]), nil
 	}
+	return reply.MakeBulkReply(body), nil
 }
 
-func parseBulkHeader(msg []byte, state *readState) error {
-	var err error
-	state.bulkLen, err = strconv.ParseInt(string(msg[1:len(msg)-2]), 10, 64)
+// parseArray returns MultiBulkReply if all elements are bulk strings, such as command line sent by client,
+// otherwise returns MultiRawReply
+func (p *Parser) parseArray(header []byte) (resp.Reply, error) {
+	length, err := parseLength(header)
 	if err != nil {
-		return errors.New("reply error: " + string(msg))
-	}
-	if state.bulkLen == -1 { // null bulk
-		return nil
-	} else if state.bulkLen > 0 {
-		state.msgType = msg[0]
-		state.readingMultiLine = true
-		state.expectedArgsCount = 1
-		state.args = make([][]byte, 0, 1)
-		return nil
-	} else {
-		return errors.New("reply error: " + string(msg))
+		return nil, err
+	}
+	if p.maxArrayLen > 0 && length > p.maxArrayLen {
+		return nil, errInvalidMultiBulkLen
+	}
+	if length == -1 {
+		return reply.MakeNullBulkReply(), nil
 	}
+	if length == 0 {
+		return reply.MakeEmptyMultiBulkReply(), nil
+	}
+	if p.allowInline {
+		// requests only contain bulk strings, read them into args directly
+		return p.parseCommandLine(length)
+	}
+	elements, err := p.parseElements(length)
+	if err != nil {
+		return nil, err
+	}
+	args := make([][]byte, len(elements))
+	for i, element := range elements {
+		switch v := element.(type) {
+		case *reply.BulkReply:
+			args[i] = v.Arg
+		case *reply.NullBulkReply:
+			args[i] = nil
+		default:
+			return reply.MakeMultiRawReply(elements), nil
+		}
+	}
+	return reply.MakeMultiBulkReply(args), nil
 }
 
-func parseSingleLineReply(msg []byte) (resp.Reply, error) {
-	str := strings.TrimSuffix(string(msg), "\r\n")
-	var result resp.Reply
-	switch msg[0] {
-	case '+': // status reply
-		result = reply.MakeStatusReply(str[1:])
-	case '-': // err reply
-		result = reply.MakeErrReply(str[1:])
-	case ':': // int reply
-		val, err := strconv.ParseInt(str[1:], 10, 64)
+// parseCommandLine reads a request of client, each element must be a bulk string like redis requires.
+// errors here are fatal because the rest of the array can't be located
+func (p *Parser) parseCommandLine(length int64) (resp.Reply, error) {
+	args := make([][]byte, 0, capacity(length))
+	for i := int64(0); i < length; i++ {
+		line, err := p.readLine()
 		if err != nil {
-			return nil, errors.New("reply error: " + string(msg))
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errors.New("ERR Protocol error: expected '$', got '" + string(line) + "'")
 		}
-		result = reply.MakeIntReply(val)
+		argLen, ok := parseInt(line[1:])
+		if !ok || argLen < 0 || argLen > p.maxBulkLen {
+			return nil, errInvalidBulkLen
+		}
+		arg, err := p.readBlob(argLen)
+		if IsProtocolError(err) {
+			return nil, errors.New(err.Error())
+		}
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
 	}
-	return result, nil
+	return reply.MakeMultiBulkReply(args), nil
 }
 
-// read the non-first lines of multi bulk reply or bulk reply
-func readBody(msg []byte, state *readState) error {
-	line := msg[0 : len(msg)-2]
-	var err error
-	if line[0] == '$' {
-		// bulk reply
-		state.bulkLen, err = strconv.ParseInt(string(line[1:]), 10, 64)
+func (p *Parser) parseAggregate(header []byte) (resp.Reply, error) {
+	length, err := parseLength(header)
+	if err != nil || length < 0 {
+		return nil, makeProtocolError(header)
+	}
+	typ := header[0]
+	if typ == '%' || typ == '|' {
+		length *= 2 // key-value pairs
+	}
+	elements, err := p.parseElements(length)
+	if err != nil {
+		return nil, err
+	}
+	switch typ {
+	case '%':
+		return reply.MakeMapReply(elements), nil
+	case '~':
+		return reply.MakeSetReply(elements), nil
+	case '>':
+		return reply.MakePushReply(elements), nil
+	}
+	// attributes are followed by the actual reply
+	actual, err := p.parseReply()
+	if err != nil {
+		return nil, err
+	}
+	return reply.MakeAttributeReply(elements, actual), nil
+}
+
+func (p *Parser) parseElements(length int64) ([]resp.Reply, error) {
+	elements := make([]resp.Reply, 0, capacity(length))
+	for i := int64(0); i < length; i++ {
+		element, err := p.parseReply()
 		if err != nil {
-			return errors.New("reply error: " + string(msg))
-		}
-		if state.bulkLen <= 0 { // null bulk in multi bulks
-			state.args = append(state.args, []byte{})
-			state.bulkLen = 0
+			return nil, err
 		}
-	} else {
-		state.args = append(state.args, line)
+		elements = append(elements, element)
+	}
+	return elements, nil
+}
+
+// capacity limits the preallocated size, the declared length can't be trusted before elements arrive
+func capacity(length int64) int64 {
+	if length > 1024 {
+		return 1024
 	}
-	return nil
+	return length
 }
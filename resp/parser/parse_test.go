@@ -0,0 +1,131 @@
+package parser
+
+import (
+	"bytes"
+	"goRedis/resp/reply"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseRequests(t *testing.T) {
+	data := "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$5\r\nhello\r\nGET k\r\n\r\n*1\r\n$4\r\nPING\r\n"
+	p := NewRequestParser(strings.NewReader(data), 0)
+	defer p.Release()
+	expected := [][]string{{"SET", "k", "hello"}, {"GET", "k"}, {"PING"}}
+	for _, args := range expected {
+		result, err := p.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mbr, ok := result.(*reply.MultiBulkReply)
+		if !ok || len(mbr.Args) != len(args) {
+			t.Fatalf("expected %q, got %q", args, result.ToBytes())
+		}
+		for i, arg := range args {
+			if string(mbr.Args[i]) != arg {
+				t.Fatalf("expected %q, got %q", args, result.ToBytes())
+			}
+		}
+	}
+	if _, err := p.Next(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestParseTooBigLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected error
+	}{
+		{"mbulk count", "*" + strings.Repeat("1", maxInlineSize+1) + "\r\n", errMultiBulkLenTooBig},
+		{"bulk count", "*1\r\n$" + strings.Repeat("1", maxInlineSize+1) + "\r\n", errBulkLenTooBig},
+		{"inline", strings.Repeat("a", maxInlineSize+1) + "\r\n", errInlineTooBig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewRequestParser(strings.NewReader(tt.data), 0)
+			defer p.Release()
+			_, err := p.Next()
+			if err != tt.expected {
+				t.Fatalf("expected %v, got %v", tt.expected, err)
+			}
+			if IsProtocolError(err) {
+				t.Fatal("too big line should be fatal")
+			}
+		})
+	}
+}
+
+func TestParseLongReplyLine(t *testing.T) {
+	// replies of server are trusted, status longer than maxInlineSize is allowed
+	status := strings.Repeat("a", maxInlineSize+1)
+	results, err := ParseBytes([]byte("+" + status + "\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || string(results[0].ToBytes()) != "+"+status+"\r\n" {
+		t.Fatal("wrong status reply")
+	}
+}
+
+// makePipeline returns n pipelined SET requests with values of the given size
+func makePipeline(n int, valueSize int) []byte {
+	var buf bytes.Buffer
+	value := bytes.Repeat([]byte("v"), valueSize)
+	for i := 0; i < n; i++ {
+		key := []byte("key:" + strconv.Itoa(i))
+		buf.Write(reply.MakeMultiBulkReply([][]byte{[]byte("SET"), key, value}).ToBytes())
+	}
+	return buf.Bytes()
+}
+
+func benchmarkPipeline(b *testing.B, n int, valueSize int) {
+	data := makePipeline(n, valueSize)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p := NewRequestParser(bytes.NewReader(data), 0)
+		for {
+			_, err := p.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		p.Release()
+	}
+}
+
+func BenchmarkParserPipelineSmall(b *testing.B) {
+	benchmarkPipeline(b, 1000, 16)
+}
+
+func BenchmarkParserPipelineLarge(b *testing.B) {
+	benchmarkPipeline(b, 100, 128*1024)
+}
+
+func BenchmarkParserInline(b *testing.B) {
+	data := bytes.Repeat([]byte("SET key value\r\n"), 1000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p := NewRequestParser(bytes.NewReader(data), 0)
+		for {
+			_, err := p.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		p.Release()
+	}
+}
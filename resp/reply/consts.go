@@ -72,3 +72,21 @@ var noBytes = []byte("")
 func (n NoReply) ToBytes() []byte {
 	return noBytes
 }
+
+// -----6、回复QUEUED，用于multi中的命令入队-----
+
+type QueuedReply struct{}
+
+var queuedBytes = []byte("+QUEUED\r\n")
+
+// ToBytes marshal resp reply
+func (r *QueuedReply) ToBytes() []byte {
+	return queuedBytes
+}
+
+var theQueuedReply = new(QueuedReply)
+
+// MakeQueuedReply returns a QUEUED reply
+func MakeQueuedReply() *QueuedReply {
+	return theQueuedReply
+}
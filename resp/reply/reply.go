@@ -20,7 +20,7 @@ type BulkReply struct {
 }
 
 func (b *BulkReply) ToBytes() []byte {
-	if len(b.Arg) == 0 {
+	if b.Arg == nil {
 		return nullBulkBytes
 	}
 	return []byte("$" + strconv.Itoa(len(b.Arg)) + CRLF + string(b.Arg) + CRLF)
@@ -49,7 +49,7 @@ func (m *MultiBulkReply) ToBytes() []byte {
 	buf.WriteString("*" + strconv.Itoa(argLen) + CRLF)
 	for _, arg := range m.Args {
 		if arg == nil {
-			buf.WriteString(string(nullBulkBytes) + CRLF)
+			buf.WriteString(string(nullBulkReplyBytes) + CRLF)
 		} else {
 			buf.WriteString("$" + strconv.Itoa(len(arg)) + CRLF + string(arg) + CRLF)
 		}
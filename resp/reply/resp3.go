@@ -0,0 +1,273 @@
+package reply
+
+import (
+	"bytes"
+	"goRedis/interface/resp"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+/*
+RESP3 回复类型，see https://github.com/redis/redis-specification/blob/master/protocol/RESP3.md
+connections using RESP2 receive replies converted by ConvertToResp2
+*/
+
+// ----- 1、Map Reply -----
+
+// MapReply stores key-value pairs in order
+type MapReply struct {
+	Pairs []resp.Reply // k1, v1, k2, v2 ...
+}
+
+// MakeMapReply creates MapReply, pairs is a flat list of keys and values
+func MakeMapReply(pairs []resp.Reply) *MapReply {
+	return &MapReply{
+		Pairs: pairs,
+	}
+}
+
+// ToBytes marshal resp.Reply
+func (r *MapReply) ToBytes() []byte {
+	return aggregateToBytes('%', len(r.Pairs)/2, r.Pairs)
+}
+
+// ----- 2、Set Reply -----
+
+// SetReply stores unordered distinct elements
+type SetReply struct {
+	Members []resp.Reply
+}
+
+// MakeSetReply creates SetReply
+func MakeSetReply(members []resp.Reply) *SetReply {
+	return &SetReply{
+		Members: members,
+	}
+}
+
+// ToBytes marshal resp.Reply
+func (r *SetReply) ToBytes() []byte {
+	return aggregateToBytes('~', len(r.Members), r.Members)
+}
+
+// ----- 3、Push Reply -----
+
+// PushReply is out of band data sent by server, such as messages of pub/sub
+type PushReply struct {
+	Replies []resp.Reply
+}
+
+// MakePushReply creates PushReply
+func MakePushReply(replies []resp.Reply) *PushReply {
+	return &PushReply{
+		Replies: replies,
+	}
+}
+
+// ToBytes marshal resp.Reply
+func (r *PushReply) ToBytes() []byte {
+	return aggregateToBytes('>', len(r.Replies), r.Replies)
+}
+
+// ----- 4、Attribute Reply -----
+
+// AttributeReply stores auxiliary key-value pairs followed by the actual reply
+type AttributeReply struct {
+	Attributes []resp.Reply // k1, v1, k2, v2 ...
+	Reply      resp.Reply
+}
+
+// MakeAttributeReply creates AttributeReply
+func MakeAttributeReply(attributes []resp.Reply, r resp.Reply) *AttributeReply {
+	return &AttributeReply{
+		Attributes: attributes,
+		Reply:      r,
+	}
+}
+
+// ToBytes marshal resp.Reply
+func (r *AttributeReply) ToBytes() []byte {
+	buf := aggregateToBytes('|', len(r.Attributes)/2, r.Attributes)
+	return append(buf, r.Reply.ToBytes()...)
+}
+
+func aggregateToBytes(prefix byte, size int, elements []resp.Reply) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(prefix)
+	buf.WriteString(strconv.Itoa(size) + CRLF)
+	for _, element := range elements {
+		buf.Write(element.ToBytes())
+	}
+	return buf.Bytes()
+}
+
+// ----- 5、Double Reply -----
+
+// DoubleReply stores a float64 number
+type DoubleReply struct {
+	Value float64
+}
+
+// MakeDoubleReply creates DoubleReply
+func MakeDoubleReply(value float64) *DoubleReply {
+	return &DoubleReply{
+		Value: value,
+	}
+}
+
+// ToBytes marshal resp.Reply
+func (r *DoubleReply) ToBytes() []byte {
+	return []byte("," + FormatDouble(r.Value) + CRLF)
+}
+
+// FormatDouble formats float the same as redis, such as 1.5, 1e+20, inf, -inf and nan
+func FormatDouble(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "inf"
+	case math.IsInf(value, -1):
+		return "-inf"
+	case math.IsNaN(value):
+		return "nan"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// ----- 6、Boolean Reply -----
+
+// BooleanReply stores true or false
+type BooleanReply struct {
+	Value bool
+}
+
+var (
+	trueBytes  = []byte("#t\r\n")
+	falseBytes = []byte("#f\r\n")
+)
+
+// MakeBooleanReply creates BooleanReply
+func MakeBooleanReply(value bool) *BooleanReply {
+	return &BooleanReply{
+		Value: value,
+	}
+}
+
+// ToBytes marshal resp.Reply
+func (r *BooleanReply) ToBytes() []byte {
+	if r.Value {
+		return trueBytes
+	}
+	return falseBytes
+}
+
+// ----- 7、Null Reply -----
+
+// NullReply is the null of RESP3, it represents both null string and null array
+type NullReply struct{}
+
+var nullBytes = []byte("_\r\n")
+
+// ToBytes marshal resp.Reply
+func (r *NullReply) ToBytes() []byte {
+	return nullBytes
+}
+
+var theNullReply = new(NullReply)
+
+// MakeNullReply returns NullReply
+func MakeNullReply() *NullReply {
+	return theNullReply
+}
+
+// ----- 8、Big Number Reply -----
+
+// BigNumberReply stores an integer out of the range of int64
+type BigNumberReply struct {
+	Value *big.Int
+}
+
+// MakeBigNumberReply creates BigNumberReply
+func MakeBigNumberReply(value *big.Int) *BigNumberReply {
+	return &BigNumberReply{
+		Value: value,
+	}
+}
+
+// ToBytes marshal resp.Reply
+func (r *BigNumberReply) ToBytes() []byte {
+	return []byte("(" + r.Value.String() + CRLF)
+}
+
+// ----- 9、Verbatim String Reply -----
+
+// VerbatimReply stores a string with its format, such as txt and mkd
+type VerbatimReply struct {
+	Format string // exactly 3 characters
+	Text   []byte
+}
+
+// MakeVerbatimReply creates VerbatimReply
+func MakeVerbatimReply(format string, text []byte) *VerbatimReply {
+	return &VerbatimReply{
+		Format: format,
+		Text:   text,
+	}
+}
+
+// ToBytes marshal resp.Reply
+func (r *VerbatimReply) ToBytes() []byte {
+	return []byte("=" + strconv.Itoa(len(r.Format)+1+len(r.Text)) + CRLF + r.Format + ":" + string(r.Text) + CRLF)
+}
+
+// ConvertToResp2 converts RESP3 replies to their RESP2 equivalents for connections using RESP2:
+// map and set become flat array, double and big number become bulk string, boolean becomes 1 or 0,
+// null becomes null bulk string, push becomes array and attributes are dropped.
+// returns the given reply itself if it contains no RESP3 reply
+func ConvertToResp2(r resp.Reply) resp.Reply {
+	switch v := r.(type) {
+	case *MapReply:
+		return MakeMultiRawReply(convertAll(v.Pairs))
+	case *SetReply:
+		return MakeMultiRawReply(convertAll(v.Members))
+	case *PushReply:
+		return MakeMultiRawReply(convertAll(v.Replies))
+	case *AttributeReply:
+		return ConvertToResp2(v.Reply)
+	case *DoubleReply:
+		return MakeBulkReply([]byte(FormatDouble(v.Value)))
+	case *BooleanReply:
+		if v.Value {
+			return MakeIntReply(1)
+		}
+		return MakeIntReply(0)
+	case *NullReply:
+		return MakeNullBulkReply()
+	case *BigNumberReply:
+		return MakeBulkReply([]byte(v.Value.String()))
+	case *VerbatimReply:
+		return MakeBulkReply(v.Text)
+	case *MultiRawReply:
+		for i, element := range v.Replies {
+			if converted := ConvertToResp2(element); converted != element {
+				// copy on write, the original reply may be shared
+				replies := make([]resp.Reply, len(v.Replies))
+				copy(replies, v.Replies)
+				replies[i] = converted
+				for j := i + 1; j < len(replies); j++ {
+					replies[j] = ConvertToResp2(replies[j])
+				}
+				return MakeMultiRawReply(replies)
+			}
+		}
+	}
+	return r
+}
+
+func convertAll(replies []resp.Reply) []resp.Reply {
+	result := make([]resp.Reply, len(replies))
+	for i, r := range replies {
+		result[i] = ConvertToResp2(r)
+	}
+	return result
+}
@@ -2,7 +2,6 @@ package server
 
 import (
 	"context"
-	"fmt"
 	"goRedis/cluster"
 	"goRedis/config"
 	"goRedis/database"
@@ -15,39 +14,63 @@ import (
 	"io"
 	"net"
 	"strings"
-	"sync"
+	"time"
 )
 
 var (
 	unknownErrReplyBytes = []byte("-ERR unknown\r\n")
+	okReplyBytes         = []byte("+OK\r\n")
 )
 
 // RespHandler 处理redis连接的结构体
 type RespHandler struct {
-	activeConn sync.Map
-	db         databaaseface.Database // redis核心
-	closing    atomic.Boolean
+	db      databaaseface.Database // redis核心
+	closing atomic.Boolean
 }
 
 func MakeHandler() *RespHandler {
 	var db databaaseface.Database
 
 	//db = database.NewEchoDatabase()
-	if config.Properties.Self != "" && len(config.Properties.Peers) > 0 {
+	if config.Properties().GetMode() == config.ClusterMode {
 		db = cluster.MakeClusterDatabase()
 	} else {
 		db = database.NewStandaloneDatabase()
 	}
-	return &RespHandler{
+	h := &RespHandler{
 		db: db,
 	}
+	go h.closeIdleClients()
+	return h
+}
+
+// closeIdleClients closes clients idle longer than `timeout` seconds every second, like clientsCron of redis.
+// subscribers and monitors only receive messages, they are never idle. clients blocked by CLIENT PAUSE are not idle either
+func (r *RespHandler) closeIdleClients() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		if r.closing.Get() {
+			return
+		}
+		timeout := time.Duration(config.Properties().Timeout) * time.Second
+		if timeout <= 0 {
+			continue
+		}
+		for _, client := range connection.ListClients() {
+			if client.SubsCount() == 0 && !client.IsMonitor() && !client.IsPaused() && client.GetIdleTime() > timeout {
+				logger.Info("close idle client: " + client.RemoteAddr().String())
+				client.Kill()
+			}
+		}
+	}
 }
 
 // 关闭单个客户端
 func (r *RespHandler) closeClient(client *connection.Connection) {
 	_ = client.Close()
 	r.db.AfterClientClose(client)
-	r.activeConn.Delete(client)
+	connection.Unregister(client)
 }
 
 // Handle 处理连接
@@ -56,21 +79,33 @@ func (r *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 		_ = conn.Close()
 	}
 	client := connection.NewConn(conn)
-	r.activeConn.Store(client, struct{}{}) // 新创建的客户端存进map中
-	ch := parser.ParseStream(conn)         // 解析数据
-	for payload := range ch {
-		if payload.Err != nil {
-			if payload.Err == io.EOF ||
-				payload.Err == io.ErrUnexpectedEOF ||
-				strings.Contains(payload.Err.Error(), "use of closed network connection") {
+	connection.Register(client) // 新创建的客户端存进注册表中，CLIENT LIST 可以看到
+	p := parser.NewRequestParser(conn, int64(config.Properties().ProtoMaxBulkLen))
+	defer p.Release()
+	for {
+		// replies of pipelined commands are buffered until all received requests are processed,
+		// so a pipeline is answered by a few writes rather than one write per command
+		if p.Buffered() == 0 {
+			if err := client.Flush(); err != nil {
+				r.closeClient(client)
+				logger.Info("connection closed: " + client.RemoteAddr().String())
+				return
+			}
+		}
+		payload, err := p.Next() // 解析数据
+		if err != nil {
+			if err == io.EOF ||
+				err == io.ErrUnexpectedEOF ||
+				strings.Contains(err.Error(), "use of closed network connection") {
 				r.closeClient(client)
 				logger.Info("connection closed: " + client.RemoteAddr().String())
 				return
 			}
 			// reply error
-			errReply := reply.MakeErrReply(payload.Err.Error())
-			err := client.Write(errReply.ToBytes())
-			if err != nil {
+			errReply := reply.MakeErrReply(err.Error())
+			writeErr := client.Write(errReply.ToBytes())
+			// the rest of stream can't be trusted after fatal errors, such as too big request
+			if writeErr != nil || !parser.IsProtocolError(err) {
 				r.closeClient(client)
 				logger.Info("connection closed: " + client.RemoteAddr().String())
 				return
@@ -78,23 +113,41 @@ func (r *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 			continue
 		}
 		// exec
-		if payload.Data == nil {
-			continue
-		}
-		reply, ok := payload.Data.(*reply.MultiBulkReply)
-		fmt.Printf("after ParseStream get reply:%s\n", reply)
-		//TODO
-
+		cmdLine, ok := payload.(*reply.MultiBulkReply)
 		if !ok {
 			logger.Error("require multi bulk reply")
 			continue
 		}
-		fmt.Printf("reply.Args is %s\n", reply.Args)
-		result := r.db.Exec(client, reply.Args)
+		if len(cmdLine.Args) > 0 && strings.ToLower(string(cmdLine.Args[0])) == "quit" {
+			_ = client.Write(okReplyBytes)
+			r.closeClient(client)
+			logger.Info("connection closed: " + client.RemoteAddr().String())
+			return
+		}
+		client.RecordCommand(strings.ToLower(string(cmdLine.Args[0])))
+		if database.IsClientPaused(client, cmdLine.Args) {
+			// send replies of previous commands before blocked by CLIENT PAUSE
+			_ = client.Flush()
+			client.SetPaused(true)
+			database.WaitClientUnpause(client, cmdLine.Args)
+			client.SetPaused(false)
+		}
+		result := r.db.Exec(client, cmdLine.Args)
+		database.FeedMonitors(client, cmdLine.Args, result)
+		var writeErr error
 		if result != nil {
-			client.Write(result.ToBytes())
+			if client.GetProtocol() == 2 {
+				result = reply.ConvertToResp2(result)
+			}
+			writeErr = client.WriteBuffered(result.ToBytes())
 		} else {
-			_ = client.Write(unknownErrReplyBytes)
+			writeErr = client.WriteBuffered(unknownErrReplyBytes)
+		}
+		if writeErr != nil || client.IsCloseAfterReply() {
+			_ = client.Flush()
+			r.closeClient(client)
+			logger.Info("connection closed: " + client.RemoteAddr().String())
+			return
 		}
 	}
 }
@@ -102,12 +155,9 @@ func (r *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 func (r *RespHandler) Close() error {
 	logger.Info("handler shutting down")
 	r.closing.Set(true)
-	r.activeConn.Range(
-		func(key interface{}, value interface{}) bool {
-			client := key.(*connection.Connection)
-			_ = client.Close()
-			return true
-		})
+	for _, client := range connection.ListClients() {
+		_ = client.Close()
+	}
 	r.db.Close()
 	return nil
 }
@@ -9,24 +9,34 @@ import (
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
 // Config stores tcp server properties
+// idle timeout of clients is enforced by the handler, which knows what the clients are doing
 type Config struct {
-	Address    string        `yaml:"address"`
-	MaxConnect uint32        `yaml:"max-connect"`
-	Timeout    time.Duration `yaml:"timeout"`
+	Address    string `yaml:"address"`
+	MaxConnect uint32 `yaml:"max-connect"` // 0 means unlimited
+	// period of TCP keepalive probes, 0 disables keepalive
+	KeepAlive time.Duration `yaml:"keep-alive"`
 }
 
-// ClientCounter Record the number of clients in the current goRedis server
-var ClientCounter int
+// ClientCounter Record the number of clients in the current goRedis server, use GetClientCount to read it
+var ClientCounter int32
+
+var maxClientsReplyBytes = []byte("-ERR max number of clients reached\r\n")
+
+// GetClientCount returns the number of connected clients
+func GetClientCount() int {
+	return int(atomic.LoadInt32(&ClientCounter))
+}
 
 // ListenAndServeWithSignal binds port and handle requests,blocking until receive stop signal
 func ListenAndServeWithSignal(cfg *Config, handler tcp.Handler) error {
 	closeChan := make(chan struct{}) // empty struct as signal
-	sigCh := make(chan os.Signal)
+	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT) // get system signal
 	go func() {
 		sig := <-sigCh
@@ -41,12 +51,12 @@ func ListenAndServeWithSignal(cfg *Config, handler tcp.Handler) error {
 		return err
 	}
 	logger.Info(fmt.Sprintf("bind:%s,start listening...", cfg.Address))
-	ListenAndServe(listener, handler, closeChan) // 端口信息  tcp.handler 函数   关闭信号
+	ListenAndServe(listener, cfg, handler, closeChan) // 端口信息  tcp.handler 函数   关闭信号
 	return nil
 }
 
 // ListenAndServe binds port and handle requests,blocking until close
-func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan <-chan struct{}) {
+func ListenAndServe(listener net.Listener, cfg *Config, handler tcp.Handler, closeChan <-chan struct{}) {
 	// listen signal
 	errCh := make(chan error, 1) // 接收错误信号
 	defer close(errCh)
@@ -69,17 +79,40 @@ func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan <-chan
 			errCh <- err
 			break
 		}
+		count := atomic.AddInt32(&ClientCounter, 1)
+		if cfg.MaxConnect > 0 && uint32(count) > cfg.MaxConnect {
+			// reject it like redis, rather than leaving it waiting
+			atomic.AddInt32(&ClientCounter, -1)
+			_, _ = conn.Write(maxClientsReplyBytes)
+			_ = conn.Close()
+			logger.Warn("max number of clients reached, reject " + conn.RemoteAddr().String())
+			continue
+		}
+		setKeepAlive(conn, cfg.KeepAlive)
 		// handle
 		logger.Info("accept link")
-		ClientCounter++
 		waitDone.Add(1)
 		go func() {
 			defer func() {
 				waitDone.Done()
-				ClientCounter--
+				atomic.AddInt32(&ClientCounter, -1)
 			}()
 			handler.Handle(ctx, conn) // 用协程来处理连接，一个协程对应一个tcp连接
 		}()
 	}
 	waitDone.Wait()
 }
+
+// setKeepAlive detects dead peers by TCP keepalive, so that their connections won't be kept forever
+func setKeepAlive(conn net.Conn, period time.Duration) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+	if period <= 0 {
+		_ = tcpConn.SetKeepAlive(false)
+		return
+	}
+	_ = tcpConn.SetKeepAlive(true)
+	_ = tcpConn.SetKeepAlivePeriod(period)
+}